@@ -0,0 +1,288 @@
+package backtest
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ludwig125/gke-stockprice/screen"
+)
+
+const dateLayout = "2006/01/02"
+
+// Bar has prices and indicator values of a code on a date.
+type Bar struct {
+	Date   string
+	Open   float64
+	Close  float64
+	Values map[string]float64 // EntryとExitの条件式を評価するための変数と定数
+}
+
+// Config is configuration of backtest.
+type Config struct {
+	Entry          *screen.Rule // この条件を満たした翌営業日の始値で買う
+	Exit           *screen.Rule // 保有中にこの条件を満たした翌営業日の始値で売る
+	Commission     float64      // 売買それぞれにかかる手数料率(0.001なら0.1%)
+	Slippage       float64      // 約定価格が不利な方向にずれる率
+	InitialCapital float64
+}
+
+// Trade is a round trip of a code.
+type Trade struct {
+	Code        string  `json:"code"`
+	EntryDate   string  `json:"entryDate"`
+	EntryPrice  float64 `json:"entryPrice"`
+	ExitDate    string  `json:"exitDate"`
+	ExitPrice   float64 `json:"exitPrice"`
+	Return      float64 `json:"return"` // 手数料を含めた損益率
+	HoldingDays int     `json:"holdingDays"`
+}
+
+// EquityPoint is total equity on a date.
+type EquityPoint struct {
+	Date   string  `json:"date"`
+	Equity float64 `json:"equity"`
+}
+
+// Result is result of backtest.
+type Result struct {
+	Trades      []Trade       `json:"trades"`
+	Equity      []EquityPoint `json:"equity"`
+	TotalReturn float64       `json:"totalReturn"`
+	CAGR        float64       `json:"cagr"`
+	MaxDrawdown float64       `json:"maxDrawdown"`
+	WinRate     float64       `json:"winRate"`
+	SkippedBars int           `json:"skippedBars"` // 変数がないなどでentry, exitの条件を評価できなかった足の数
+}
+
+// 銘柄ごとの資金枠
+// 初期資金を銘柄数で等分し、それぞれの枠の中で全額を売買する
+type slot struct {
+	cash     float64
+	shares   float64
+	position *Trade
+	lastBar  *Bar
+}
+
+func (s *slot) value() float64 {
+	if s.position == nil || s.lastBar == nil {
+		return s.cash
+	}
+	return s.shares * s.lastBar.Close
+}
+
+// Run replays Config over codeBars.
+// codeBarsのBarは銘柄ごとに日付の昇順で与える
+// 条件はその日の終値が確定した後に評価し、売買は翌営業日の始値で行う
+func Run(cfg Config, codeBars map[string][]Bar) (Result, error) {
+	if cfg.Entry == nil || cfg.Exit == nil {
+		return Result{}, errors.New("no entry or exit rule")
+	}
+	if cfg.InitialCapital <= 0 {
+		return Result{}, errors.New("initial capital must be positive")
+	}
+	if len(codeBars) == 0 {
+		return Result{}, errors.New("no bars")
+	}
+
+	codes := make([]string, 0, len(codeBars))
+	for code := range codeBars {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	slots := make(map[string]*slot, len(codes))
+	for _, code := range codes {
+		slots[code] = &slot{cash: cfg.InitialCapital / float64(len(codes))}
+	}
+
+	// 全銘柄の日付を昇順に並べ、日付ごとに各銘柄のBarを引けるようにする
+	dateCodeBar := make(map[string]map[string]*Bar)
+	for code, bars := range codeBars {
+		for i := range bars {
+			b := &bars[i]
+			if _, ok := dateCodeBar[b.Date]; !ok {
+				dateCodeBar[b.Date] = make(map[string]*Bar)
+			}
+			dateCodeBar[b.Date][code] = b
+		}
+	}
+	dates := make([]string, 0, len(dateCodeBar))
+	for d := range dateCodeBar {
+		dates = append(dates, d)
+	}
+	sort.Strings(dates)
+
+	var result Result
+	skipped := make(skips)
+	defer skipped.log()
+	pendingEntry := make(map[string]bool) // 翌営業日の始値で買う銘柄
+	pendingExit := make(map[string]bool)  // 翌営業日の始値で売る銘柄
+	holdingDays := make(map[string]int)
+	for _, date := range dates {
+		for _, code := range codes {
+			b, ok := dateCodeBar[date][code]
+			if !ok { // この日のデータがない銘柄は何もしない
+				continue
+			}
+			s := slots[code]
+
+			// 前営業日のシグナルを始値で約定する
+			if pendingExit[code] && s.position != nil {
+				result.Trades = append(result.Trades, s.closePosition(b.Date, b.Open, cfg, holdingDays[code]))
+			}
+			if pendingEntry[code] && s.position == nil {
+				// 始値が0や'--'の場合は約定できないので買わない
+				if b.Open > 0 {
+					s.openPosition(code, b.Date, b.Open, cfg)
+					holdingDays[code] = 0
+				} else {
+					skipped.add("entry price", code, b.Date, fmt.Errorf("invalid open: %v", b.Open))
+				}
+			}
+			pendingEntry[code], pendingExit[code] = false, false
+			s.lastBar = b
+
+			if s.position != nil {
+				holdingDays[code]++
+				// 古い行でカラムがNULLの場合などは評価できないので、その足ではシグナルなしとする
+				exit, err := cfg.Exit.Eval(b.Values)
+				if err != nil {
+					skipped.add("exit rule", code, b.Date, err)
+					result.SkippedBars++
+				}
+				pendingExit[code] = exit
+				continue
+			}
+			entry, err := cfg.Entry.Eval(b.Values)
+			if err != nil {
+				skipped.add("entry rule", code, b.Date, err)
+				result.SkippedBars++
+			}
+			pendingEntry[code] = entry
+		}
+
+		var equity float64
+		for _, code := range codes {
+			equity += slots[code].value()
+		}
+		result.Equity = append(result.Equity, EquityPoint{Date: date, Equity: equity})
+	}
+
+	// 最後まで保有している銘柄は最終日の終値で手仕舞う
+	for _, code := range codes {
+		s := slots[code]
+		if s.position != nil {
+			result.Trades = append(result.Trades, s.closePosition(s.lastBar.Date, s.lastBar.Close, cfg, holdingDays[code]))
+		}
+	}
+
+	var final float64
+	for _, code := range codes {
+		final += slots[code].cash
+	}
+	result.TotalReturn = final/cfg.InitialCapital - 1
+	result.CAGR = cagr(cfg.InitialCapital, final, dates[0], dates[len(dates)-1])
+	result.MaxDrawdown = maxDrawdown(result.Equity)
+	result.WinRate = winRate(result.Trades)
+	return result, nil
+}
+
+// 評価できなかった足などは1つずつログに出すと多すぎるので、理由ごとにまとめて最後にログに出す
+type skips map[string]*skip
+
+type skip struct {
+	bars  int
+	codes map[string]bool
+	first string // 最初にskipした足とその理由
+}
+
+func (s skips) add(reason, code, date string, err error) {
+	sk, ok := s[reason]
+	if !ok {
+		sk = &skip{codes: make(map[string]bool), first: fmt.Sprintf("code: %s, date: %s, %v", code, date, err)}
+		s[reason] = sk
+	}
+	sk.bars++
+	sk.codes[code] = true
+}
+
+func (s skips) log() {
+	reasons := make([]string, 0, len(s))
+	for r := range s {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+	for _, r := range reasons {
+		log.Printf("skip %s on %d bars of %d codes. first: %s", r, s[r].bars, len(s[r].codes), s[r].first)
+	}
+}
+
+func (s *slot) openPosition(code, date string, open float64, cfg Config) {
+	price := open * (1 + cfg.Slippage)
+	s.shares = s.cash * (1 - cfg.Commission) / price
+	s.position = &Trade{Code: code, EntryDate: date, EntryPrice: price}
+	s.cash = 0
+}
+
+func (s *slot) closePosition(date string, price float64, cfg Config, holdingDays int) Trade {
+	price = price * (1 - cfg.Slippage)
+	t := *s.position
+	t.ExitDate = date
+	t.ExitPrice = price
+	t.HoldingDays = holdingDays
+	// 買いと売りの両方の手数料を含める
+	t.Return = price/t.EntryPrice*(1-cfg.Commission)*(1-cfg.Commission) - 1
+
+	s.cash = s.shares * price * (1 - cfg.Commission)
+	s.shares = 0
+	s.position = nil
+	return t
+}
+
+// 年率換算した成長率
+// 期間が1日未満の場合は0を返す
+func cagr(initial, final float64, from, to string) float64 {
+	f, err1 := time.Parse(dateLayout, from)
+	t, err2 := time.Parse(dateLayout, to)
+	if err1 != nil || err2 != nil || initial <= 0 || final <= 0 {
+		return 0
+	}
+	years := t.Sub(f).Hours() / 24 / 365
+	if years <= 0 {
+		return 0
+	}
+	return math.Pow(final/initial, 1/years) - 1
+}
+
+// それまでの最大値からの下落率の最大値
+func maxDrawdown(equity []EquityPoint) float64 {
+	var peak, mdd float64
+	for _, e := range equity {
+		if e.Equity > peak {
+			peak = e.Equity
+		}
+		if peak > 0 {
+			if dd := (peak - e.Equity) / peak; dd > mdd {
+				mdd = dd
+			}
+		}
+	}
+	return mdd
+}
+
+func winRate(trades []Trade) float64 {
+	if len(trades) == 0 {
+		return 0
+	}
+	wins := 0
+	for _, t := range trades {
+		if t.Return > 0 {
+			wins++
+		}
+	}
+	return float64(wins) / float64(len(trades))
+}
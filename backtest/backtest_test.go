@@ -0,0 +1,236 @@
+package backtest
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/ludwig125/gke-stockprice/screen"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func mustParse(t *testing.T, src string) *screen.Rule {
+	t.Helper()
+	r, err := screen.Parse(src)
+	if err != nil {
+		t.Fatalf("failed to Parse: %v", err)
+	}
+	return r
+}
+
+func bar(date string, open, close, signal float64) Bar {
+	return Bar{Date: date, Open: open, Close: close, Values: map[string]float64{"signal": signal}}
+}
+
+func TestRun(t *testing.T) {
+	// 日付の昇順
+	bars := []Bar{
+		bar("2020/01/01", 100, 100, 1),  // entryシグナル
+		bar("2020/01/02", 110, 120, 0),  // 始値110で買う
+		bar("2020/01/03", 120, 130, -1), // exitシグナル
+		bar("2020/01/04", 132, 100, 0),  // 始値132で売る
+	}
+
+	tests := map[string]struct {
+		commission float64
+		slippage   float64
+		wantEntry  float64
+		wantExit   float64
+		wantReturn float64
+		wantEquity []float64
+	}{
+		"no_cost": {
+			wantEntry:  110,
+			wantExit:   132,
+			wantReturn: 0.2,
+			wantEquity: []float64{1000, 1000.0 / 110 * 120, 1000.0 / 110 * 130, 1200},
+		},
+		"with_cost": {
+			commission: 0.01,
+			slippage:   0.01,
+			wantEntry:  111.1,
+			wantExit:   130.68,
+			wantReturn: 130.68/111.1*0.99*0.99 - 1,
+			wantEquity: []float64{1000, 990 / 111.1 * 120, 990 / 111.1 * 130, 990 / 111.1 * 130.68 * 0.99},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := Config{
+				Entry:          mustParse(t, "signal == 1"),
+				Exit:           mustParse(t, "signal == -1"),
+				Commission:     tc.commission,
+				Slippage:       tc.slippage,
+				InitialCapital: 1000,
+			}
+			res, err := Run(cfg, map[string][]Bar{"1001": bars})
+			if err != nil {
+				t.Fatalf("failed to Run: %v", err)
+			}
+			if len(res.Trades) != 1 {
+				t.Fatalf("got trades: %#v", res.Trades)
+			}
+			tr := res.Trades[0]
+			if tr.EntryDate != "2020/01/02" || tr.ExitDate != "2020/01/04" || tr.HoldingDays != 2 {
+				t.Errorf("got trade: %#v", tr)
+			}
+			if !almostEqual(tr.EntryPrice, tc.wantEntry) || !almostEqual(tr.ExitPrice, tc.wantExit) || !almostEqual(tr.Return, tc.wantReturn) {
+				t.Errorf("got trade: %#v", tr)
+			}
+			if len(res.Equity) != len(tc.wantEquity) {
+				t.Fatalf("got equity: %#v", res.Equity)
+			}
+			for i, e := range res.Equity {
+				if !almostEqual(e.Equity, tc.wantEquity[i]) {
+					t.Errorf("%s got equity: %v, want: %v", e.Date, e.Equity, tc.wantEquity[i])
+				}
+			}
+			if !almostEqual(res.TotalReturn, tc.wantReturn) {
+				t.Errorf("got total return: %v, want: %v", res.TotalReturn, tc.wantReturn)
+			}
+			if res.WinRate != 1 {
+				t.Errorf("got win rate: %v", res.WinRate)
+			}
+		})
+	}
+}
+
+func TestRunClosesOpenPosition(t *testing.T) {
+	bars := []Bar{
+		bar("2020/01/01", 100, 100, 1),
+		bar("2020/01/02", 100, 90, 0),
+		bar("2020/01/03", 90, 80, 0),
+	}
+	cfg := Config{
+		Entry:          mustParse(t, "signal == 1"),
+		Exit:           mustParse(t, "signal == -1"),
+		InitialCapital: 1000,
+	}
+	res, err := Run(cfg, map[string][]Bar{"1001": bars})
+	if err != nil {
+		t.Fatalf("failed to Run: %v", err)
+	}
+	if len(res.Trades) != 1 {
+		t.Fatalf("got trades: %#v", res.Trades)
+	}
+	// 最終日の終値で手仕舞う
+	if tr := res.Trades[0]; tr.ExitDate != "2020/01/03" || !almostEqual(tr.Return, -0.2) {
+		t.Errorf("got trade: %#v", tr)
+	}
+	if res.WinRate != 0 || !almostEqual(res.MaxDrawdown, 0.2) {
+		t.Errorf("got win rate: %v, max drawdown: %v", res.WinRate, res.MaxDrawdown)
+	}
+}
+
+func TestRunError(t *testing.T) {
+	cfg := Config{
+		Entry:          mustParse(t, "unknownVariable == 1"),
+		Exit:           mustParse(t, "signal == -1"),
+		InitialCapital: 1000,
+	}
+	cfg.Entry = nil
+	if _, err := Run(cfg, map[string][]Bar{"1001": {bar("2020/01/01", 100, 100, 1)}}); err == nil {
+		t.Error("want error for no entry rule")
+	}
+}
+
+func TestRunSkipsUnevaluableBars(t *testing.T) {
+	// 2日目はsignalがない(NULLの行など)ので評価できない
+	bars := []Bar{
+		bar("2020/01/01", 100, 100, 0),
+		{Date: "2020/01/02", Open: 100, Close: 100, Values: map[string]float64{}},
+		bar("2020/01/03", 100, 100, 1),
+		bar("2020/01/04", 110, 120, 0),
+		{Date: "2020/01/05", Open: 120, Close: 120, Values: map[string]float64{}},
+		bar("2020/01/06", 120, 130, -1),
+		bar("2020/01/07", 130, 130, 0),
+	}
+	cfg := Config{
+		Entry:          mustParse(t, "signal == 1"),
+		Exit:           mustParse(t, "signal == -1"),
+		InitialCapital: 1000,
+	}
+	res, err := Run(cfg, map[string][]Bar{"1001": bars})
+	if err != nil {
+		t.Fatalf("failed to Run: %v", err)
+	}
+	if res.SkippedBars != 2 {
+		t.Errorf("got skipped bars: %d, want: 2", res.SkippedBars)
+	}
+	if len(res.Trades) != 1 || res.Trades[0].EntryDate != "2020/01/04" || res.Trades[0].ExitDate != "2020/01/07" {
+		t.Errorf("got trades: %#v", res.Trades)
+	}
+}
+
+func TestRunSkipsInvalidEntryPrice(t *testing.T) {
+	// 2日目の始値が0なので買わない。翌日以降にシグナルが出れば買う
+	bars := []Bar{
+		bar("2020/01/01", 100, 100, 1),
+		bar("2020/01/02", 0, 100, 0),
+		bar("2020/01/03", 100, 100, 1),
+		bar("2020/01/04", 110, 120, 0),
+	}
+	cfg := Config{
+		Entry:          mustParse(t, "signal == 1"),
+		Exit:           mustParse(t, "signal == -1"),
+		InitialCapital: 1000,
+	}
+	res, err := Run(cfg, map[string][]Bar{"1001": bars})
+	if err != nil {
+		t.Fatalf("failed to Run: %v", err)
+	}
+	if len(res.Trades) != 1 || res.Trades[0].EntryDate != "2020/01/04" {
+		t.Fatalf("got trades: %#v", res.Trades)
+	}
+	for _, e := range res.Equity {
+		if math.IsNaN(e.Equity) || math.IsInf(e.Equity, 0) || !almostEqual(e.Equity, 1000) && e.Date != "2020/01/04" {
+			t.Errorf("got equity: %#v", e)
+		}
+	}
+}
+
+func TestSkips(t *testing.T) {
+	s := make(skips)
+	s.add("entry rule", "1001", "2020/01/01", errors.New("unknown variable"))
+	s.add("entry rule", "1001", "2020/01/02", errors.New("unknown variable"))
+	s.add("entry rule", "1002", "2020/01/01", errors.New("unknown variable"))
+	sk := s["entry rule"]
+	if sk.bars != 3 || len(sk.codes) != 2 || sk.first != "code: 1001, date: 2020/01/01, unknown variable" {
+		t.Errorf("got: %d bars, %d codes, first: %s", sk.bars, len(sk.codes), sk.first)
+	}
+}
+
+func TestMaxDrawdown(t *testing.T) {
+	var equity []EquityPoint
+	for _, e := range []float64{100, 120, 90, 130, 65} {
+		equity = append(equity, EquityPoint{Equity: e})
+	}
+	if got := maxDrawdown(equity); !almostEqual(got, 0.5) {
+		t.Errorf("got: %v, want: 0.5", got)
+	}
+}
+
+func TestCAGR(t *testing.T) {
+	if got := cagr(1000, 1210, "2018/01/01", "2020/01/01"); !almostEqual(got, 0.1) {
+		t.Errorf("got: %v, want: 0.1", got)
+	}
+	if got := cagr(1000, 1210, "2020/01/01", "2020/01/01"); got != 0 {
+		t.Errorf("got: %v, want: 0", got)
+	}
+}
+
+func TestWriteTradesCSV(t *testing.T) {
+	r := Result{Trades: []Trade{{Code: "1001", EntryDate: "2020/01/02", EntryPrice: 110, ExitDate: "2020/01/04", ExitPrice: 132, Return: 0.2, HoldingDays: 2}}}
+	var buf bytes.Buffer
+	if err := r.WriteTradesCSV(&buf); err != nil {
+		t.Fatalf("failed to WriteTradesCSV: %v", err)
+	}
+	want := "code,entryDate,entryPrice,exitDate,exitPrice,return,holdingDays\n1001,2020/01/02,110,2020/01/04,132,0.2,2\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
@@ -0,0 +1,56 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// WriteTradesCSV writes trades as CSV.
+func (r Result) WriteTradesCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"code", "entryDate", "entryPrice", "exitDate", "exitPrice", "return", "holdingDays"}); err != nil {
+		return fmt.Errorf("failed to write header: %v", err)
+	}
+	for _, t := range r.Trades {
+		if err := cw.Write([]string{
+			t.Code,
+			t.EntryDate,
+			fmt.Sprintf("%g", t.EntryPrice),
+			t.ExitDate,
+			fmt.Sprintf("%g", t.ExitPrice),
+			fmt.Sprintf("%.6g", t.Return),
+			fmt.Sprintf("%d", t.HoldingDays),
+		}); err != nil {
+			return fmt.Errorf("failed to write trade: %v", err)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteEquityCSV writes equity curve as CSV.
+func (r Result) WriteEquityCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"date", "equity"}); err != nil {
+		return fmt.Errorf("failed to write header: %v", err)
+	}
+	for _, e := range r.Equity {
+		if err := cw.Write([]string{e.Date, fmt.Sprintf("%.2f", e.Equity)}); err != nil {
+			return fmt.Errorf("failed to write equity: %v", err)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes whole Result as JSON.
+func (r Result) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("failed to encode result: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ludwig125/gke-stockprice/backtest"
+	"github.com/ludwig125/gke-stockprice/candlestick"
+	"github.com/ludwig125/gke-stockprice/database"
+	"github.com/ludwig125/gke-stockprice/screen"
+)
+
+// dailyテーブルを遡って、entryとexitの条件式に従って売買した場合の結果をCSVとJSONで出力する
+// 条件式はスクリーニングと同じ変数と定数が使える
+func execBacktest(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backtest", flag.ContinueOnError)
+	from := fs.String("from", time.Now().AddDate(-1, 0, 0).Format("2006/01/02"), "from date. YYYY/MM/DD")
+	to := fs.String("to", time.Now().Format("2006/01/02"), "to date. YYYY/MM/DD")
+	codesFlag := fs.String("codes", "", "comma separated codes. all codes in daily table if empty")
+	entry := fs.String("entry", "trendTurn == upwardTurn", "entry rule")
+	exit := fs.String("exit", "trendTurn == downwardTurn", "exit rule")
+	commission := fs.Float64("commission", 0.001, "commission rate per trade")
+	slippage := fs.Float64("slippage", 0.001, "slippage rate per trade")
+	capital := fs.Float64("capital", 1000000, "initial capital")
+	out := fs.String("out", "backtest_result", "output directory")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %v", err)
+	}
+
+	entryRule, err := screen.Parse(*entry)
+	if err != nil {
+		return fmt.Errorf("failed to parse entry rule: %v", err)
+	}
+	exitRule, err := screen.Parse(*exit)
+	if err != nil {
+		return fmt.Errorf("failed to parse exit rule: %v", err)
+	}
+	screens := []screen.Screen{{Name: "entry", Rule: entryRule}, {Name: "exit", Rule: exitRule}}
+	if err := validateScreens(screens); err != nil {
+		return fmt.Errorf("failed to validateScreens: %v", err)
+	}
+
+	db, err := getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to getDatabase: %v", err)
+	}
+	defer db.CloseDB()
+
+	codes := strToSlice(*codesFlag)
+	if *codesFlag == "" {
+		if codes, err = fetchDailyCodes(db); err != nil {
+			return fmt.Errorf("failed to fetchDailyCodes: %v", err)
+		}
+	}
+
+	codeBars, err := fetchBacktestBars(db, screens, codes, *from, *to)
+	if err != nil {
+		return fmt.Errorf("failed to fetchBacktestBars: %v", err)
+	}
+	res, err := backtest.Run(backtest.Config{
+		Entry:          entryRule,
+		Exit:           exitRule,
+		Commission:     *commission,
+		Slippage:       *slippage,
+		InitialCapital: *capital,
+	}, codeBars)
+	if err != nil {
+		return fmt.Errorf("failed to backtest.Run: %v", err)
+	}
+	log.Printf("backtest finished. trades: %d, totalReturn: %.4f, CAGR: %.4f, maxDrawdown: %.4f, winRate: %.4f, skippedBars: %d",
+		len(res.Trades), res.TotalReturn, res.CAGR, res.MaxDrawdown, res.WinRate, res.SkippedBars)
+
+	if err := writeBacktestResult(res, *out); err != nil {
+		return fmt.Errorf("failed to writeBacktestResult: %v", err)
+	}
+	return nil
+}
+
+func fetchDailyCodes(db database.DB) ([]string, error) {
+	res, err := db.SelectDB("SELECT DISTINCT code FROM daily ORDER BY code;")
+	if err != nil {
+		return nil, fmt.Errorf("failed to selectTable %v", err)
+	}
+	codes := make([]string, 0, len(res))
+	for _, r := range res {
+		codes = append(codes, r[0])
+	}
+	return codes, nil
+}
+
+// 銘柄ごとに日付の昇順のBarを作る
+// Valuesには条件式で使われている変数のtableの値と定数を入れる
+// 期間内にデータのない銘柄(上場前や上場廃止後など)は含めない
+func fetchBacktestBars(db database.DB, screens []screen.Screen, codes []string, from, to string) (map[string][]backtest.Bar, error) {
+	codeDateBars, err := selectCodesDateBars(db, "daily", codes, fmt.Sprintf("AND date >= '%s'", from), fmt.Sprintf("AND date <= '%s'", to), "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to selectCodesDateBars: %v", err)
+	}
+	if missing := len(codes) - len(codeDateBars); missing > 0 {
+		log.Printf("skip %d codes without daily data in %s-%s", missing, from, to)
+	}
+
+	tables := make(map[string]bool)
+	for _, s := range screens {
+		for _, id := range s.Rule.Identifiers() {
+			if table, ok := screenVariableTable(id); ok && table != "daily" { // dailyの値はDateBarから入れる
+				tables[table] = true
+			}
+		}
+	}
+	// patternsは他のtableと形式が違うので別に取得する
+	var codeDatePatterns map[string]map[string][]candlestick.Pattern
+	if tables[patternsTable] {
+		delete(tables, patternsTable)
+		codeDatePatterns, err = fetchCodeDatePatterns(db, patternsTable, codes, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetchCodeDatePatterns: %v", err)
+		}
+	}
+	tableValues := make(map[string]map[string]map[string]map[string]float64, len(tables))
+	for table := range tables {
+		v, err := fetchCodeDateValues(db, table, screenVariableTables[table], codes, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetchCodeDateValues: %v", err)
+		}
+		tableValues[table] = v
+	}
+
+	consts := screenConstants()
+	codeBars := make(map[string][]backtest.Bar, len(codeDateBars))
+	for code, dateBars := range codeDateBars {
+		bars := make([]backtest.Bar, 0, len(dateBars))
+		for i := len(dateBars) - 1; i >= 0; i-- { // 日付の昇順
+			b := dateBars[i]
+			values := make(map[string]float64, len(consts))
+			for k, v := range consts {
+				values[k] = v
+			}
+			values["open"], values["high"], values["low"], values["close"], values["turnover"] = b.Open, b.High, b.Low, b.Close, b.Turnover
+			for _, v := range tableValues {
+				for k, f := range v[code][b.Date] {
+					values[k] = f
+				}
+			}
+			if codeDatePatterns != nil {
+				for k, f := range patternValues(codeDatePatterns[code][b.Date]) {
+					values[k] = f
+				}
+			}
+			bars = append(bars, backtest.Bar{Date: b.Date, Open: b.Open, Close: b.Close, Values: values})
+		}
+		codeBars[code] = bars
+	}
+	return codeBars, nil
+}
+
+func writeBacktestResult(res backtest.Result, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to MkdirAll: %v", err)
+	}
+	files := map[string]func(f *os.File) error{
+		"trades.csv":  func(f *os.File) error { return res.WriteTradesCSV(f) },
+		"equity.csv":  func(f *os.File) error { return res.WriteEquityCSV(f) },
+		"result.json": func(f *os.File) error { return res.WriteJSON(f) },
+	}
+	var written []string
+	for name, write := range files {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", path, err)
+		}
+		if err := write(f); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to close %s: %v", path, err)
+		}
+		written = append(written, path)
+	}
+	log.Printf("backtest result written: %s", strings.Join(written, ", "))
+	return nil
+}
@@ -0,0 +1,41 @@
+// +build !integration
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/ludwig125/gke-stockprice/screen"
+)
+
+func TestFetchBacktestBarsSkipsCodesWithoutData(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	db := newFakeDB([]string{"1001", "1002"}, 10, 0)
+	rule, err := screen.Parse("close > 0")
+	if err != nil {
+		t.Fatalf("failed to Parse: %v", err)
+	}
+	screens := []screen.Screen{{Name: "entry", Rule: rule}, {Name: "exit", Rule: rule}}
+
+	// 9999は期間内にデータがない(上場廃止など)
+	codeBars, err := fetchBacktestBars(db, screens, []string{"1001", "1002", "9999"}, "2020/01/06", "2020/01/15")
+	if err != nil {
+		t.Fatalf("failed to fetchBacktestBars: %v", err)
+	}
+	if len(codeBars) != 2 || len(codeBars["1001"]) != 10 || len(codeBars["1002"]) != 10 {
+		t.Errorf("got codes: %d, 1001: %d bars, 1002: %d bars", len(codeBars), len(codeBars["1001"]), len(codeBars["1002"]))
+	}
+	// 日付の昇順
+	if got := codeBars["1001"][0].Date; got != "2020/01/06" {
+		t.Errorf("got first date: %s, want: 2020/01/06", got)
+	}
+
+	if _, err := fetchCodesDateBars(db, "daily", []string{"1001", "9999"}, "AND date >= '2020/01/06'", "AND date <= '2020/01/15'", ""); err == nil {
+		t.Error("want error of fetchCodesDateBars for codes without data")
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ludwig125/gke-stockprice/database"
+)
+
+// 全銘柄のtrendや値動きを日付ごとに集計して、相場全体の状況(騰落)を見られるようにする
+
+// highlow tableを使わない場合に、52週高値(安値)の判定に使う期間(週)
+const newHighLowWeeks = 52
+
+// 騰落の判定に前営業日の終値がとれるように遡る日数(営業日ではなく暦日)
+const advanceDeclineFetchDays = 14
+
+// 日足を一度に取得する銘柄数
+const breadthFetchCodes = 100
+
+// Breadth is aggregation of all codes on a date.
+type Breadth struct {
+	date            string
+	trendCounts     [6]int // Trendの値ごとの銘柄数。indexはTrend
+	upwardTurns     int
+	downwardTurns   int
+	upwardCrosses   int
+	downwardCrosses int
+	newHighs        int // 52週高値を更新した銘柄数
+	newLows         int // 52週安値を更新した銘柄数
+	advances        int // 前営業日より終値が上がった銘柄数
+	declines        int // 前営業日より終値が下がった銘柄数
+	unchanged       int
+}
+
+// 値下がり銘柄がない場合は0とする
+func (b Breadth) advanceDeclineRatio() float64 {
+	if b.declines == 0 {
+		return 0
+	}
+	return float64(b.advances) / float64(b.declines)
+}
+
+// breadth tableのカラムの順に並べる
+func (b Breadth) slice() []string {
+	s := []string{b.date}
+	for _, t := range []Trend{longTermAdvance, shortTermAdvance, non, shortTermDecline, longTermDecline} {
+		s = append(s, fmt.Sprintf("%d", b.trendCounts[t]))
+	}
+	for _, n := range []int{b.upwardTurns, b.downwardTurns, b.upwardCrosses, b.downwardCrosses, b.newHighs, b.newLows, b.advances, b.declines, b.unchanged} {
+		s = append(s, fmt.Sprintf("%d", n))
+	}
+	return append(s, fmt.Sprintf("%.4g", b.advanceDeclineRatio()))
+}
+
+func (b Breadth) slackMsg() string {
+	return fmt.Sprintf("breadth %s: 値上がり %d / 値下がり %d (騰落比 %.2f), 52週高値 %d / 52週安値 %d, trend %s %d %s %d %s %d %s %d %s %d",
+		b.date, b.advances, b.declines, b.advanceDeclineRatio(), b.newHighs, b.newLows,
+		longTermAdvance, b.trendCounts[longTermAdvance],
+		shortTermAdvance, b.trendCounts[shortTermAdvance],
+		non, b.trendCounts[non],
+		shortTermDecline, b.trendCounts[shortTermDecline],
+		longTermDecline, b.trendCounts[longTermDecline])
+}
+
+// codeDateBarsは銘柄ごとに日付の降順で、dateと前営業日のデータが入っていることを期待する
+// dateのデータがない銘柄は騰落の集計から除く
+// eventsは銘柄ごとのdateのHighLowEventで、newHigh, breakoutを高値更新、newLowを安値更新として数える
+func calculateBreadth(date string, trends map[string]TrendList, codeDateBars map[string][]DateBar, events map[string]HighLowEvent) Breadth {
+	b := Breadth{date: date}
+	for _, tl := range trends {
+		b.trendCounts[tl.trend]++
+		switch tl.trendTurn {
+		case upwardTurn:
+			b.upwardTurns++
+		case downwardTurn:
+			b.downwardTurns++
+		}
+		switch tl.crossMoving5 {
+		case upwardCross:
+			b.upwardCrosses++
+		case downwardCross:
+			b.downwardCrosses++
+		}
+	}
+
+	for _, dateBars := range codeDateBars {
+		if len(dateBars) < 2 || dateBars[0].Date != date {
+			continue
+		}
+		switch latest := dateBars[0]; {
+		case latest.Close > dateBars[1].Close:
+			b.advances++
+		case latest.Close < dateBars[1].Close:
+			b.declines++
+		default:
+			b.unchanged++
+		}
+	}
+
+	for _, e := range events {
+		switch e {
+		case newHigh, breakout:
+			b.newHighs++
+		case newLow:
+			b.newLows++
+		}
+	}
+	return b
+}
+
+// highlow tableがない場合に日足からdateのHighLowEventを計算する
+// calculateHighLowと同じく期間全体のデータがない銘柄はunknownになり、高値、安値の更新に数えない
+func highLowEventsFromBars(codeDateBars map[string][]DateBar, weeks int, date string) (map[string]HighLowEvent, error) {
+	events := make(map[string]HighLowEvent, len(codeDateBars))
+	for code, dateBars := range codeDateBars {
+		dhs, err := calculateHighLow(dateBars, weeks, date)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculateHighLow: %v, code: %s", err, code)
+		}
+		if len(dhs) > 0 && dhs[0].Date == date {
+			events[code] = dhs[0].Event
+		}
+	}
+	return events, nil
+}
+
+// breadthの計算に必要なtrendと日足を取得して、breadth tableに書き込む
+// highLowTableを指定した場合は、そこに書き込まれたdateのhighLowEventで高値、安値の更新を数える
+// 空の場合は52週分の日足から計算する
+func calcBreadth(db database.DB, trendTable, highLowTable, breadthTable string, codes []string, date string) (Breadth, error) {
+	t, err := time.Parse("2006/01/02", date)
+	if err != nil {
+		return Breadth{}, fmt.Errorf("failed to parse date: %s, %v", date, err)
+	}
+
+	trends, err := fetchTrendList(db, trendTable, codes, date)
+	if err != nil {
+		return Breadth{}, fmt.Errorf("failed to fetchTrendList: %v", err)
+	}
+
+	fromDate := t.AddDate(0, 0, -advanceDeclineFetchDays).Format("2006/01/02")
+	if highLowTable == "" {
+		// 期間の初日が休日でもそれ以前の足がとれるように1週間多く遡る
+		fromDate = t.AddDate(0, 0, -(newHighLowWeeks+1)*7).Format("2006/01/02")
+	}
+	codeDateBars, err := fetchDailyBarsInBatches(db, codes, fromDate, date)
+	if err != nil {
+		return Breadth{}, fmt.Errorf("failed to fetchDailyBarsInBatches: %v", err)
+	}
+
+	var events map[string]HighLowEvent
+	if highLowTable != "" {
+		codeValues, err := fetchCodeValues(db, highLowTable, []string{"highLowEvent"}, codes, date)
+		if err != nil {
+			return Breadth{}, fmt.Errorf("failed to fetchCodeValues: %v", err)
+		}
+		events = make(map[string]HighLowEvent, len(codeValues))
+		for code, v := range codeValues {
+			events[code] = HighLowEvent(v["highLowEvent"])
+		}
+	} else {
+		if events, err = highLowEventsFromBars(codeDateBars, newHighLowWeeks, date); err != nil {
+			return Breadth{}, fmt.Errorf("failed to highLowEventsFromBars: %v", err)
+		}
+	}
+
+	b := calculateBreadth(date, trends, codeDateBars, events)
+	if err := db.InsertOrUpdateDB(breadthTable, [][]string{b.slice()}); err != nil {
+		return Breadth{}, fmt.Errorf("failed to insert %s: %v", breadthTable, err)
+	}
+	log.Printf("write %s successfully, date: %s", breadthTable, date)
+	return b, nil
+}
+
+// 全銘柄の日足を一度に取得する量が多くなりすぎないようにbreadthFetchCodesごとに取得する
+// 期間内にデータのない銘柄(上場前や上場廃止後など)は返り値に含めない
+func fetchDailyBarsInBatches(db database.DB, codes []string, fromDate, toDate string) (map[string][]DateBar, error) {
+	codeDateBars := make(map[string][]DateBar, len(codes))
+	for start := 0; start < len(codes); start += breadthFetchCodes {
+		end := start + breadthFetchCodes
+		if end > len(codes) {
+			end = len(codes)
+		}
+		cdb, err := selectCodesDateBars(db, "daily", codes[start:end], fmt.Sprintf("AND date >= '%s'", fromDate), fmt.Sprintf("AND date <= '%s'", toDate), "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to selectCodesDateBars: %v", err)
+		}
+		for code, dateBars := range cdb {
+			codeDateBars[code] = dateBars
+		}
+	}
+	if missing := len(codes) - len(codeDateBars); missing > 0 {
+		log.Printf("%d codes have no daily data in %s-%s", missing, fromDate, toDate)
+	}
+	return codeDateBars, nil
+}
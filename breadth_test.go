@@ -0,0 +1,118 @@
+// +build !integration
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCalculateBreadth(t *testing.T) {
+	trends := map[string]TrendList{
+		"1001": {trend: longTermAdvance, trendTurn: upwardTurn, crossMoving5: upwardCross},
+		"1002": {trend: longTermAdvance, trendTurn: noTurn, crossMoving5: noCross},
+		"1003": {trend: non, trendTurn: downwardTurn, crossMoving5: downwardCross},
+		"1004": {trend: shortTermDecline, trendTurn: noTurn, crossMoving5: noCross},
+	}
+	// 日付の降順
+	codeDateBars := map[string][]DateBar{
+		"1001": { // 値上がりして52週高値を更新
+			{Date: "2021/01/05", High: 130, Low: 110, Close: 125},
+			{Date: "2021/01/04", High: 120, Low: 105, Close: 115},
+			{Date: "2020/06/01", High: 128, Low: 100, Close: 110},
+			{Date: "2019/12/27", High: 100, Low: 90, Close: 95}, // 52週前より古い
+		},
+		"1002": { // 変わらず
+			{Date: "2021/01/05", High: 120, Low: 110, Close: 115},
+			{Date: "2021/01/04", High: 120, Low: 105, Close: 115},
+		},
+		"1003": { // 値下がりして52週安値を更新
+			{Date: "2021/01/05", High: 100, Low: 80, Close: 85},
+			{Date: "2021/01/04", High: 110, Low: 90, Close: 95},
+			{Date: "2020/06/01", High: 120, Low: 85, Close: 100},
+			{Date: "2019/12/27", High: 100, Low: 90, Close: 95},
+		},
+		"1004": { // 当日のデータがないので集計しない
+			{Date: "2021/01/04", High: 100, Low: 50, Close: 60},
+			{Date: "2020/12/30", High: 120, Low: 90, Close: 100},
+		},
+	}
+
+	events, err := highLowEventsFromBars(codeDateBars, newHighLowWeeks, "2021/01/05")
+	if err != nil {
+		t.Fatalf("failed to highLowEventsFromBars: %v", err)
+	}
+	got := calculateBreadth("2021/01/05", trends, codeDateBars, events)
+	want := Breadth{
+		date:            "2021/01/05",
+		trendCounts:     [6]int{longTermAdvance: 2, non: 1, shortTermDecline: 1},
+		upwardTurns:     1,
+		downwardTurns:   1,
+		upwardCrosses:   1,
+		downwardCrosses: 1,
+		newHighs:        1,
+		newLows:         1,
+		advances:        1,
+		declines:        1,
+		unchanged:       1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %#v, want: %#v", got, want)
+	}
+
+	wantSlice := []string{"2021/01/05", "2", "0", "1", "1", "0", "1", "1", "1", "1", "1", "1", "1", "1", "1", "1"}
+	if s := got.slice(); !reflect.DeepEqual(s, wantSlice) {
+		t.Errorf("got: %v, want: %v", s, wantSlice)
+	}
+}
+
+func TestBreadthHighLowEvents(t *testing.T) {
+	// 上場して間もない銘柄は52週分のデータがないので、高値を更新しても数えない
+	codeDateBars := map[string][]DateBar{
+		"1001": {
+			{Date: "2021/01/05", High: 130, Low: 110, Close: 125},
+			{Date: "2021/01/04", High: 120, Low: 105, Close: 115},
+		},
+	}
+	events, err := highLowEventsFromBars(codeDateBars, newHighLowWeeks, "2021/01/05")
+	if err != nil {
+		t.Fatalf("failed to highLowEventsFromBars: %v", err)
+	}
+	if want := map[string]HighLowEvent{"1001": unknownHighLowEvent}; !reflect.DeepEqual(events, want) {
+		t.Errorf("got: %v, want: %v", events, want)
+	}
+	if b := calculateBreadth("2021/01/05", nil, codeDateBars, events); b.newHighs != 0 || b.advances != 1 {
+		t.Errorf("got newHighs: %d, advances: %d", b.newHighs, b.advances)
+	}
+
+	// highlow tableのeventを使う場合はbreakoutも高値更新として数える
+	b := calculateBreadth("2021/01/05", nil, nil, map[string]HighLowEvent{
+		"1001": breakout, "1002": newHigh, "1003": newLow, "1004": noHighLowEvent, "1005": unknownHighLowEvent,
+	})
+	if b.newHighs != 2 || b.newLows != 1 {
+		t.Errorf("got newHighs: %d, newLows: %d", b.newHighs, b.newLows)
+	}
+}
+
+func TestAdvanceDeclineRatio(t *testing.T) {
+	tests := map[string]struct {
+		b    Breadth
+		want float64
+	}{
+		"normal": {
+			b:    Breadth{advances: 300, declines: 200},
+			want: 1.5,
+		},
+		"no_declines": {
+			b:    Breadth{advances: 300},
+			want: 0,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.b.advanceDeclineRatio(); got != tc.want {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"sort"
+	"strconv"
 	"time"
 
+	"github.com/ludwig125/gke-stockprice/candlestick"
 	"github.com/ludwig125/gke-stockprice/database"
 	"github.com/pkg/errors"
 )
@@ -14,30 +17,56 @@ import (
 
 // CalcMovingTrend is struct.
 type CalcMovingTrend struct {
-	DB                    database.DB
-	DailyTable            string
-	MovingAvgTable        string
-	TrendTable            string
-	Codes                 []string
-	FromDate              string
-	ToDate                string
-	MaxConcurrency        int
-	LongTermThresholdDays int
+	DB              database.DB
+	DailyTable      string
+	MovingAvgTable  string
+	TrendTable      string
+	VolatilityTable string // 空の場合はvolatilityを計算しない
+	VolumeTable     string // 空の場合はvolumeを計算しない
+	CrossoverTable  string // 空の場合はcrossoverを検出しない
+	HighLowTable    string // 空の場合は高値、安値を計算しない
+	HighLowWeeks    int    // 高値、安値をとる期間(週)
+	PatternsTable   string // 空の場合はローソク足のパターンを検出しない
+	MovingAvgPairs  []MovingAvgPair
+	TrendClassifier TrendClassifier
+	TrendParams     TrendParams
+	// table名と比較用のTrendClassifier, TrendParamsのMap
+	ComparisonTrendClassifiers map[string]TrendClassifier
+	ComparisonTrendParams      map[string]TrendParams
+	TrendParamsTable           string // 空の場合はTrendParamsを書き込まない
+	Codes                      []string
+	FromDate                   string
+	ToDate                     string
+	MaxConcurrency             int         // 1batchで処理する銘柄数
+	PipelineWorkers            int         // fetch, writeのstageで同時にDBにアクセスする数
+	Checkpoint                 *Checkpoint // nilでなければ完了済みの銘柄を計算しない
 	// RestructureMovingavg  bool
 	// RestructureTrend      bool
 }
 
 // CalcMovingTrendConfig is config for CalcMovingTrend.
 type CalcMovingTrendConfig struct {
-	DB                    database.DB
-	DailyTable            string
-	MovingAvgTable        string
-	TrendTable            string
+	DB              database.DB
+	DailyTable      string
+	MovingAvgTable  string
+	TrendTable      string
+	VolatilityTable string
+	VolumeTable     string
+	CrossoverTable  string
+	HighLowTable    string
+	HighLowWeeks    int // 0の場合はdefaultHighLowWeeksを使う
+	PatternsTable   string
+	MovingAvgPairs  []MovingAvgPair // 空の場合はdefaultMovingAvgPairsを使う
+	TrendParams     TrendParams     // 0値のフィールドはdefaultTrendParamsの値を使う
+	// TrendClassifierの名前とtable名のMap。TrendTableとは別に比較用のtrendを書き込む
+	ComparisonTrendTables map[string]string
+	TrendParamsTable      string
 	Codes                 []string
 	FromDate              string
 	ToDate                string
 	MaxConcurrency        int
-	LongTermThresholdDays int
+	PipelineWorkers       int // 0の場合はdefaultPipelineWorkersを使う
+	Checkpoint            *Checkpoint
 	// RestructureMovingavg  bool
 	// RestructureTrend      bool
 }
@@ -90,84 +119,334 @@ func NewCalcMovingTrend(c CalcMovingTrendConfig) (*CalcMovingTrend, error) {
 	if c.MaxConcurrency > 0 {
 		maxConcurrency = c.MaxConcurrency
 	}
-	longTermThresholdDays := 2 // TODO
-	if c.LongTermThresholdDays > 0 {
-		longTermThresholdDays = c.LongTermThresholdDays
+	highLowWeeks := defaultHighLowWeeks
+	if c.HighLowWeeks > 0 {
+		highLowWeeks = c.HighLowWeeks
+	}
+	pipelineWorkers := defaultPipelineWorkers
+	if c.PipelineWorkers > 0 {
+		pipelineWorkers = c.PipelineWorkers
+	}
+	trendParams := c.TrendParams.withDefaults()
+	classifier, err := getTrendClassifier(trendParams.Classifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to getTrendClassifier: %v", err)
+	}
+	comparisonClassifiers := make(map[string]TrendClassifier, len(c.ComparisonTrendTables))
+	comparisonParams := make(map[string]TrendParams, len(c.ComparisonTrendTables))
+	for name, table := range c.ComparisonTrendTables {
+		if table == c.TrendTable {
+			return nil, fmt.Errorf("comparison trend table must be different from TrendTable: %s", table)
+		}
+		cl, err := getTrendClassifier(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to getTrendClassifier: %v", err)
+		}
+		comparisonClassifiers[table] = cl
+		p := trendParams
+		p.Classifier = name
+		comparisonParams[table] = p
+	}
+	movingAvgPairs := defaultMovingAvgPairs
+	if len(c.MovingAvgPairs) > 0 {
+		movingAvgPairs = c.MovingAvgPairs
 	}
-
 	return &CalcMovingTrend{
-		DB:                    c.DB,
-		DailyTable:            c.DailyTable,
-		MovingAvgTable:        c.MovingAvgTable,
-		TrendTable:            c.TrendTable,
-		Codes:                 c.Codes,
-		FromDate:              fromDate,
-		ToDate:                toDate,
-		MaxConcurrency:        maxConcurrency,
-		LongTermThresholdDays: longTermThresholdDays,
+		DB:                         c.DB,
+		DailyTable:                 c.DailyTable,
+		MovingAvgTable:             c.MovingAvgTable,
+		TrendTable:                 c.TrendTable,
+		VolatilityTable:            c.VolatilityTable,
+		VolumeTable:                c.VolumeTable,
+		CrossoverTable:             c.CrossoverTable,
+		HighLowTable:               c.HighLowTable,
+		HighLowWeeks:               highLowWeeks,
+		PatternsTable:              c.PatternsTable,
+		MovingAvgPairs:             movingAvgPairs,
+		TrendClassifier:            classifier,
+		TrendParams:                trendParams,
+		ComparisonTrendClassifiers: comparisonClassifiers,
+		ComparisonTrendParams:      comparisonParams,
+		TrendParamsTable:           c.TrendParamsTable,
+		Codes:                      c.Codes,
+		FromDate:                   fromDate,
+		ToDate:                     toDate,
+		MaxConcurrency:             maxConcurrency,
+		PipelineWorkers:            pipelineWorkers,
+		Checkpoint:                 c.Checkpoint,
 		// RestructureMovingavg:  c.RestructureMovingavg,
 		// RestructureTrend:      c.RestructureTrend,
 	}, nil
 }
 
 // Exec is method.
+// MaxConcurrency件ずつの銘柄をfetch, compute, writeのpipelineで並行に処理する
+// Checkpointで完了済みの銘柄は計算しない
 func (c CalcMovingTrend) Exec() error {
-	// 複数Codeごとに処理する
-	// 同時に処理する最大件数はMaxConcurrencyで与えられる
-
-	log.Printf("calcForEachCode from-to: %s-%s", c.FromDate, c.ToDate)
-
-	var targetCodes []string
-	for _, code := range c.Codes {
-		targetCodes = append(targetCodes, code)
-		// MaxConcurrencyに達したら一旦処理
-		if len(targetCodes) == c.MaxConcurrency {
-			if err := c.calcForEachCode(targetCodes); err != nil {
-				return fmt.Errorf("failed to calcForEachCode: %v", err)
-			}
-			targetCodes = nil // 初期化
-		}
+	codes, err := c.Checkpoint.unfinished(c.Codes)
+	if err != nil {
+		return fmt.Errorf("failed to fetch checkpoint: %v", err)
+	}
+	if len(codes) == 0 {
+		log.Println("all codes are already calculated")
+		return nil
 	}
-	// MaxConcurrencyに達しなかった残りを処理
-	if len(targetCodes) > 0 {
-		if err := c.calcForEachCode(targetCodes); err != nil {
-			return fmt.Errorf("failed to calcForEachCode: %v", err)
+	c.Codes = codes
+	return c.execPipeline(context.Background())
+}
+
+func (c CalcMovingTrend) prepare() error {
+	log.Printf("calcForEachCode from-to: %s-%s, trend params version: %s", c.FromDate, c.ToDate, c.TrendParams.version())
+
+	// trendの各行に書き込むversionがどのパラメータかわかるようにしておく
+	if c.TrendParamsTable != "" {
+		params := []TrendParams{c.TrendParams}
+		for _, p := range c.ComparisonTrendParams {
+			params = append(params, p)
+		}
+		if err := writeTrendParams(c.DB, c.TrendParamsTable, params...); err != nil {
+			return fmt.Errorf("failed to writeTrendParams: %v", err)
 		}
 	}
 	return nil
 }
 
-func (c CalcMovingTrend) calcForEachCode(targetCodes []string) error {
-	start := time.Now()
-	defer func() {
-		// TODO： codeや期間をログに残す？
-		log.Printf("calcForEachCode duration: %v, target codes num: %d", time.Since(start), len(targetCodes))
-	}()
+// 同時に処理する最大件数(MaxConcurrency)ごとに銘柄を分ける
+func (c CalcMovingTrend) batches() [][]string {
+	var batches [][]string
+	for start := 0; start < len(c.Codes); start += c.MaxConcurrency {
+		end := start + c.MaxConcurrency
+		if end > len(c.Codes) {
+			end = len(c.Codes)
+		}
+		batches = append(batches, c.Codes[start:end])
+	}
+	return batches
+}
+
+// 1batch分の計算結果
+type calcResult struct {
+	targetCodes      []string
+	codeDateCloses   map[string][]DateClose
+	movingAvgs       map[string][]DateMovingAvgs
+	trends           map[string][]DateTrendList
+	comparisonTrends map[string]map[string][]DateTrendList // table名と比較用のtrendのMap
+	volatilities     map[string][]DateVolatility
+	volumes          map[string][]DateVolume
+	crossovers       map[string][]CrossoverEvent
+	highLows         map[string][]DateHighLow
+	patterns         map[string][]candlestick.DatePatterns
+}
 
-	codeDateCloses, err := c.fetchCodesDateCloses(targetCodes)
-	if err != nil {
-		return fmt.Errorf("failed to fetchCodesDateCloses: %v", err)
+// obvSeedsはfetchOBVSeedsで取得した銘柄ごとのOBVの起点
+func (c CalcMovingTrend) compute(targetCodes []string, codeDateBars map[string][]DateBar, obvSeeds map[string]float64) (calcResult, error) {
+	r := calcResult{targetCodes: targetCodes}
+	if c.PatternsTable != "" {
+		// FromDateより前のデータがあればFromDateのパターン検出に前日の足を使う
+		r.patterns = calculateCodeDatePatterns(codeDateBars, c.FromDate)
 	}
-	cdms := calculateCodeDateMovingAvgs(codeDateCloses)
-	cdts := calculateCodeDateTrend(codeDateCloses, cdms, c.LongTermThresholdDays)
+	if c.HighLowTable != "" {
+		// 高値、安値はFromDateより前のデータも使って計算し、それ以外はFromDate以降のデータだけで計算する
+		cdhs, err := calculateCodeDateHighLows(codeDateBars, c.HighLowWeeks, c.FromDate)
+		if err != nil {
+			return calcResult{}, fmt.Errorf("failed to calculateCodeDateHighLows: %v", err)
+		}
+		r.highLows = cdhs
+		filtered := make(map[string][]DateBar, len(codeDateBars))
+		for code, dateBars := range codeDateBars {
+			filtered[code] = filterDateBarsFrom(dateBars, c.FromDate)
+		}
+		codeDateBars = filtered
+	}
+	r.codeDateCloses = make(map[string][]DateClose, len(codeDateBars))
+	for code, dateBars := range codeDateBars {
+		r.codeDateCloses[code] = DateBars(dateBars).dateCloses()
+	}
+	r.movingAvgs = calculateCodeDateMovingAvgs(r.codeDateCloses)
+	r.trends = calculateCodeDateTrend(c.TrendClassifier, c.TrendParams, codeDateBars, r.movingAvgs)
+
+	// 比較用に別のTrendClassifierでtrendを計算する
+	r.comparisonTrends = make(map[string]map[string][]DateTrendList, len(c.ComparisonTrendClassifiers))
+	for table, classifier := range c.ComparisonTrendClassifiers {
+		r.comparisonTrends[table] = calculateCodeDateTrend(classifier, c.ComparisonTrendParams[table], codeDateBars, r.movingAvgs)
+	}
+
+	if c.VolatilityTable != "" {
+		r.volatilities = calculateCodeDateVolatilities(codeDateBars)
+	}
+	if c.VolumeTable != "" {
+		r.volumes = calculateCodeDateVolumes(codeDateBars, obvSeeds)
+	}
+	if c.CrossoverTable != "" {
+		cces, err := calculateCodeCrossoverEvents(r.codeDateCloses, c.MovingAvgPairs)
+		if err != nil {
+			return calcResult{}, fmt.Errorf("failed to calculateCodeCrossoverEvents: %v", err)
+		}
+		r.crossovers = cces
+	}
+	return r, nil
+}
 
-	if err := c.writeMovingAndTrend(codeDateCloses, cdms, cdts); err != nil {
+func (c CalcMovingTrend) write(r calcResult) error {
+	targetCodes := r.targetCodes
+	if err := c.writeMovingAndTrend(r.codeDateCloses, r.movingAvgs, r.trends); err != nil {
 		return fmt.Errorf("failed to writeMovingAndTrend: %v", err)
 	}
 	log.Printf("write moving and trend successfully, code: %v", targetCodes)
+
+	for table, cdts := range r.comparisonTrends {
+		trendData := CodeDateTrendLists(cdts).makeTrendDataForDB(c.ComparisonTrendParams[table].version())
+		if err := c.DB.InsertOrUpdateDB(table, trendData); err != nil {
+			return fmt.Errorf("failed to insert comparison trend to %s: %v", table, err)
+		}
+		log.Printf("write comparison trend to %s successfully, code: %v", table, targetCodes)
+	}
+
+	if c.VolatilityTable != "" {
+		if err := c.writeVolatility(r.volatilities); err != nil {
+			return fmt.Errorf("failed to writeVolatility: %v", err)
+		}
+		log.Printf("write volatility successfully, code: %v", targetCodes)
+	}
+
+	if c.VolumeTable != "" {
+		if err := c.writeVolume(r.volumes); err != nil {
+			return fmt.Errorf("failed to writeVolume: %v", err)
+		}
+		log.Printf("write volume successfully, code: %v", targetCodes)
+	}
+
+	if c.CrossoverTable != "" {
+		if err := c.writeCrossover(r.crossovers); err != nil {
+			return fmt.Errorf("failed to writeCrossover: %v", err)
+		}
+		log.Printf("write crossover successfully, code: %v", targetCodes)
+	}
+
+	if c.HighLowTable != "" {
+		if err := c.DB.InsertOrUpdateDB(c.HighLowTable, CodeDateHighLows(r.highLows).Slices()); err != nil {
+			return fmt.Errorf("failed to insert highlow: %v", err)
+		}
+		log.Printf("write highlow successfully, code: %v", targetCodes)
+	}
+
+	if c.PatternsTable != "" {
+		if err := c.writePatterns(r.patterns); err != nil {
+			return fmt.Errorf("failed to writePatterns: %v", err)
+		}
+		log.Printf("write patterns successfully, code: %v", targetCodes)
+	}
+
+	// 全tableに書き込めた銘柄を完了として記録する
+	if err := c.Checkpoint.mark(targetCodes); err != nil {
+		return fmt.Errorf("failed to mark checkpoint: %v", err)
+	}
 	return nil
 }
 
-func (c CalcMovingTrend) fetchCodesDateCloses(targetCodes []string) (map[string][]DateClose, error) {
+func (c CalcMovingTrend) fetchCodesDateBars(targetCodes []string) (map[string][]DateBar, error) {
 	fromDate := ""
 	if c.FromDate != "" {
-		fromDate = fmt.Sprintf("AND date >= '%s'", c.FromDate)
+		from := c.FromDate
+		if c.HighLowTable != "" { // FromDateの時点で期間内の高値、安値がとれるように遡る
+			t, err := time.Parse("2006/01/02", c.FromDate)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse date: %s, %v", c.FromDate, err)
+			}
+			// 期間の初日が休日でもそれ以前の足がとれるように1週間多く遡る
+			from = t.AddDate(0, 0, -(c.HighLowWeeks+1)*7).Format("2006/01/02")
+		}
+		fromDate = fmt.Sprintf("AND date >= '%s'", from)
 	}
 	toDate := ""
 	if c.ToDate != "" {
 		toDate = fmt.Sprintf("AND date <= '%s'", c.ToDate)
 	}
-	return fetchCodesDateCloses(c.DB, c.DailyTable, targetCodes, fromDate, toDate, "")
+	return fetchCodesDateBars(c.DB, c.DailyTable, targetCodes, fromDate, toDate, "")
+}
+
+// OBVは期間の最も古い日から累積するので、格納済みのその日のOBVを起点にする
+// その日のOBVがなければ、直前の営業日の格納済みのOBVにその日の売買高を足し引きして起点にする
+// どちらもなければ、途中の日が抜けたOBVに累積しないように0から累積する
+func (c CalcMovingTrend) fetchOBVSeeds(targetCodes []string, codeDateBars map[string][]DateBar) (map[string]float64, error) {
+	if c.VolumeTable == "" {
+		return nil, nil
+	}
+	// 銘柄ごとの計算期間の最も古い日の足
+	oldest := make(map[string]DateBar, len(codeDateBars))
+	to := ""
+	for code, dateBars := range codeDateBars {
+		bars := filterDateBarsFrom(dateBars, c.FromDate)
+		if len(bars) == 0 {
+			continue
+		}
+		oldest[code] = bars[len(bars)-1]
+		if oldest[code].Date > to {
+			to = oldest[code].Date
+		}
+	}
+	if len(oldest) == 0 {
+		return nil, nil
+	}
+	t, err := time.Parse("2006/01/02", c.FromDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse date: %s, %v", c.FromDate, err)
+	}
+	from := t.AddDate(0, -1, 0).Format("2006/01/02")
+
+	q := fmt.Sprintf("SELECT code, date, obv FROM %s WHERE code in (%s) AND date >= '%s' AND date <= '%s' ORDER BY code, date DESC;",
+		c.VolumeTable, joinCodeForWhereInStatement(targetCodes), from, to)
+	res, err := c.DB.SelectDB(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to selectTable %v", err)
+	}
+	// 銘柄ごと、日付ごとの格納済みのOBV
+	stored := make(map[string]map[string]float64, len(oldest))
+	for _, r := range res {
+		code, date := r[0], r[1]
+		obv, err := strconv.ParseFloat(r[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse obv: %v", err)
+		}
+		if _, ok := stored[code]; !ok {
+			stored[code] = make(map[string]float64)
+		}
+		stored[code][date] = obv
+	}
+
+	seeds := make(map[string]float64, len(oldest))
+	var rest []string // 最も古い日のOBVが格納されていない銘柄
+	for code, bar := range oldest {
+		if obv, ok := stored[code][bar.Date]; ok {
+			seeds[code] = obv
+			continue
+		}
+		if len(stored[code]) > 0 {
+			rest = append(rest, code)
+		}
+	}
+	if len(rest) == 0 {
+		return seeds, nil
+	}
+
+	// 直前の営業日はdailyのデータで決める
+	sort.Strings(rest)
+	prevDateBars, err := selectCodesDateBars(c.DB, c.DailyTable, rest, fmt.Sprintf("AND date >= '%s'", from), fmt.Sprintf("AND date <= '%s'", to), "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to selectCodesDateBars: %v", err)
+	}
+	for _, code := range rest {
+		for _, prev := range prevDateBars[code] { // 日付の降順
+			if prev.Date >= oldest[code].Date {
+				continue
+			}
+			if obv, ok := stored[code][prev.Date]; ok {
+				seeds[code] = nextOBV(obv, prev, oldest[code])
+			}
+			break
+		}
+	}
+	return seeds, nil
 }
 
 func (c CalcMovingTrend) writeMovingAndTrend(cdcs map[string][]DateClose, cdms map[string][]DateMovingAvgs, cdts map[string][]DateTrendList) error {
@@ -176,13 +455,40 @@ func (c CalcMovingTrend) writeMovingAndTrend(cdcs map[string][]DateClose, cdms m
 		return fmt.Errorf("failed to insert movingavg: %v", err)
 	}
 
-	trendData := CodeDateTrendLists(cdts).makeTrendDataForDB()
+	trendData := CodeDateTrendLists(cdts).makeTrendDataForDB(c.TrendParams.version())
 	if err := c.DB.InsertOrUpdateDB(c.TrendTable, trendData); err != nil {
 		return fmt.Errorf("failed to insert trend: %v", err)
 	}
 	return nil
 }
 
+func (c CalcMovingTrend) writeVolatility(cdvs map[string][]DateVolatility) error {
+	volatilityData := CodeDateVolatilities(cdvs).Slices()
+	if err := c.DB.InsertOrUpdateDB(c.VolatilityTable, volatilityData); err != nil {
+		return fmt.Errorf("failed to insert volatility: %v", err)
+	}
+	return nil
+}
+
+func (c CalcMovingTrend) writeVolume(cdvs map[string][]DateVolume) error {
+	volumeData := CodeDateVolumes(cdvs).Slices()
+	if err := c.DB.InsertOrUpdateDB(c.VolumeTable, volumeData); err != nil {
+		return fmt.Errorf("failed to insert volume: %v", err)
+	}
+	return nil
+}
+
+func (c CalcMovingTrend) writeCrossover(cces map[string][]CrossoverEvent) error {
+	crossoverData := CodeCrossoverEvents(cces).Slices()
+	if len(crossoverData) == 0 { // 期間内にcrossoverがなければ書き込まない
+		return nil
+	}
+	if err := c.DB.InsertOrUpdateDB(c.CrossoverTable, crossoverData); err != nil {
+		return fmt.Errorf("failed to insert crossover: %v", err)
+	}
+	return nil
+}
+
 func calculateCodeDateMovingAvgs(codeDateCloses map[string][]DateClose) map[string][]DateMovingAvgs {
 	cdms := make(map[string][]DateMovingAvgs, len(codeDateCloses))
 	for code, dateCloses := range codeDateCloses {
@@ -227,17 +533,19 @@ func calculateMovingAvg(dateCloses []DateClose) []DateMovingAvgs {
 	return dateMovingAvgs
 }
 
-func calculateCodeDateTrend(codeDateCloses map[string][]DateClose, codeDateMovingAvgs map[string][]DateMovingAvgs, longTermThresholdDays int) map[string][]DateTrendList {
-	cdts := make(map[string][]DateTrendList, len(codeDateCloses))
-	for code, dateCloses := range codeDateCloses {
-		dt := calculateTrend(dateCloses, codeDateMovingAvgs[code], longTermThresholdDays)
+func calculateCodeDateTrend(classifier TrendClassifier, params TrendParams, codeDateBars map[string][]DateBar, codeDateMovingAvgs map[string][]DateMovingAvgs) map[string][]DateTrendList {
+	cdts := make(map[string][]DateTrendList, len(codeDateBars))
+	for code, dateBars := range codeDateBars {
+		dt := calculateTrend(classifier, params, dateBars, codeDateMovingAvgs[code])
 		cdts[code] = dt
 	}
 
 	return cdts
 }
 
-func calculateTrend(dateCloses []DateClose, dateMovingAvgs []DateMovingAvgs, longTermThresholdDays int) []DateTrendList {
+// dateBarsとdateMovingAvgsは同じ日付の降順で与えられる
+func calculateTrend(classifier TrendClassifier, params TrendParams, dateBars []DateBar, dateMovingAvgs []DateMovingAvgs) []DateTrendList {
+	dateCloses := DateBars(dateBars).dateCloses()
 	dateTrendLists := make([]DateTrendList, 0, len(dateCloses))
 	pastTrends := []Trend{}
 
@@ -253,10 +561,10 @@ func calculateTrend(dateCloses []DateClose, dateMovingAvgs []DateMovingAvgs, lon
 			M100: ms.M100,
 		}
 
-		closes := extractCloses(date, dateCloses)
+		closes := extractCloses(date, dateCloses, params.MaxContinuationDays)
 
-		reversedPastTrends := makeReversePastTrends(pastTrends, longTermThresholdDays)
-		latestTrendList := calculateTrendList(closes, tm, reversedPastTrends, longTermThresholdDays)
+		reversedPastTrends := makeReversePastTrends(pastTrends, params.LongTermThresholdDays)
+		latestTrendList := calculateTrendList(classifier, closes, tm, dateBars[i:], reversedPastTrends, params)
 
 		dateTrendLists = append(dateTrendLists, DateTrendList{date: date, trendList: latestTrendList})
 
@@ -271,7 +579,7 @@ func calculateTrend(dateCloses []DateClose, dateMovingAvgs []DateMovingAvgs, lon
 	return dateTrendLists
 }
 
-func extractCloses(date string, dateCloses []DateClose) []float64 {
+func extractCloses(date string, dateCloses []DateClose, maxContinuationDays int) []float64 {
 	var closes []float64
 	for _, dateClose := range dateCloses {
 		if date < dateClose.Date {
@@ -297,3 +605,14 @@ func makeReversePastTrends(pastTrends []Trend, longTermThresholdDays int) []Tren
 	}
 	return tmpTrends
 }
+
+func (c CalcMovingTrend) writePatterns(cdps map[string][]candlestick.DatePatterns) error {
+	patternData := CodeDatePatterns(cdps).Slices()
+	if len(patternData) == 0 { // 期間内にpatternがなければ書き込まない
+		return nil
+	}
+	if err := c.DB.InsertOrUpdateDB(c.PatternsTable, patternData); err != nil {
+		return fmt.Errorf("failed to insert patterns: %v", err)
+	}
+	return nil
+}
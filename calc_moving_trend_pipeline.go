@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// CalcMovingTrendのfetch(DB), compute(CPU), write(DB)をstageに分けて並行に処理する
+// stage間のchannelのbufferを超えると前のstageが待つので、fetchしたデータがメモリに溜まりすぎない
+
+const defaultPipelineWorkers = 2
+
+// fetchしたbatch
+type fetchedBatch struct {
+	targetCodes  []string
+	codeDateBars map[string][]DateBar
+	obvSeeds     map[string]float64
+}
+
+func (c CalcMovingTrend) execPipeline(ctx context.Context) error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+	batches := c.batches()
+	progress := newCalcProgress(len(c.Codes))
+
+	eg, ctx := errgroup.WithContext(ctx)
+	batchCh := make(chan []string)
+	fetchedCh := make(chan fetchedBatch, c.PipelineWorkers)
+	computedCh := make(chan calcResult, c.PipelineWorkers)
+
+	eg.Go(func() error {
+		defer close(batchCh)
+		for _, b := range batches {
+			select {
+			case batchCh <- b:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	// fetch stage
+	startStage(eg, c.PipelineWorkers, func() error {
+		for targetCodes := range batchCh {
+			codeDateBars, err := c.fetchCodesDateBars(targetCodes)
+			if err != nil {
+				return fmt.Errorf("failed to fetchCodesDateBars: %v", err)
+			}
+			obvSeeds, err := c.fetchOBVSeeds(targetCodes, codeDateBars)
+			if err != nil {
+				return fmt.Errorf("failed to fetchOBVSeeds: %v", err)
+			}
+			select {
+			case fetchedCh <- fetchedBatch{targetCodes: targetCodes, codeDateBars: codeDateBars, obvSeeds: obvSeeds}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}, func() { close(fetchedCh) })
+
+	// compute stage
+	startStage(eg, runtime.NumCPU(), func() error {
+		for f := range fetchedCh {
+			r, err := c.compute(f.targetCodes, f.codeDateBars, f.obvSeeds)
+			if err != nil {
+				return fmt.Errorf("failed to compute: %v", err)
+			}
+			select {
+			case computedCh <- r:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}, func() { close(computedCh) })
+
+	// write stage
+	startStage(eg, c.PipelineWorkers, func() error {
+		for r := range computedCh {
+			// 他のstageが失敗したら、残りのbatchは書き込まずに終わる
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+			if err := c.write(r); err != nil {
+				return fmt.Errorf("failed to write: %v", err)
+			}
+			progress.add(len(r.targetCodes))
+		}
+		return nil
+	}, func() {})
+
+	return eg.Wait()
+}
+
+// workers個のgoroutineでworkを実行し、すべて終わったらdoneを呼ぶ
+// doneで次のstageへのchannelをcloseする
+func startStage(eg *errgroup.Group, workers int, work func() error, done func()) {
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		eg.Go(func() error {
+			defer wg.Done()
+			return work()
+		})
+	}
+	eg.Go(func() error {
+		wg.Wait()
+		done()
+		return nil
+	})
+}
+
+// 処理が終わった銘柄数と残り時間の目安をログに出す
+type calcProgress struct {
+	mu    sync.Mutex
+	total int
+	done  int
+	start time.Time
+}
+
+func newCalcProgress(total int) *calcProgress {
+	return &calcProgress{total: total, start: time.Now()}
+}
+
+func (p *calcProgress) add(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += n
+	elapsed := time.Since(p.start)
+	eta := time.Duration(float64(elapsed) / float64(p.done) * float64(p.total-p.done))
+	log.Printf("progress: %d/%d codes (%.1f%%), elapsed: %v, eta: %v",
+		p.done, p.total, float64(p.done)/float64(p.total)*100, elapsed.Round(time.Millisecond), eta.Round(time.Millisecond))
+}
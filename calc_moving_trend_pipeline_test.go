@@ -0,0 +1,430 @@
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// CalcMovingTrendがdaily tableを読んで各tableに書き込むだけのfake database.DB
+// latencyでDBへのアクセスにかかる時間を模擬する
+type fakeDB struct {
+	mu        sync.Mutex
+	latency   time.Duration
+	daily     map[string][][]string // codeごとに日付の降順
+	tables    map[string][][]string
+	failTable string // このtableへの書き込みはエラーにする
+}
+
+func newFakeDB(codes []string, days int, latency time.Duration) *fakeDB {
+	daily := make(map[string][][]string, len(codes))
+	start, _ := time.Parse("2006/01/02", "2020/01/06")
+	for i, code := range codes {
+		var rows [][]string
+		price := 1000.0
+		for d := 0; d < days; d++ {
+			// 銘柄ごとに周期の違う上下動をつける
+			if (d/(5+i%7))%2 == 0 {
+				price += float64(1 + i%3)
+			} else {
+				price -= float64(1 + i%2)
+			}
+			date := start.AddDate(0, 0, d).Format("2006/01/02")
+			p := fmt.Sprintf("%g", price)
+			rows = append([][]string{{code, date, p, fmt.Sprintf("%g", price+5), fmt.Sprintf("%g", price-5), p, fmt.Sprintf("%d", 1000+d*10)}}, rows...)
+		}
+		daily[code] = rows
+	}
+	return &fakeDB{latency: latency, daily: daily, tables: make(map[string][][]string)}
+}
+
+var (
+	codeInRe   = regexp.MustCompile(`code in \(([^)]*)\)`)
+	fromDateRe = regexp.MustCompile(`date >= '([^']*)'`)
+	toDateRe   = regexp.MustCompile(`date <= '([^']*)'`)
+
+	checkpointRe = regexp.MustCompile(`FROM checkpoint WHERE run_date = '([^']*)' AND step = '([^']*)'`)
+	obvRe        = regexp.MustCompile(`SELECT code, date, obv FROM (\w+)`)
+)
+
+func (f *fakeDB) ShowDatabases() (string, error) { return "", nil }
+
+func (f *fakeDB) InsertDB(table string, records [][]string) error {
+	return f.InsertOrUpdateDB(table, records)
+}
+
+func (f *fakeDB) InsertOrUpdateDB(table string, records [][]string) error {
+	time.Sleep(f.latency)
+	if table == f.failTable {
+		return errors.New("failed to insert")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tables[table] = append(f.tables[table], records...)
+	return nil
+}
+
+func (f *fakeDB) SelectDB(q string) ([][]string, error) {
+	time.Sleep(f.latency)
+	if m := checkpointRe.FindStringSubmatch(q); m != nil {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var res [][]string
+		for _, r := range f.tables[checkpointTable] {
+			if r[0] == m[1] && r[1] == m[2] {
+				res = append(res, []string{r[2]})
+			}
+		}
+		return res, nil
+	}
+	m := codeInRe.FindStringSubmatch(q)
+	if m == nil {
+		return nil, fmt.Errorf("unsupported query: %s", q)
+	}
+	codes := strings.Split(strings.Replace(m[1], "'", "", -1), ",")
+	sort.Strings(codes)
+	from, to := "", "9999/99/99"
+	if m := fromDateRe.FindStringSubmatch(q); m != nil {
+		from = m[1]
+	}
+	if m := toDateRe.FindStringSubmatch(q); m != nil {
+		to = m[1]
+	}
+	if m := obvRe.FindStringSubmatch(q); m != nil {
+		return f.selectOBV(m[1], codes, from, to), nil
+	}
+	var res [][]string
+	for _, code := range codes {
+		for _, r := range f.daily[code] {
+			if r[1] >= from && r[1] <= to {
+				res = append(res, r)
+			}
+		}
+	}
+	return res, nil
+}
+
+// 書き込まれたvolumeのcode, date, obvを銘柄ごとに日付の降順で返す
+func (f *fakeDB) selectOBV(table string, codes []string, from, to string) [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res [][]string
+	for _, code := range codes {
+		var rows [][]string
+		for _, r := range f.tables[table] {
+			if r[0] == code && r[1] >= from && r[1] <= to {
+				rows = append(rows, []string{r[0], r[1], r[4]})
+			}
+		}
+		sort.Slice(rows, func(i, j int) bool { return rows[i][1] > rows[j][1] })
+		res = append(res, rows...)
+	}
+	return res
+}
+
+func (f *fakeDB) DeleteFromDB(table string, codes []string) error { return nil }
+
+func (f *fakeDB) CloseDB() error { return nil }
+
+// 書き込まれた順番によらず比較できるようにソートする
+func (f *fakeDB) sortedTables() map[string][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tables := make(map[string][]string, len(f.tables))
+	for table, rows := range f.tables {
+		var ss []string
+		for _, r := range rows {
+			ss = append(ss, strings.Join(r, ","))
+		}
+		sort.Strings(ss)
+		tables[table] = ss
+	}
+	return tables
+}
+
+func makeCodes(n int) []string {
+	codes := make([]string, n)
+	for i := range codes {
+		codes[i] = fmt.Sprintf("%d", 1001+i)
+	}
+	return codes
+}
+
+func newFakeCalcMovingTrend(t testing.TB, db *fakeDB, codes []string) *CalcMovingTrend {
+	c, err := NewCalcMovingTrend(CalcMovingTrendConfig{
+		DB:               db,
+		DailyTable:       "daily",
+		MovingAvgTable:   "movingavg",
+		TrendTable:       "trend",
+		VolatilityTable:  "volatility",
+		VolumeTable:      "volume",
+		CrossoverTable:   "crossover_events",
+		TrendParamsTable: "trend_params",
+		Codes:            codes,
+		FromDate:         "2020/01/01",
+		ToDate:           "2020/12/31",
+		MaxConcurrency:   3,
+		PipelineWorkers:  2,
+	})
+	if err != nil {
+		t.Fatalf("failed to NewCalcMovingTrend: %v", err)
+	}
+	return c
+}
+
+func TestCalcMovingTrendPipeline(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	codes := makeCodes(10)
+
+	// fetch, writeを1つずつ行った結果と比べる
+	sequentialDB := newFakeDB(codes, 150, 0)
+	sequential := newFakeCalcMovingTrend(t, sequentialDB, codes)
+	sequential.PipelineWorkers = 1
+	if err := sequential.Exec(); err != nil {
+		t.Fatalf("failed to Exec with 1 worker: %v", err)
+	}
+	pipelineDB := newFakeDB(codes, 150, 0)
+	if err := newFakeCalcMovingTrend(t, pipelineDB, codes).Exec(); err != nil {
+		t.Fatalf("failed to Exec: %v", err)
+	}
+
+	want := sequentialDB.sortedTables()
+	got := pipelineDB.sortedTables()
+	for _, table := range []string{"movingavg", "trend", "volatility", "volume", "crossover_events", "trend_params"} {
+		if len(want[table]) == 0 {
+			t.Errorf("%s has no rows", table)
+		}
+		if !reflect.DeepEqual(got[table], want[table]) {
+			t.Errorf("%s got %d rows, want %d rows", table, len(got[table]), len(want[table]))
+		}
+	}
+}
+
+func TestCalcMovingTrendPipelineError(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	codes := makeCodes(20)
+	db := newFakeDB(codes, 150, 0)
+	db.failTable = "volume"
+	err := newFakeCalcMovingTrend(t, db, codes).Exec()
+	if err == nil || !strings.Contains(err.Error(), "failed to writeVolume") {
+		t.Errorf("got error: %v, want writeVolume error", err)
+	}
+}
+
+func TestCalcMovingTrendPipelineCanceled(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	codes := makeCodes(10)
+	db := newFakeDB(codes, 150, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// 止められたあとはbatchを書き込まない
+	if err := newFakeCalcMovingTrend(t, db, codes).execPipeline(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error: %v, want context.Canceled", err)
+	}
+	for _, table := range []string{"movingavg", "trend", "volatility", "volume", "crossover_events"} {
+		if n := len(db.tables[table]); n != 0 {
+			t.Errorf("%s has %d rows, want 0", table, n)
+		}
+	}
+}
+
+func TestCalcMovingTrendCheckpoint(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	codes := makeCodes(10)
+	db := newFakeDB(codes, 150, 0)
+	runTime := time.Date(2020, 6, 1, 18, 0, 0, 0, time.UTC)
+	// 前回の実行で先頭の6銘柄は完了済み。別の日、別のstepの記録は関係ない
+	if err := NewCheckpoint(db, runTime, "calc").mark(codes[:6]); err != nil {
+		t.Fatalf("failed to mark: %v", err)
+	}
+	if err := NewCheckpoint(db, runTime.AddDate(0, 0, -1), "calc").mark(codes[6:]); err != nil {
+		t.Fatalf("failed to mark: %v", err)
+	}
+	if err := NewCheckpoint(db, runTime, "other").mark(codes[6:]); err != nil {
+		t.Fatalf("failed to mark: %v", err)
+	}
+
+	c := newFakeCalcMovingTrend(t, db, codes)
+	c.Checkpoint = NewCheckpoint(db, runTime, "calc")
+	if err := c.Exec(); err != nil {
+		t.Fatalf("failed to Exec: %v", err)
+	}
+	trendCodes := make(map[string]bool)
+	for _, r := range db.tables["trend"] {
+		trendCodes[r[0]] = true
+	}
+	for i, code := range codes {
+		if want := i >= 6; trendCodes[code] != want {
+			t.Errorf("code %s is calculated: %t, want: %t", code, trendCodes[code], want)
+		}
+	}
+	rest, err := c.Checkpoint.unfinished(codes)
+	if err != nil {
+		t.Fatalf("failed to unfinished: %v", err)
+	}
+	if len(rest) != 0 {
+		t.Errorf("unfinished codes: %v", rest)
+	}
+
+	// 全銘柄が完了済みなら何も書き込まない
+	db.tables = map[string][][]string{checkpointTable: db.tables[checkpointTable]}
+	if err := c.Exec(); err != nil {
+		t.Fatalf("failed to Exec: %v", err)
+	}
+	if len(db.tables) != 1 {
+		t.Errorf("got tables: %d, want only checkpoint", len(db.tables))
+	}
+}
+
+func TestTargetCheckpoint(t *testing.T) {
+	codes := makeCodes(3)
+	db := newFakeDB(codes, 0, 0)
+	runTime := time.Date(2020, 6, 1, 18, 0, 0, 0, time.UTC)
+	if err := NewTargetCheckpoint(db, runTime, "calc", "2020/06/01").mark(codes); err != nil {
+		t.Fatalf("failed to mark: %v", err)
+	}
+
+	tests := map[string]struct {
+		cp   *Checkpoint
+		want []string
+	}{
+		"same_target": {
+			cp:   NewTargetCheckpoint(db, runTime, "calc", "2020/06/01"),
+			want: nil,
+		},
+		// 同じ日に対象日を変えて再実行した場合は全銘柄を計算し直す
+		"other_target": {
+			cp:   NewTargetCheckpoint(db, runTime, "calc", "2020/05/29"),
+			want: codes,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.cp.unfinished(codes)
+			if err != nil {
+				t.Fatalf("failed to unfinished: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCalcMovingTrendOBV(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	codes := makeCodes(5)
+	db := newFakeDB(codes, 150, 0)
+	obvs := func() map[string]string {
+		m := make(map[string]string)
+		for _, r := range db.tables["volume"] {
+			m[r[0]+","+r[1]] = r[4]
+		}
+		return m
+	}
+
+	// 期間をずらして2回計算しても、重なる日のOBVは変わらない
+	c := newFakeCalcMovingTrend(t, db, codes)
+	c.FromDate, c.ToDate = "2020/01/01", "2020/04/30"
+	if err := c.Exec(); err != nil {
+		t.Fatalf("failed to Exec: %v", err)
+	}
+	first := obvs()
+
+	c.FromDate, c.ToDate = "2020/03/01", "2020/05/31"
+	if err := c.Exec(); err != nil {
+		t.Fatalf("failed to Exec: %v", err)
+	}
+	overlap := 0
+	for k, v := range obvs() { // 後から書き込んだ2回目の値
+		if w, ok := first[k]; ok {
+			overlap++
+			if v != w {
+				t.Errorf("%s got obv: %s, want: %s", k, v, w)
+			}
+		}
+	}
+	if overlap == 0 {
+		t.Error("no overlapping dates")
+	}
+}
+
+func TestFetchOBVSeeds(t *testing.T) {
+	codes := makeCodes(4)
+	db := newFakeDB(codes, 20, 0)
+	// volumeの4列目がobv
+	db.tables["volume"] = [][]string{
+		{"1001", "2020/01/15", "", "", "500"}, // 期間の最も古い日
+		{"1001", "2020/01/14", "", "", "100"},
+		{"1002", "2020/01/14", "", "", "300"}, // 直前の営業日
+		{"1003", "2020/01/13", "", "", "200"}, // 直前の営業日より前
+	}
+	c := newFakeCalcMovingTrend(t, db, codes)
+	c.FromDate = "2020/01/15"
+	codeDateBars, err := c.fetchCodesDateBars(codes)
+	if err != nil {
+		t.Fatalf("failed to fetchCodesDateBars: %v", err)
+	}
+	got, err := c.fetchOBVSeeds(codes, codeDateBars)
+	if err != nil {
+		t.Fatalf("failed to fetchOBVSeeds: %v", err)
+	}
+	want := map[string]float64{
+		"1001": 500,
+		"1002": 300 - 1090, // 1002の終値は01/14から01/15に下がっていて、01/15の売買高は1090
+		// 1003は途中の日が抜けたOBVに累積しないように0から累積する
+		// 1004は格納済みのOBVがない
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func benchmarkCalcMovingTrend(b *testing.B, exec func(c *CalcMovingTrend) error) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	codes := makeCodes(60)
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		db := newFakeDB(codes, 200, 2*time.Millisecond)
+		c := newFakeCalcMovingTrend(b, db, codes)
+		b.StartTimer()
+		if err := exec(c); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCalcMovingTrendSingleWorker(b *testing.B) {
+	benchmarkCalcMovingTrend(b, func(c *CalcMovingTrend) error {
+		c.PipelineWorkers = 1
+		return c.Exec()
+	})
+}
+
+func BenchmarkCalcMovingTrendPipeline(b *testing.B) {
+	benchmarkCalcMovingTrend(b, func(c *CalcMovingTrend) error { return c.Exec() })
+}
@@ -67,16 +67,16 @@ func TestCalcMovingTrend(t *testing.T) {
 					{"1001", "2019/10/04", "11", "11", "11", "11", "11", "11", "11"},
 				},
 				wantsTrends: [][]string{
-					{"1001", "2019/10/18", "3", "2", "1.053", "2", "9"},
-					{"1001", "2019/10/17", "3", "2", "1.056", "2", "8"},
-					{"1001", "2019/10/16", "3", "2", "1.059", "2", "7"},
-					{"1001", "2019/10/15", "3", "2", "1.062", "2", "6"},
-					{"1001", "2019/10/11", "3", "2", "1.067", "2", "5"},
-					{"1001", "2019/10/10", "3", "2", "1.071", "2", "4"},
-					{"1001", "2019/10/09", "3", "2", "1.077", "2", "3"},
-					{"1001", "2019/10/08", "3", "2", "1.083", "2", "2"},
-					{"1001", "2019/10/07", "3", "2", "1.091", "3", "1"},
-					{"1001", "2019/10/04", "3", "0", "0", "2", "0"},
+					{"1001", "2019/10/18", "3", "2", "1.053", "2", "9", "5"},
+					{"1001", "2019/10/17", "3", "2", "1.056", "2", "8", "5"},
+					{"1001", "2019/10/16", "3", "2", "1.059", "2", "7", "5"},
+					{"1001", "2019/10/15", "3", "2", "1.062", "2", "6", "5"},
+					{"1001", "2019/10/11", "3", "2", "1.067", "2", "5", "5"},
+					{"1001", "2019/10/10", "3", "2", "1.071", "2", "4", "5"},
+					{"1001", "2019/10/09", "3", "2", "1.077", "2", "3", "5"},
+					{"1001", "2019/10/08", "3", "2", "1.083", "2", "2", "5"},
+					{"1001", "2019/10/07", "3", "2", "1.091", "3", "1", "6"},
+					{"1001", "2019/10/04", "3", "0", "0", "2", "0", "5"},
 				},
 			},
 			"1002_float": {
@@ -127,26 +127,26 @@ func TestCalcMovingTrend(t *testing.T) {
 					{"1002", "2019/09/20", "120.5", "120.5", "120.5", "120.5", "120.5", "120.5", "120.5"},
 				},
 				wantsTrends: [][]string{
-					{"1002", "2019/10/21", "3", "2", "0.9902", "2", "11"},
-					{"1002", "2019/10/18", "3", "2", "0.9903", "2", "11"},
-					{"1002", "2019/10/17", "3", "2", "0.9904", "2", "11"},
-					{"1002", "2019/10/16", "3", "2", "0.9905", "2", "11"},
-					{"1002", "2019/10/15", "3", "2", "0.9906", "2", "11"},
-					{"1002", "2019/10/11", "3", "2", "0.9907", "2", "11"},
-					{"1002", "2019/10/10", "3", "2", "0.9908", "2", "11"},
-					{"1002", "2019/10/09", "3", "2", "0.9909", "2", "11"},
-					{"1002", "2019/10/08", "3", "2", "0.991", "2", "11"},
-					{"1002", "2019/10/07", "3", "2", "0.991", "2", "10"},
-					{"1002", "2019/10/04", "3", "2", "0.9911", "2", "9"},
-					{"1002", "2019/10/03", "3", "2", "0.9912", "2", "8"},
-					{"1002", "2019/10/02", "3", "2", "0.9913", "2", "7"},
-					{"1002", "2019/10/01", "3", "2", "0.9913", "2", "6"},
-					{"1002", "2019/09/30", "3", "2", "0.9914", "2", "5"},
-					{"1002", "2019/09/27", "3", "2", "0.9915", "2", "4"},
-					{"1002", "2019/09/26", "3", "2", "0.9916", "2", "3"},
-					{"1002", "2019/09/25", "3", "2", "0.9916", "2", "2"},
-					{"1002", "2019/09/24", "3", "2", "0.9917", "1", "1"},
-					{"1002", "2019/09/20", "3", "0", "0", "2", "0"},
+					{"1002", "2019/10/21", "3", "2", "0.9902", "2", "11", "5"},
+					{"1002", "2019/10/18", "3", "2", "0.9903", "2", "11", "5"},
+					{"1002", "2019/10/17", "3", "2", "0.9904", "2", "11", "5"},
+					{"1002", "2019/10/16", "3", "2", "0.9905", "2", "11", "5"},
+					{"1002", "2019/10/15", "3", "2", "0.9906", "2", "11", "5"},
+					{"1002", "2019/10/11", "3", "2", "0.9907", "2", "11", "5"},
+					{"1002", "2019/10/10", "3", "2", "0.9908", "2", "11", "5"},
+					{"1002", "2019/10/09", "3", "2", "0.9909", "2", "11", "5"},
+					{"1002", "2019/10/08", "3", "2", "0.991", "2", "11", "5"},
+					{"1002", "2019/10/07", "3", "2", "0.991", "2", "10", "5"},
+					{"1002", "2019/10/04", "3", "2", "0.9911", "2", "9", "5"},
+					{"1002", "2019/10/03", "3", "2", "0.9912", "2", "8", "5"},
+					{"1002", "2019/10/02", "3", "2", "0.9913", "2", "7", "5"},
+					{"1002", "2019/10/01", "3", "2", "0.9913", "2", "6", "5"},
+					{"1002", "2019/09/30", "3", "2", "0.9914", "2", "5", "5"},
+					{"1002", "2019/09/27", "3", "2", "0.9915", "2", "4", "5"},
+					{"1002", "2019/09/26", "3", "2", "0.9916", "2", "3", "5"},
+					{"1002", "2019/09/25", "3", "2", "0.9916", "2", "2", "5"},
+					{"1002", "2019/09/24", "3", "2", "0.9917", "1", "1", "4"},
+					{"1002", "2019/09/20", "3", "0", "0", "2", "0", "5"},
 				},
 			},
 		}
@@ -210,9 +210,10 @@ func TestCalcMovingTrend(t *testing.T) {
 				if err != nil {
 					t.Error("failed to select trend", err)
 				}
-				if !reflect.DeepEqual(trends, tt.wantsTrends) {
-					diff := cmp.Diff(movings, tt.wantsTrends)
-					t.Errorf("trends got %#v\nwant %#v\n%v", trends, tt.wantsTrends, diff)
+				wantsTrends := withParamsVersion(tt.wantsTrends, defaultTrendParams.version())
+				if !reflect.DeepEqual(trends, wantsTrends) {
+					diff := cmp.Diff(movings, wantsTrends)
+					t.Errorf("trends got %#v\nwant %#v\n%v", trends, wantsTrends, diff)
 				}
 			})
 		}
@@ -285,54 +286,54 @@ func TestCalcMovingTrend(t *testing.T) {
 			{"1018", "2020/12/20", "999", "999.2", "999.3333333333334", "999.3333333333334", "999.3333333333334", "999.3333333333334", "999.3333333333334"},
 		}
 		wantTrend := [][]string{
-			{"1011", "2020/12/15", "3", "0", "0", "2", "0"},
-			{"1011", "2020/12/16", "3", "2", "1.001", "3", "1"},
-			{"1011", "2020/12/17", "3", "2", "1.001", "2", "2"},
-			{"1011", "2020/12/18", "3", "2", "1.001", "2", "3"},
-			{"1011", "2020/12/19", "3", "2", "1.001", "2", "4"},
-			{"1011", "2020/12/20", "3", "2", "1.001", "2", "5"},
-			{"1012", "2020/12/15", "3", "0", "0", "2", "0"},
-			{"1012", "2020/12/16", "3", "2", "0.999", "1", "1"},
-			{"1012", "2020/12/17", "3", "2", "0.999", "2", "2"},
-			{"1012", "2020/12/18", "3", "2", "0.999", "2", "3"},
-			{"1012", "2020/12/19", "3", "2", "0.999", "2", "4"},
-			{"1012", "2020/12/20", "3", "2", "0.999", "2", "5"},
-			{"1013", "2020/12/15", "3", "0", "0", "2", "0"},
-			{"1013", "2020/12/16", "3", "2", "1.001", "3", "1"},
-			{"1013", "2020/12/17", "3", "2", "1.001", "2", "2"},
-			{"1013", "2020/12/18", "3", "2", "0.999", "2", "1"},
-			{"1013", "2020/12/19", "3", "2", "0.999", "1", "2"},
-			{"1013", "2020/12/20", "3", "2", "0.999", "2", "3"},
-			{"1014", "2020/12/15", "3", "0", "0", "2", "0"},
-			{"1014", "2020/12/16", "3", "2", "0.999", "1", "1"},
-			{"1014", "2020/12/17", "3", "2", "0.999", "2", "2"},
-			{"1014", "2020/12/18", "3", "2", "1.001", "2", "1"},
-			{"1014", "2020/12/19", "3", "2", "1.001", "3", "2"},
-			{"1014", "2020/12/20", "3", "2", "1.001", "2", "3"},
-			{"1015", "2020/12/15", "3", "0", "0", "2", "0"},
-			{"1015", "2020/12/16", "3", "2", "1.001", "3", "1"},
-			{"1015", "2020/12/17", "3", "2", "1.001", "2", "2"},
-			{"1015", "2020/12/18", "3", "2", "1.001", "2", "3"},
-			{"1015", "2020/12/19", "3", "2", "0.999", "2", "1"},
-			{"1015", "2020/12/20", "3", "2", "0.999", "1", "2"},
-			{"1016", "2020/12/15", "3", "0", "0", "2", "0"},
-			{"1016", "2020/12/16", "3", "2", "1.001", "3", "1"},
-			{"1016", "2020/12/17", "3", "2", "0.999", "1", "1"},
-			{"1016", "2020/12/18", "3", "2", "0.999", "2", "2"},
-			{"1016", "2020/12/19", "3", "2", "1.001", "2", "1"},
-			{"1016", "2020/12/20", "3", "2", "1.001", "3", "2"},
-			{"1017", "2020/12/15", "3", "0", "0", "2", "0"},
-			{"1017", "2020/12/16", "3", "2", "1", "2", "0"},
-			{"1017", "2020/12/17", "3", "2", "1.001", "3", "1"},
-			{"1017", "2020/12/18", "3", "2", "1.001", "2", "2"},
-			{"1017", "2020/12/19", "3", "2", "0.999", "2", "1"},
-			{"1017", "2020/12/20", "3", "2", "0.999", "1", "2"},
-			{"1018", "2020/12/15", "3", "0", "0", "2", "0"},
-			{"1018", "2020/12/16", "3", "2", "1", "2", "0"},
-			{"1018", "2020/12/17", "3", "2", "0.999", "1", "1"},
-			{"1018", "2020/12/18", "3", "2", "0.999", "2", "2"},
-			{"1018", "2020/12/19", "3", "2", "1.001", "2", "1"},
-			{"1018", "2020/12/20", "3", "2", "1.001", "3", "2"},
+			{"1011", "2020/12/15", "3", "0", "0", "2", "0", "5"},
+			{"1011", "2020/12/16", "3", "2", "1.001", "3", "1", "6"},
+			{"1011", "2020/12/17", "3", "2", "1.001", "2", "2", "5"},
+			{"1011", "2020/12/18", "3", "2", "1.001", "2", "3", "5"},
+			{"1011", "2020/12/19", "3", "2", "1.001", "2", "4", "5"},
+			{"1011", "2020/12/20", "3", "2", "1.001", "2", "5", "5"},
+			{"1012", "2020/12/15", "3", "0", "0", "2", "0", "5"},
+			{"1012", "2020/12/16", "3", "2", "0.999", "1", "1", "4"},
+			{"1012", "2020/12/17", "3", "2", "0.999", "2", "2", "5"},
+			{"1012", "2020/12/18", "3", "2", "0.999", "2", "3", "5"},
+			{"1012", "2020/12/19", "3", "2", "0.999", "2", "4", "5"},
+			{"1012", "2020/12/20", "3", "2", "0.999", "2", "5", "5"},
+			{"1013", "2020/12/15", "3", "0", "0", "2", "0", "5"},
+			{"1013", "2020/12/16", "3", "2", "1.001", "3", "1", "6"},
+			{"1013", "2020/12/17", "3", "2", "1.001", "2", "2", "5"},
+			{"1013", "2020/12/18", "3", "2", "0.999", "2", "1", "5"},
+			{"1013", "2020/12/19", "3", "2", "0.999", "1", "2", "4"},
+			{"1013", "2020/12/20", "3", "2", "0.999", "2", "3", "5"},
+			{"1014", "2020/12/15", "3", "0", "0", "2", "0", "5"},
+			{"1014", "2020/12/16", "3", "2", "0.999", "1", "1", "4"},
+			{"1014", "2020/12/17", "3", "2", "0.999", "2", "2", "5"},
+			{"1014", "2020/12/18", "3", "2", "1.001", "2", "1", "5"},
+			{"1014", "2020/12/19", "3", "2", "1.001", "3", "2", "6"},
+			{"1014", "2020/12/20", "3", "2", "1.001", "2", "3", "5"},
+			{"1015", "2020/12/15", "3", "0", "0", "2", "0", "5"},
+			{"1015", "2020/12/16", "3", "2", "1.001", "3", "1", "6"},
+			{"1015", "2020/12/17", "3", "2", "1.001", "2", "2", "5"},
+			{"1015", "2020/12/18", "3", "2", "1.001", "2", "3", "5"},
+			{"1015", "2020/12/19", "3", "2", "0.999", "2", "1", "5"},
+			{"1015", "2020/12/20", "3", "2", "0.999", "1", "2", "4"},
+			{"1016", "2020/12/15", "3", "0", "0", "2", "0", "5"},
+			{"1016", "2020/12/16", "3", "2", "1.001", "3", "1", "6"},
+			{"1016", "2020/12/17", "3", "2", "0.999", "1", "1", "4"},
+			{"1016", "2020/12/18", "3", "2", "0.999", "2", "2", "5"},
+			{"1016", "2020/12/19", "3", "2", "1.001", "2", "1", "5"},
+			{"1016", "2020/12/20", "3", "2", "1.001", "3", "2", "6"},
+			{"1017", "2020/12/15", "3", "0", "0", "2", "0", "5"},
+			{"1017", "2020/12/16", "3", "2", "1", "2", "0", "5"},
+			{"1017", "2020/12/17", "3", "2", "1.001", "3", "1", "6"},
+			{"1017", "2020/12/18", "3", "2", "1.001", "2", "2", "5"},
+			{"1017", "2020/12/19", "3", "2", "0.999", "2", "1", "5"},
+			{"1017", "2020/12/20", "3", "2", "0.999", "1", "2", "4"},
+			{"1018", "2020/12/15", "3", "0", "0", "2", "0", "5"},
+			{"1018", "2020/12/16", "3", "2", "1", "2", "0", "5"},
+			{"1018", "2020/12/17", "3", "2", "0.999", "1", "1", "4"},
+			{"1018", "2020/12/18", "3", "2", "0.999", "2", "2", "5"},
+			{"1018", "2020/12/19", "3", "2", "1.001", "2", "1", "5"},
+			{"1018", "2020/12/20", "3", "2", "1.001", "3", "2", "6"},
 		}
 
 		var inputsDaily [][]string
@@ -459,8 +460,9 @@ func TestCalcMovingTrend(t *testing.T) {
 				if err != nil {
 					t.Error(err)
 				}
-				if !compare2dSlices(trend, tc.wanttrend) {
-					t.Errorf("got %#v, want %#v", trend, tc.wanttrend)
+				wanttrend := withParamsVersion(tc.wanttrend, defaultTrendParams.version())
+				if !compare2dSlices(trend, wanttrend) {
+					t.Errorf("got %#v, want %#v", trend, wanttrend)
 					// diff := cmp.Diff(trend, tc.wanttrend)
 					// t.Errorf("got %#v\nwant %#v\n%v", trend, tc.wanttrend, diff)
 				}
@@ -469,6 +471,15 @@ func TestCalcMovingTrend(t *testing.T) {
 	})
 }
 
+// trendの各行の最後にTrendParamsのversionをつける
+func withParamsVersion(data [][]string, version string) [][]string {
+	ss := make([][]string, 0, len(data))
+	for _, v := range data {
+		ss = append(ss, append(append([]string{}, v...), version))
+	}
+	return ss
+}
+
 func filterTargetCodeData(data [][]string, targetCodes []string) [][]string {
 	var ss [][]string
 	for _, v := range data {
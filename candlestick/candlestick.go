@@ -0,0 +1,186 @@
+package candlestick
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	dojiBodyRatio      = 0.1 // 実体が値幅のこの割合以下なら十字線
+	hammerShadowRatio  = 2   // 下ヒゲが実体のこの倍数以上ならカラカサ(ハンマー)
+	threeSoldiersCount = 3   // 赤三兵の本数
+)
+
+// Bar is OHLC of a date.
+type Bar struct {
+	Date  string
+	Open  float64
+	High  float64
+	Low   float64
+	Close float64
+}
+
+func (b Bar) body() float64 {
+	return math.Abs(b.Close - b.Open)
+}
+
+func (b Bar) upperShadow() float64 {
+	return b.High - math.Max(b.Open, b.Close)
+}
+
+func (b Bar) lowerShadow() float64 {
+	return math.Min(b.Open, b.Close) - b.Low
+}
+
+func (b Bar) bullish() bool {
+	return b.Close > b.Open
+}
+
+func (b Bar) bearish() bool {
+	return b.Close < b.Open
+}
+
+// Pattern is candlestick pattern.
+type Pattern int
+
+// Doji: 十字線。始値と終値がほぼ同じ
+// Hammer: カラカサ。実体が小さく長い下ヒゲ
+// BullishEngulfing: 陽の包み線。前日の陰線の実体を当日の陽線の実体が包む
+// BearishEngulfing: 陰の包み線。前日の陽線の実体を当日の陰線の実体が包む
+// BullishHarami: 陽のはらみ線。前日の陰線の実体の中に当日の陽線の実体が収まる
+// BearishHarami: 陰のはらみ線。前日の陽線の実体の中に当日の陰線の実体が収まる
+// ThreeWhiteSoldiers: 赤三兵。前日の実体の中で始まり終値を切り上げる陽線が3本続く
+// GapUp: 窓開け(上)。当日の安値が前日の高値より上
+// GapDown: 窓開け(下)。当日の高値が前日の安値より下
+
+const (
+	Doji Pattern = iota
+	Hammer
+	BullishEngulfing
+	BearishEngulfing
+	BullishHarami
+	BearishHarami
+	ThreeWhiteSoldiers
+	GapUp
+	GapDown
+)
+
+var patternNames = [...]string{"doji", "hammer", "bullishEngulfing", "bearishEngulfing", "bullishHarami", "bearishHarami", "threeWhiteSoldiers", "gapUp", "gapDown"}
+
+func (p Pattern) String() string {
+	return patternNames[p]
+}
+
+// Patterns returns all patterns.
+func Patterns() []Pattern {
+	ps := make([]Pattern, len(patternNames))
+	for i := range ps {
+		ps[i] = Pattern(i)
+	}
+	return ps
+}
+
+// PatternNames returns names of all patterns.
+func PatternNames() []string {
+	return append([]string{}, patternNames[:]...)
+}
+
+// ParsePattern returns Pattern of the name.
+func ParsePattern(name string) (Pattern, error) {
+	for i, n := range patternNames {
+		if n == name {
+			return Pattern(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown pattern: %s", name)
+}
+
+// Detect returns patterns completed at the last bar.
+// barsは日付の昇順で与える
+func Detect(bars []Bar) []Pattern {
+	if len(bars) == 0 {
+		return nil
+	}
+	cur := bars[len(bars)-1]
+	var ps []Pattern
+	if isDoji(cur) {
+		ps = append(ps, Doji)
+	}
+	if isHammer(cur) {
+		ps = append(ps, Hammer)
+	}
+	if len(bars) < 2 {
+		return ps
+	}
+	prev := bars[len(bars)-2]
+	if prev.bearish() && cur.bullish() && cur.Open <= prev.Close && cur.Close >= prev.Open && cur.body() > prev.body() {
+		ps = append(ps, BullishEngulfing)
+	}
+	if prev.bullish() && cur.bearish() && cur.Open >= prev.Close && cur.Close <= prev.Open && cur.body() > prev.body() {
+		ps = append(ps, BearishEngulfing)
+	}
+	if prev.bearish() && cur.bullish() && cur.Open >= prev.Close && cur.Close <= prev.Open && cur.body() < prev.body() {
+		ps = append(ps, BullishHarami)
+	}
+	if prev.bullish() && cur.bearish() && cur.Open <= prev.Close && cur.Close >= prev.Open && cur.body() < prev.body() {
+		ps = append(ps, BearishHarami)
+	}
+	if isThreeWhiteSoldiers(bars) {
+		ps = append(ps, ThreeWhiteSoldiers)
+	}
+	if cur.Low > prev.High {
+		ps = append(ps, GapUp)
+	}
+	if cur.High < prev.Low {
+		ps = append(ps, GapDown)
+	}
+	return ps
+}
+
+// DatePatterns has date and detected patterns.
+type DatePatterns struct {
+	Date     string
+	Patterns []Pattern
+}
+
+// DetectAll detects patterns on each date of bars.
+// barsは日付の昇順で与える。patternがない日付は含めない
+func DetectAll(bars []Bar) []DatePatterns {
+	var dps []DatePatterns
+	for i := range bars {
+		if ps := Detect(bars[:i+1]); len(ps) > 0 {
+			dps = append(dps, DatePatterns{Date: bars[i].Date, Patterns: ps})
+		}
+	}
+	return dps
+}
+
+func isDoji(b Bar) bool {
+	r := b.High - b.Low
+	return r > 0 && b.body() <= r*dojiBodyRatio
+}
+
+// 十字線とは区別する
+func isHammer(b Bar) bool {
+	return !isDoji(b) && b.body() > 0 && b.lowerShadow() >= b.body()*hammerShadowRatio && b.upperShadow() <= b.body()
+}
+
+func isThreeWhiteSoldiers(bars []Bar) bool {
+	if len(bars) < threeSoldiersCount {
+		return false
+	}
+	last := bars[len(bars)-threeSoldiersCount:]
+	for i, b := range last {
+		if !b.bullish() {
+			return false
+		}
+		if i == 0 {
+			continue
+		}
+		prev := last[i-1]
+		if b.Close <= prev.Close || b.Open < prev.Open || b.Open > prev.Close {
+			return false
+		}
+	}
+	return true
+}
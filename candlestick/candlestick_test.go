@@ -0,0 +1,117 @@
+package candlestick
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := map[string]struct {
+		bars []Bar
+		want []Pattern
+	}{
+		"doji": {
+			bars: []Bar{{Open: 100, High: 105, Low: 95, Close: 100.5}},
+			want: []Pattern{Doji},
+		},
+		"hammer": {
+			bars: []Bar{{Open: 100, High: 103, Low: 90, Close: 102}},
+			want: []Pattern{Hammer},
+		},
+		"bullish_engulfing": {
+			bars: []Bar{
+				{Open: 102, High: 103, Low: 99, Close: 100},
+				{Open: 99, High: 105, Low: 98, Close: 104},
+			},
+			want: []Pattern{BullishEngulfing},
+		},
+		"bearish_engulfing": {
+			bars: []Bar{
+				{Open: 100, High: 103, Low: 99, Close: 102},
+				{Open: 103, High: 104, Low: 97, Close: 98},
+			},
+			want: []Pattern{BearishEngulfing},
+		},
+		"bullish_harami": {
+			bars: []Bar{
+				{Open: 110, High: 111, Low: 99, Close: 100},
+				{Open: 102, High: 106, Low: 101, Close: 105},
+			},
+			want: []Pattern{BullishHarami},
+		},
+		"bearish_harami": {
+			bars: []Bar{
+				{Open: 100, High: 111, Low: 99, Close: 110},
+				{Open: 108, High: 109, Low: 103, Close: 104},
+			},
+			want: []Pattern{BearishHarami},
+		},
+		"three_white_soldiers": {
+			bars: []Bar{
+				{Open: 100, High: 106, Low: 99, Close: 105},
+				{Open: 103, High: 110, Low: 102, Close: 109},
+				{Open: 107, High: 114, Low: 106, Close: 113},
+			},
+			want: []Pattern{ThreeWhiteSoldiers},
+		},
+		"gap_up": {
+			bars: []Bar{
+				{Open: 100, High: 106, Low: 99, Close: 105},
+				{Open: 108, High: 115, Low: 107, Close: 114},
+			},
+			want: []Pattern{GapUp},
+		},
+		"gap_down_and_doji": {
+			bars: []Bar{
+				{Open: 100, High: 106, Low: 99, Close: 105},
+				{Open: 95, High: 97, Low: 93, Close: 95},
+			},
+			want: []Pattern{Doji, GapDown},
+		},
+		"no_pattern": {
+			bars: []Bar{
+				{Open: 100, High: 106, Low: 99, Close: 105},
+				{Open: 104, High: 110, Low: 103, Close: 108},
+			},
+			want: nil,
+		},
+		"empty": {
+			bars: nil,
+			want: nil,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := Detect(tc.bars); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDetectAll(t *testing.T) {
+	bars := []Bar{
+		{Date: "2021/01/05", Open: 100, High: 106, Low: 99, Close: 105},
+		{Date: "2021/01/06", Open: 104, High: 110, Low: 103, Close: 108},
+		{Date: "2021/01/07", Open: 112, High: 116, Low: 111, Close: 112.2},
+	}
+	want := []DatePatterns{{Date: "2021/01/07", Patterns: []Pattern{Doji, GapUp}}}
+	if got := DetectAll(bars); !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestParsePattern(t *testing.T) {
+	for _, p := range Patterns() {
+		got, err := ParsePattern(p.String())
+		if err != nil {
+			t.Fatalf("failed to ParsePattern: %v", err)
+		}
+		if got != p {
+			t.Errorf("got: %v, want: %v", got, p)
+		}
+	}
+	if _, err := ParsePattern("unknown"); err == nil {
+		t.Error("want error for unknown pattern")
+	}
+}
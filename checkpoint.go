@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ludwig125/gke-stockprice/database"
+)
+
+// 銘柄ごとの処理の完了を記録するtable
+const checkpointTable = "checkpoint"
+
+// Checkpoint records codes finished in a step on a run date.
+// 途中で失敗して再実行したときに、同じ日に完了済みの銘柄を処理しないようにする
+// nilの場合は何も記録せず、全銘柄を処理する
+type Checkpoint struct {
+	db      database.DB
+	table   string
+	runDate string // YYYY/MM/DD
+	step    string
+}
+
+// NewCheckpoint returns Checkpoint of step on the date of runTime.
+func NewCheckpoint(db database.DB, runTime time.Time, step string) *Checkpoint {
+	return &Checkpoint{db: db, table: checkpointTable, runDate: runTime.In(jst).Format("2006/01/02"), step: step}
+}
+
+// NewTargetCheckpoint returns Checkpoint of step for targetDate on the date of runTime.
+// 対象日によって結果が変わるstepに使う。同じ日に別の対象日で再実行した場合は全銘柄を処理する
+func NewTargetCheckpoint(db database.DB, runTime time.Time, step, targetDate string) *Checkpoint {
+	return NewCheckpoint(db, runTime, step+":"+targetDate)
+}
+
+// unfinished returns codes not finished yet in the order of codes.
+func (cp *Checkpoint) unfinished(codes []string) ([]string, error) {
+	if cp == nil {
+		return codes, nil
+	}
+	q := fmt.Sprintf("SELECT code FROM %s WHERE run_date = '%s' AND step = '%s';", cp.table, cp.runDate, cp.step)
+	res, err := cp.db.SelectDB(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to selectTable %v", err)
+	}
+	done := make(map[string]bool, len(res))
+	for _, r := range res {
+		done[r[0]] = true
+	}
+	var rest []string
+	for _, code := range codes {
+		if !done[code] {
+			rest = append(rest, code)
+		}
+	}
+	if skipped := len(codes) - len(rest); skipped > 0 {
+		log.Printf("checkpoint %s %s: skip %d finished codes, %d codes left", cp.step, cp.runDate, skipped, len(rest))
+	}
+	return rest, nil
+}
+
+// mark records codes as finished.
+func (cp *Checkpoint) mark(codes []string) error {
+	if cp == nil || len(codes) == 0 {
+		return nil
+	}
+	finishedAt := now().In(jst).Format("2006-01-02 15:04:05")
+	records := make([][]string, len(codes))
+	for i, code := range codes {
+		records[i] = []string{cp.runDate, cp.step, code, finishedAt}
+	}
+	if err := cp.db.InsertOrUpdateDB(cp.table, records); err != nil {
+		return fmt.Errorf("failed to insert checkpoint: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultMovingAvgPairsはゴールデンクロス、デッドクロスを検出する移動平均線の組み合わせのデフォルト
+var defaultMovingAvgPairs = []MovingAvgPair{
+	{Short: "M5", Long: "M20"},
+	{Short: "M20", Long: "M60"},
+	{Short: "M60", Long: "M100"},
+	{Short: "EMA12", Long: "EMA26"},
+}
+
+// M20のような単純移動平均か、EMA12のような指数平滑移動平均
+var movingAvgNameRe = regexp.MustCompile(`^(M|EMA)([0-9]+)$`)
+
+// MovingAvgPair is pair of moving averages to detect crossover.
+type MovingAvgPair struct {
+	Short string
+	Long  string
+}
+
+func (p MovingAvgPair) String() string {
+	return p.Short + "/" + p.Long
+}
+
+// "M5/M20,EMA12/EMA26" のような文字列をMovingAvgPairのSliceに変換する
+func parseMovingAvgPairs(s string) ([]MovingAvgPair, error) {
+	var pairs []MovingAvgPair
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		sl := strings.Split(p, "/")
+		if len(sl) != 2 {
+			return nil, fmt.Errorf("invalid moving average pair: '%s'. Please set like 'M5/M20'", p)
+		}
+		for _, name := range sl {
+			if _, _, err := parseMovingAvgName(name); err != nil {
+				return nil, fmt.Errorf("failed to parseMovingAvgName: %v", err)
+			}
+		}
+		pairs = append(pairs, MovingAvgPair{Short: sl[0], Long: sl[1]})
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("no moving average pair: '%s'", s)
+	}
+	return pairs, nil
+}
+
+func parseMovingAvgName(name string) (kind string, days int, err error) {
+	m := movingAvgNameRe.FindStringSubmatch(name)
+	if m == nil {
+		return "", 0, fmt.Errorf("invalid moving average name: '%s'. Please set like 'M20' or 'EMA12'", name)
+	}
+	days, err = strconv.Atoi(m[2])
+	if err != nil || days <= 0 {
+		return "", 0, fmt.Errorf("invalid moving average days: '%s'", name)
+	}
+	return m[1], days, nil
+}
+
+// CrossoverType is type of crossover between two moving averages.
+type CrossoverType int
+
+// 3: goldenCross : 短期線が長期線を下から上に抜けた
+// 2: noCrossover
+// 1: deadCross : 短期線が長期線を上から下に抜けた
+// 0: unknownCrossover
+
+const (
+	unknownCrossover CrossoverType = iota
+	deadCross
+	noCrossover
+	goldenCross
+)
+
+// constのString変換メソッド
+func (c CrossoverType) String() string {
+	return [4]string{"unknownCrossover", "deadCross", "noCrossover", "goldenCross"}[c]
+}
+
+// CrossoverEvent is crossover of a moving average pair on a date.
+type CrossoverEvent struct {
+	Date      string
+	Pair      MovingAvgPair
+	Crossover CrossoverType
+}
+
+// CodeCrossoverEvents maps code and multiple CrossoverEvent.
+type CodeCrossoverEvents map[string][]CrossoverEvent
+
+// Slices converts CodeCrossoverEvents to double string slice.
+func (c CodeCrossoverEvents) Slices() [][]string {
+	var crossoverData [][]string
+	for code, events := range c {
+		for _, e := range events {
+			crossoverData = append(crossoverData, []string{
+				code,
+				e.Date,
+				e.Pair.String(),
+				fmt.Sprintf("%d", e.Crossover),
+			})
+		}
+	}
+	return crossoverData
+}
+
+func calculateCodeCrossoverEvents(codeDateCloses map[string][]DateClose, pairs []MovingAvgPair) (map[string][]CrossoverEvent, error) {
+	cces := make(map[string][]CrossoverEvent, len(codeDateCloses))
+	for code, dateCloses := range codeDateCloses {
+		events, err := detectCrossovers(dateCloses, pairs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to detectCrossovers: %v, code: %s", err, code)
+		}
+		cces[code] = events
+	}
+	return cces, nil
+}
+
+// dateClosesは日付の降順で与えられる
+// 返り値は日付の降順にする
+func detectCrossovers(dateCloses []DateClose, pairs []MovingAvgPair) ([]CrossoverEvent, error) {
+	dcs := DateCloses(dateCloses)
+
+	series := make(map[string]map[string]float64) // 移動平均の名前と(日付:移動平均)のMap
+	for _, p := range pairs {
+		for _, name := range []string{p.Short, p.Long} {
+			if _, ok := series[name]; ok {
+				continue
+			}
+			s, err := dcs.movingAvgSeries(name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to movingAvgSeries: %v", err)
+			}
+			series[name] = s
+		}
+	}
+
+	var events []CrossoverEvent
+	for _, p := range pairs {
+		short, long := series[p.Short], series[p.Long]
+		lastSign := 0                        // 直近の0でない(短期線 - 長期線)の符号
+		for i := len(dcs) - 1; i >= 0; i-- { // 日付の古い順
+			date := dcs[i].Date
+			sign := 0
+			if diff := short[date] - long[date]; diff > 0 {
+				sign = 1
+			} else if diff < 0 {
+				sign = -1
+			}
+			if sign == 0 { // 短期線と長期線が同じ値の日は判断しない
+				continue
+			}
+			if lastSign == -1 && sign == 1 {
+				events = append(events, CrossoverEvent{Date: date, Pair: p, Crossover: goldenCross})
+			}
+			if lastSign == 1 && sign == -1 {
+				events = append(events, CrossoverEvent{Date: date, Pair: p, Crossover: deadCross})
+			}
+			lastSign = sign
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Date > events[j].Date })
+	return events, nil
+}
+
+func (d DateCloses) movingAvgSeries(name string) (map[string]float64, error) {
+	kind, days, err := parseMovingAvgName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parseMovingAvgName: %v", err)
+	}
+	if kind == "EMA" {
+		return d.calcEMA(days), nil
+	}
+	return d.calcMovingAvg(days), nil
+}
+
+// 指数平滑移動平均
+// 最も古い日の終値を初期値として、日付の古い順に計算する
+func (d DateCloses) calcEMA(days int) map[string]float64 {
+	dateEMA := make(map[string]float64) // 日付と指数平滑移動平均のMap
+	if len(d) == 0 {
+		return dateEMA
+	}
+	alpha := 2 / float64(days+1)
+	ema := d[len(d)-1].Close
+	for i := len(d) - 1; i >= 0; i-- {
+		ema = alpha*d[i].Close + (1-alpha)*ema
+		dateEMA[d[i].Date] = ema
+	}
+	return dateEMA
+}
+
+func createCrossoverSlackMsg(date string, events map[string][]CrossoverEvent) string {
+	const maxCodes = 10 // Slackに列挙する銘柄数の上限
+
+	// MovingAvgPairとCrossoverTypeの組み合わせごとに銘柄をまとめる
+	grouped := make(map[string][]string)
+	for code, es := range events {
+		for _, e := range es {
+			key := fmt.Sprintf("%s %s", e.Pair, e.Crossover)
+			grouped[key] = append(grouped[key], code)
+		}
+	}
+	if len(grouped) == 0 {
+		return fmt.Sprintf("crossover %s: なし", date)
+	}
+	var keys []string
+	for k := range grouped {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	msg := fmt.Sprintf("crossover %s:", date)
+	for _, k := range keys {
+		codes := grouped[k]
+		sort.Strings(codes)
+		listed := codes
+		if len(listed) > maxCodes {
+			listed = listed[:maxCodes]
+		}
+		msg += fmt.Sprintf("\n%s: %d銘柄 %s", k, len(codes), strings.Join(listed, ","))
+		if len(codes) > maxCodes {
+			msg += ",..."
+		}
+	}
+	return msg
+}
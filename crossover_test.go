@@ -0,0 +1,99 @@
+// +build !integration
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMovingAvgPairs(t *testing.T) {
+	tests := map[string]struct {
+		s       string
+		want    []MovingAvgPair
+		wantErr bool
+	}{
+		"default": {
+			s:    "M5/M20,M20/M60,M60/M100,EMA12/EMA26",
+			want: defaultMovingAvgPairs,
+		},
+		"with_space": {
+			s:    " M5/M20 , EMA12/EMA26 ",
+			want: []MovingAvgPair{{Short: "M5", Long: "M20"}, {Short: "EMA12", Long: "EMA26"}},
+		},
+		"no_slash": {
+			s:       "M5M20",
+			wantErr: true,
+		},
+		"invalid_name": {
+			s:       "M5/SMA20",
+			wantErr: true,
+		},
+		"zero_days": {
+			s:       "M0/M20",
+			wantErr: true,
+		},
+		"empty": {
+			s:       "",
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseMovingAvgPairs(tc.s)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("gotErr: %v, wantErr: %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %#v, want: %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDetectCrossovers(t *testing.T) {
+	// 日付の降順
+	dateCloses := []DateClose{
+		{Date: "2020/12/20", Close: 7},
+		{Date: "2020/12/19", Close: 13},
+		{Date: "2020/12/18", Close: 12},
+		{Date: "2020/12/17", Close: 8},
+		{Date: "2020/12/16", Close: 9},
+		{Date: "2020/12/15", Close: 10},
+	}
+	pair := MovingAvgPair{Short: "M1", Long: "M3"}
+	// M1 - M3: 0, -0.5, -1, +2.33, +2, -3.67 (日付の昇順)
+	want := []CrossoverEvent{
+		{Date: "2020/12/20", Pair: pair, Crossover: deadCross},
+		{Date: "2020/12/18", Pair: pair, Crossover: goldenCross},
+	}
+
+	got, err := detectCrossovers(dateCloses, []MovingAvgPair{pair})
+	if err != nil {
+		t.Fatalf("failed to detectCrossovers: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %#v, want: %#v", got, want)
+	}
+}
+
+func TestCalcEMA(t *testing.T) {
+	// 日付の降順
+	dcs := DateCloses{
+		{Date: "2020/12/17", Close: 13},
+		{Date: "2020/12/16", Close: 10},
+		{Date: "2020/12/15", Close: 10},
+	}
+	// alpha = 2 / (3 + 1) = 0.5
+	want := map[string]float64{
+		"2020/12/15": 10,
+		"2020/12/16": 10,
+		"2020/12/17": 11.5,
+	}
+	got := dcs.calcEMA(3)
+	for date, w := range want {
+		if !almostEqual(got[date], w) {
+			t.Errorf("%s got: %v, want: %v", date, got[date], w)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Package dag runs tasks in order of their dependencies.
+package dag
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ludwig125/gke-stockprice/retry"
+)
+
+// Task is a node of Graph.
+type Task struct {
+	Name      string
+	DependsOn []string // 先に終わっている必要のあるtask名
+	After     []string // 先に実行するtask名。DependsOnと違い、失敗してもこのtaskは実行する
+	// SkipIf returns true and the reason when the task should not run.
+	// skipしたtaskに依存するtaskは通常通り実行する
+	SkipIf func() (bool, string)
+	Once   bool  // trueならTrackerで当日完了済みのときにskipし、結果をTrackerに記録する
+	Retry  Retry // 0値の場合はリトライしない
+	Run    func(ctx context.Context) error
+}
+
+// Retry is retry policy of Task.
+type Retry struct {
+	Attempts int
+	Interval time.Duration
+}
+
+// Tracker records results of tasks so that a rerun resumes from the failed task.
+type Tracker interface {
+	IsDone(task string) (bool, error)
+	Record(task string, start time.Time, err error) error
+}
+
+// State is state of Task after Run.
+type State int
+
+// 4: blocked
+// 3: skipped
+// 2: failed
+// 1: succeeded
+// 0: unknownState
+
+const (
+	unknownState State = iota
+	// Succeeded means the task finished without error.
+	Succeeded
+	// Failed means the task returned error.
+	Failed
+	// Skipped means the task did not run because of SkipIf or Tracker.
+	Skipped
+	// Blocked means the task did not run because its dependency failed or was blocked.
+	Blocked
+)
+
+func (s State) String() string {
+	return [5]string{"unknownState", "succeeded", "failed", "skipped", "blocked"}[s]
+}
+
+// Graph is tasks sorted by their dependencies.
+type Graph struct {
+	tasks []Task // 実行順
+}
+
+// New returns Graph. task名の重複、存在しない依存先、循環があればエラーを返す
+// 依存関係(DependsOn, After)で順番が決まらないtaskは渡した順に実行する
+func New(tasks ...Task) (*Graph, error) {
+	index := make(map[string]int, len(tasks))
+	for i, t := range tasks {
+		if t.Name == "" {
+			return nil, fmt.Errorf("task %d has no name", i)
+		}
+		if _, ok := index[t.Name]; ok {
+			return nil, fmt.Errorf("duplicated task: %s", t.Name)
+		}
+		if t.Run == nil {
+			return nil, fmt.Errorf("task %s has no Run", t.Name)
+		}
+		index[t.Name] = i
+	}
+	for _, t := range tasks {
+		for _, d := range t.DependsOn {
+			if _, ok := index[d]; !ok {
+				return nil, fmt.Errorf("task %s depends on unknown task: %s", t.Name, d)
+			}
+		}
+		for _, a := range t.After {
+			if _, ok := index[a]; !ok {
+				return nil, fmt.Errorf("task %s runs after unknown task: %s", t.Name, a)
+			}
+		}
+	}
+
+	// 依存先とAfterのtaskが全て並んだtaskのうち、先に渡されたものから並べる
+	sorted := make([]Task, 0, len(tasks))
+	added := make([]bool, len(tasks))
+	allAdded := func(names []string) bool {
+		for _, n := range names {
+			if !added[index[n]] {
+				return false
+			}
+		}
+		return true
+	}
+	for len(sorted) < len(tasks) {
+		next := -1
+		for i, t := range tasks {
+			if added[i] {
+				continue
+			}
+			if allAdded(t.DependsOn) && allAdded(t.After) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			var rest []string
+			for i, t := range tasks {
+				if !added[i] {
+					rest = append(rest, t.Name)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle in tasks: %s", strings.Join(rest, ","))
+		}
+		added[next] = true
+		sorted = append(sorted, tasks[next])
+	}
+	return &Graph{tasks: sorted}, nil
+}
+
+// Names returns task names in execution order.
+func (g *Graph) Names() []string {
+	names := make([]string, len(g.tasks))
+	for i, t := range g.tasks {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// Run executes tasks in order and returns the state of each task.
+// 失敗したtaskに依存するtaskは実行しないが、それ以外のtaskは続けて実行する
+// trackerがnilの場合はOnceのtaskも毎回実行する
+func (g *Graph) Run(ctx context.Context, tracker Tracker) (map[string]State, error) {
+	states := make(map[string]State, len(g.tasks))
+	var errs []string
+	for _, t := range g.tasks {
+		state, err := g.runTask(ctx, t, states, tracker)
+		states[t.Name] = state
+		log.Printf("task %s: %s", t.Name, state)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("failed to %s: %v", t.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return states, fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return states, nil
+}
+
+func (g *Graph) runTask(ctx context.Context, t Task, states map[string]State, tracker Tracker) (State, error) {
+	select {
+	case <-ctx.Done(): // ctx のcancelを受け取ったら以降のtaskは実行しない
+		return Blocked, ctx.Err()
+	default:
+	}
+	for _, d := range t.DependsOn {
+		if s := states[d]; s == Failed || s == Blocked {
+			log.Printf("task %s is blocked by %s: %s", t.Name, d, s)
+			return Blocked, nil
+		}
+	}
+	if t.SkipIf != nil {
+		if skip, reason := t.SkipIf(); skip {
+			log.Printf("skip task %s: %s", t.Name, reason)
+			return Skipped, nil
+		}
+	}
+	track := t.Once && tracker != nil
+	if track {
+		done, err := tracker.IsDone(t.Name)
+		if err != nil {
+			return Failed, fmt.Errorf("failed to IsDone: %v", err)
+		}
+		if done {
+			log.Printf("skip task %s: already done", t.Name)
+			return Skipped, nil
+		}
+	}
+
+	start := time.Now()
+	run := func() error { return t.Run(ctx) }
+	var err error
+	if t.Retry.Attempts > 1 {
+		err = retry.WithContext(ctx, t.Retry.Attempts, t.Retry.Interval, run)
+	} else {
+		err = run()
+	}
+	if track {
+		if rerr := tracker.Record(t.Name, start, err); rerr != nil {
+			if err == nil { // 記録できなければ次の実行でもう一度実行する
+				return Failed, fmt.Errorf("failed to Record: %v", rerr)
+			}
+			log.Printf("failed to Record failure of %s: %v", t.Name, rerr)
+		}
+	}
+	if err != nil {
+		return Failed, err
+	}
+	return Succeeded, nil
+}
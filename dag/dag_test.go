@@ -0,0 +1,254 @@
+package dag
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func noop(ctx context.Context) error { return nil }
+
+func TestNew(t *testing.T) {
+	cases := map[string]struct {
+		tasks     []Task
+		wantNames []string
+		wantErr   bool
+	}{
+		"keep_order_without_dependency": {
+			tasks:     []Task{{Name: "a", Run: noop}, {Name: "b", Run: noop}, {Name: "c", Run: noop}},
+			wantNames: []string{"a", "b", "c"},
+		},
+		"sort_by_dependency": {
+			tasks: []Task{
+				{Name: "backup", DependsOn: []string{"calc"}, Run: noop},
+				{Name: "calc", DependsOn: []string{"save"}, Run: noop},
+				{Name: "save", Run: noop},
+				{Name: "restructure", Run: noop},
+			},
+			wantNames: []string{"save", "calc", "backup", "restructure"},
+		},
+		"sort_by_after": {
+			tasks: []Task{
+				{Name: "calc", DependsOn: []string{"save"}, After: []string{"retry"}, Run: noop},
+				{Name: "save", Run: noop},
+				{Name: "retry", DependsOn: []string{"save"}, Run: noop},
+			},
+			wantNames: []string{"save", "retry", "calc"},
+		},
+		"cycle_with_after": {
+			tasks: []Task{
+				{Name: "a", After: []string{"b"}, Run: noop},
+				{Name: "b", DependsOn: []string{"a"}, Run: noop},
+			},
+			wantErr: true,
+		},
+		"unknown_after": {
+			tasks:   []Task{{Name: "a", After: []string{"x"}, Run: noop}},
+			wantErr: true,
+		},
+		"cycle": {
+			tasks: []Task{
+				{Name: "a", DependsOn: []string{"b"}, Run: noop},
+				{Name: "b", DependsOn: []string{"a"}, Run: noop},
+			},
+			wantErr: true,
+		},
+		"unknown_dependency": {
+			tasks:   []Task{{Name: "a", DependsOn: []string{"x"}, Run: noop}},
+			wantErr: true,
+		},
+		"duplicated_name": {
+			tasks:   []Task{{Name: "a", Run: noop}, {Name: "a", Run: noop}},
+			wantErr: true,
+		},
+		"no_run": {
+			tasks:   []Task{{Name: "a"}},
+			wantErr: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			g, err := New(tc.tasks...)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error: %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := g.Names(); !reflect.DeepEqual(got, tc.wantNames) {
+				t.Errorf("got %v, want %v", got, tc.wantNames)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	var executed []string
+	task := func(name string, err error, deps ...string) Task {
+		return Task{Name: name, DependsOn: deps, Run: func(ctx context.Context) error {
+			executed = append(executed, name)
+			return err
+		}}
+	}
+	skipped := task("dayoff", nil, "save")
+	skipped.SkipIf = func() (bool, string) { return true, "previous day is dayoff" }
+
+	g, err := New(
+		task("save", nil),
+		skipped,
+		task("calc", errors.New("calc error"), "dayoff"),
+		task("backup", nil, "calc"),
+		task("export", nil, "backup"),
+		task("independent", nil),
+	)
+	if err != nil {
+		t.Fatalf("failed to New: %v", err)
+	}
+	states, err := g.Run(context.Background(), nil)
+	if err == nil || err.Error() != "failed to calc: calc error" {
+		t.Errorf("got error: %v", err)
+	}
+	wantStates := map[string]State{
+		"save":        Succeeded,
+		"dayoff":      Skipped,
+		"calc":        Failed,
+		"backup":      Blocked,
+		"export":      Blocked,
+		"independent": Succeeded,
+	}
+	if !reflect.DeepEqual(states, wantStates) {
+		t.Errorf("got states %v, want %v", states, wantStates)
+	}
+	if want := []string{"save", "calc", "independent"}; !reflect.DeepEqual(executed, want) {
+		t.Errorf("got executed %v, want %v", executed, want)
+	}
+}
+
+func TestRunAfterFailed(t *testing.T) {
+	var executed []string
+	task := func(name string, err error) Task {
+		return Task{Name: name, Run: func(ctx context.Context) error {
+			executed = append(executed, name)
+			return err
+		}}
+	}
+	calc := task("calc", nil)
+	calc.After = []string{"retry"}
+	// Afterのtaskが失敗してもblockedにはならない
+	g, err := New(calc, task("retry", errors.New("retry error")))
+	if err != nil {
+		t.Fatalf("failed to New: %v", err)
+	}
+	states, err := g.Run(context.Background(), nil)
+	if err == nil || err.Error() != "failed to retry: retry error" {
+		t.Errorf("got error: %v", err)
+	}
+	if want := map[string]State{"retry": Failed, "calc": Succeeded}; !reflect.DeepEqual(states, want) {
+		t.Errorf("got states %v, want %v", states, want)
+	}
+	if want := []string{"retry", "calc"}; !reflect.DeepEqual(executed, want) {
+		t.Errorf("got executed %v, want %v", executed, want)
+	}
+}
+
+func TestRunRetry(t *testing.T) {
+	calls := 0
+	g, err := New(Task{
+		Name:  "flaky",
+		Retry: Retry{Attempts: 3, Interval: time.Microsecond},
+		Run: func(ctx context.Context) error {
+			calls++
+			if calls < 3 {
+				return errors.New("temporary error")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to New: %v", err)
+	}
+	states, err := g.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("failed to Run: %v", err)
+	}
+	if states["flaky"] != Succeeded || calls != 3 {
+		t.Errorf("got state %s, calls %d", states["flaky"], calls)
+	}
+}
+
+type memTracker struct {
+	done     map[string]bool
+	recorded map[string]error
+}
+
+func (m *memTracker) IsDone(task string) (bool, error) { return m.done[task], nil }
+
+func (m *memTracker) Record(task string, start time.Time, err error) error {
+	m.recorded[task] = err
+	if err == nil {
+		m.done[task] = true
+	}
+	return nil
+}
+
+// 失敗したtaskから再実行できる
+func TestRunResume(t *testing.T) {
+	tracker := &memTracker{done: make(map[string]bool), recorded: make(map[string]error)}
+	var executed []string
+	fail := true
+	tasks := []Task{
+		{Name: "save", Once: true, Run: func(ctx context.Context) error {
+			executed = append(executed, "save")
+			return nil
+		}},
+		{Name: "calc", Once: true, DependsOn: []string{"save"}, Run: func(ctx context.Context) error {
+			executed = append(executed, "calc")
+			if fail {
+				return errors.New("calc error")
+			}
+			return nil
+		}},
+		{Name: "notify", DependsOn: []string{"calc"}, Run: func(ctx context.Context) error { // Onceでないtaskは毎回実行する
+			executed = append(executed, "notify")
+			return nil
+		}},
+	}
+	g, err := New(tasks...)
+	if err != nil {
+		t.Fatalf("failed to New: %v", err)
+	}
+
+	if _, err := g.Run(context.Background(), tracker); err == nil {
+		t.Fatal("want error in first run")
+	}
+	if tracker.recorded["calc"] == nil {
+		t.Error("failure of calc is not recorded")
+	}
+
+	fail = false
+	states, err := g.Run(context.Background(), tracker)
+	if err != nil {
+		t.Fatalf("failed to Run: %v", err)
+	}
+	if want := map[string]State{"save": Skipped, "calc": Succeeded, "notify": Succeeded}; !reflect.DeepEqual(states, want) {
+		t.Errorf("got states %v, want %v", states, want)
+	}
+	if want := []string{"save", "calc", "calc", "notify"}; !reflect.DeepEqual(executed, want) {
+		t.Errorf("got executed %v, want %v", executed, want)
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	g, err := New(Task{Name: "a", Run: noop})
+	if err != nil {
+		t.Fatalf("failed to New: %v", err)
+	}
+	states, err := g.Run(ctx, nil)
+	if err == nil || states["a"] != Blocked {
+		t.Errorf("got state %s, error %v", states["a"], err)
+	}
+}
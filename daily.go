@@ -2,108 +2,174 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
-	"github.com/ludwig125/gke-stockprice/retry"
-	"github.com/ludwig125/gke-stockprice/sheet"
+	"github.com/ludwig125/gke-stockprice/dag"
 	"github.com/ludwig125/gke-stockprice/status"
 )
 
+// dailyのtask名。statusにもこの名前で記録する
+const (
+	saveStockPriceTask               = "saveStockPrice"
+	retrySaveStockPriceTask          = "retrySaveStockPrice"
+	calculateDailyMovingAvgTrendTask = "calculateDailyMovingAvgTrend"
+)
+
 type daily struct {
-	status                       sheet.Sheet
+	status                       status.Status
 	dayoff                       DayOff
 	dailyStockPrice              DailyStockPrice
 	calculateDailyMovingAvgTrend CalculateDailyMovingAvgTrend
 	// calculateMovingAvg   CalculateMovingAvg
 	// calculateGrowthTrend CalculateGrowthTrend
-}
 
-func (d daily) exec(ctx context.Context, codes []string) error {
-	mergeErr := func(err error, failedCodes FailedCodes) error {
-		if err != nil {
-			if len(failedCodes) != 0 {
-				return fmt.Errorf("%v\n%v", err, failedCodes.Error())
-			}
-			return fmt.Errorf("%v", err)
-		}
-		if len(failedCodes) != 0 {
-			return fmt.Errorf("%v", failedCodes.Error())
-		}
-		return nil
-	}
+	failedCodes FailedCodes // saveStockPriceで失敗した銘柄。後続のtaskで使う
+	retryCnt    int         // retrySaveStockPriceでsaveStockPriceを実行した回数
+	ledger      *RunLedger  // nilの場合は実行の記録をとらない
+}
 
+// extraはdailyのtaskと一緒に実行するtask。依存関係のないものはdailyのtaskより先に実行する
+func (d *daily) exec(ctx context.Context, codes []string, extra ...dag.Task) error {
 	if now().IsZero() {
 		log.Println("now is zero")
 		return fmt.Errorf("now is zero: %#v", now())
 	}
 
-	// Status管理用の変数
-	st := status.Status{Sheet: d.status}
-
-	// 日足株価のスクレイピングとDBへの書き込み
-	// statusシートを見て本日分が未完了であれば実行する(ExecIfIncompleteThisDay関数の機能)
-	sp := d.dailyStockPrice
-	var failedCodes FailedCodes
-	if err := st.ExecIfIncompleteThisDay("saveStockPrice", now(), func() error {
-		var e error
-		failedCodes, e = sp.saveStockPrice(ctx, codes, now())
-		return e
-	}); err != nil {
-		return fmt.Errorf("failed to saveStockPrice: %v", mergeErr(err, failedCodes))
+	g, err := dag.New(d.ledger.wrap(append(extra, d.tasks(codes)...))...)
+	if err != nil {
+		return fmt.Errorf("failed to dag.New: %v", err)
 	}
+	log.Printf("daily tasks: %v", g.Names())
+	d.ledger.initSteps(g.Names())
+	// statusを見て本日分が完了済みのtaskはskipする
+	states, err := g.Run(ctx, statusTracker{st: d.status})
+	d.ledger.setStates(states)
+
+	// 株価の格納自体に失敗した場合は成功した銘柄はないものとする
+	succeeded := len(codes) - len(d.failedCodes)
+	if s := states[saveStockPriceTask]; s != dag.Succeeded && s != dag.Skipped {
+		succeeded = 0
+	}
+	d.ledger.setCodes(len(codes), succeeded, len(d.failedCodes))
+	return mergeErr(err, d.failedCodes, states[retrySaveStockPriceTask] == dag.Failed)
+}
 
-	// 全部スクレイピングできていなかったら再度試みる
-	// - failedCodesを使って、数回saveStockPriceを実行する
-	// - それでも失敗したものをあらためてfailedCodesとする
-	if len(failedCodes) > 0 {
-		retryCnt := 0
-		if err := retry.WithContext(ctx, 2, 5*time.Second, func() error {
-			fcodes := failedCodesSlice(failedCodes) // failedCodesから銘柄のスライスを取得
-			if len(fcodes) == 0 {                   // failedCodesがなければ終了
-				return nil
-			}
-			retryCnt++
-			log.Printf("retry: %d. trying to fetch stockprice for failed codes: %v", retryCnt, fcodes)
-			start := now()
-			newFailedCodes, err := sp.saveStockPrice(ctx, fcodes, now())
-			st.InsertStatus(fmt.Sprintf("saveStockPrice_retry%d", retryCnt), now(), now().Sub(start)) // now().Sub(start)で所要時間も入れておく
-			log.Printf("retry: %d. failedCodes error: '%#v', saveStockPrice error: %v", retryCnt, newFailedCodes.Error(), err)
-
-			failedCodes = newFailedCodes // failedCodesを上書き
-			return fmt.Errorf("failedCodes error: %v, saveStockPrice error: %v", newFailedCodes.Error(), err)
-		}); err != nil {
-			// retry 時のエラーはログに出すだけにしておく
-			log.Printf("failed to saveStockPrice in retry: %v", err)
+// dagのエラーと失敗した銘柄をまとめる
+// reportedがtrueの場合(retrySaveStockPriceのエラーに失敗した銘柄が含まれている)は、銘柄を重ねて足さない
+func mergeErr(err error, failedCodes FailedCodes, reported bool) error {
+	if reported {
+		failedCodes = nil
+	}
+	if err != nil {
+		if len(failedCodes) != 0 {
+			return fmt.Errorf("%v\n%v", err, failedCodes.Error())
 		}
+		return fmt.Errorf("%v", err)
 	}
+	if len(failedCodes) != 0 {
+		return fmt.Errorf("%v", failedCodes.Error())
+	}
+	return nil
+}
 
-	// TODO: 最初に取得した株価が全部格納されているか確認したい
-
-	// 前の日が祝日だったら以降の処理はせずに終了する
-	if d.dayoff.dayOff {
-		log.Printf("previous day is dayoff: %s. finish task", d.dayoff.reason)
-		return mergeErr(nil, failedCodes)
+func (d *daily) tasks(codes []string) []dag.Task {
+	sp := d.dailyStockPrice
+	m := d.calculateDailyMovingAvgTrend
+	return []dag.Task{
+		{
+			// 日足株価のスクレイピングとDBへの書き込み
+			Name: saveStockPriceTask,
+			Once: true,
+			Run: func(ctx context.Context) error {
+				var e error
+				d.failedCodes, e = sp.saveStockPrice(ctx, codes, now())
+				d.ledger.setFailed(len(d.failedCodes))
+				return e
+			},
+		},
+		{
+			// 全部スクレイピングできていなかったら再度試みる
+			// - failedCodesの銘柄だけsaveStockPriceを実行し、それでも失敗したものをあらためてfailedCodesとする
+			// - 失敗した銘柄が残っていればエラーを返し、dagのRetryでもう一度試みる
+			Name:      retrySaveStockPriceTask,
+			DependsOn: []string{saveStockPriceTask},
+			SkipIf: func() (bool, string) {
+				return len(d.failedCodes) == 0, "no failed codes"
+			},
+			Retry: dag.Retry{Attempts: 2, Interval: retrySaveStockPriceInterval},
+			Run: func(ctx context.Context) error {
+				return d.retrySaveStockPrice(ctx, sp)
+			},
+		},
+		{
+			// 移動平均線とTrendの作成とDBへの書き込み
+			// 前の日が祝日だったら実行しない
+			// retrySaveStockPriceで失敗した銘柄が残っても成功した銘柄は計算したいので、DependsOnではなくAfterにする
+			// retrySaveStockPriceが終わってからfailedCodesを読む
+			Name:      calculateDailyMovingAvgTrendTask,
+			DependsOn: []string{saveStockPriceTask},
+			After:     []string{retrySaveStockPriceTask},
+			Once:      true,
+			SkipIf: func() (bool, string) {
+				return d.dayoff.dayOff, fmt.Sprintf("previous day is dayoff: %s", d.dayoff.reason)
+			},
+			Run: func(ctx context.Context) error {
+				// TODO: 最初に取得した株価が全部格納されているか確認したい
+
+				// 失敗した銘柄以外を抜き出す。全部失敗して一つも残らなかったらエラーで終了
+				targetCodes := filterSuccessCodes(codes, d.failedCodes)
+				if len(targetCodes) == 0 {
+					return errors.New("all codes failed in saveStockPrice")
+				}
+				// TODO: fromは、最後に書き込みが行われた時間を確認したうえで設定してもよさそう
+				return m.Exec(targetCodes)
+			},
+		},
 	}
+}
+
+// retrySaveStockPriceのリトライの間隔
+const retrySaveStockPriceInterval = 5 * time.Second
 
-	// この後の処理のために、失敗した銘柄以外を抜き出す。全部失敗して一つも残らなかったらエラーで終了
-	targetCodes := filterSuccessCodes(codes, failedCodes)
-	if len(targetCodes) == 0 {
-		return fmt.Errorf("all codes failed in saveStockPrice: %v", mergeErr(nil, failedCodes))
+// failedCodesの銘柄のsaveStockPriceを1回試みる。失敗した銘柄が残っていればその銘柄を含めたエラーを返す
+func (d *daily) retrySaveStockPrice(ctx context.Context, sp DailyStockPrice) error {
+	fcodes := failedCodesSlice(d.failedCodes) // failedCodesから銘柄のスライスを取得
+	if len(fcodes) == 0 {                     // 前回のretryで全部成功していれば終了
+		return nil
+	}
+	d.retryCnt++
+	d.ledger.addRetries(saveStockPriceTask, 1)
+	log.Printf("retry: %d. trying to fetch stockprice for failed codes: %v", d.retryCnt, fcodes)
+	start := now()
+	newFailedCodes, err := sp.saveStockPrice(ctx, fcodes, now())
+	d.status.InsertStatus(fmt.Sprintf("saveStockPrice_retry%d", d.retryCnt), now(), now().Sub(start)) // now().Sub(start)で所要時間も入れておく
+	log.Printf("retry: %d. failedCodes error: '%#v', saveStockPrice error: %v", d.retryCnt, newFailedCodes.Error(), err)
+	if err != nil {
+		// saveStockPrice自体が失敗した場合は、failedCodesは変わっていないものとする
+		return fmt.Errorf("saveStockPrice error: %v\n%v", err, d.failedCodes.Error())
 	}
 
-	// 移動平均線とTrendの作成とDBへの書き込み
-	// statusシートを見て本日分が未完了であれば実行する
-	m := d.calculateDailyMovingAvgTrend
-	if err := st.ExecIfIncompleteThisDay("calculateDailyMovingAvgTrend", now(), func() error {
-		// TODO: fromは、最後に書き込みが行われた時間を確認したうえで設定してもよさそう
-		return m.Exec(targetCodes)
-	}); err != nil {
-		return fmt.Errorf("failed to calculateDailyMovingAvgTrend: %v", mergeErr(err, failedCodes))
+	d.failedCodes = newFailedCodes // failedCodesを上書き
+	if len(d.failedCodes) != 0 {
+		return fmt.Errorf("%d codes still failed\n%v", len(d.failedCodes), d.failedCodes.Error())
 	}
+	return nil
+}
+
+// dagのTrackerとしてstatusを使う
+type statusTracker struct {
+	st status.Status
+}
+
+func (t statusTracker) IsDone(task string) (bool, error) {
+	return t.st.IsTaskDoneThisDay(task, now())
+}
 
-	return mergeErr(nil, failedCodes)
+func (t statusTracker) Record(task string, start time.Time, err error) error {
+	return t.st.Record(task, start, now(), err)
 }
 
 // 失敗した銘柄のスライスを返す関数
@@ -7,20 +7,35 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ludwig125/gke-stockprice/candlestick"
 	"github.com/ludwig125/gke-stockprice/database"
+	"github.com/ludwig125/gke-stockprice/screen"
 	"github.com/ludwig125/gke-stockprice/sheet"
 )
 
-// TODO: フィールド変数にする
-var maxContinuationDays = 11
-
 // CalculateDailyMovingAvgTrend is configuration to calculate movingavg and growth trend.
 type CalculateDailyMovingAvgTrend struct {
-	db                    database.DB
-	sheet                 sheet.Sheet
-	calcConcurrency       int
-	targetDate            string
-	longTermThresholdDays int // longTermThresholdDaysの期間ShortTermのTrendが続いていたらLongとみなす閾値
+	db              database.DB
+	sheet           sheet.Sheet
+	crossoverSheet  sheet.Sheet   // nilの場合はcrossoverをSheetに書き込まない
+	newHighsSheet   sheet.Sheet   // nilの場合は高値更新銘柄をSheetに書き込まない
+	highLowWeeks    int           // 高値、安値をとる期間(週)。0の場合はdefaultHighLowWeeksを使う
+	summary         *SlackSummary // nilの場合はSlackに通知しない
+	calcConcurrency int
+	targetDate      string
+	movingAvgPairs  []MovingAvgPair        // crossoverを検出する移動平均線の組み合わせ
+	trendParams     TrendParams            // 0値のフィールドはdefaultTrendParamsの値を使う
+	screens         []screen.Screen        // スクリーニングの条件
+	screenSheets    map[string]sheet.Sheet // スクリーニングの名前と結果を書き込むSheetのMap
+	summarySheets   map[string]sheet.Sheet // trendSummaryTabsの名前と書き込むSheetのMap
+	watchlists      []Watchlist
+	watchlistSheets map[string]sheet.Sheet     // watchlistの名前と書き込むSheetのMap
+	watchlistSlack  func(channel string) Slack // nilの場合はwatchlistごとのchannelに通知しない
+	historySheet    sheet.Sheet                // nilの場合はwatchlistの銘柄のtrendの履歴を書き込まない
+	sparklineSheet  sheet.Sheet                // nilの場合はwatchlistの銘柄の終値の推移を書き込まない
+	sparklineDays   int                        // 終値の推移を表示する営業日数。0の場合はdefaultSparklineDays
+	multiTimeframe  bool                       // 週足、月足のmovingavgとtrendも計算する
+	checkpoint      *Checkpoint                // nilの場合は再実行時も全銘柄のmovingavgとtrendを計算する
 }
 
 // Exec calculates daily movingavg and trend, then write db and sheet.
@@ -32,15 +47,24 @@ func (c CalculateDailyMovingAvgTrend) Exec(codes []string) error {
 	fromDate := targetDate.AddDate(0, 0, -100).Format("2006/01/02")
 
 	config := CalcMovingTrendConfig{
-		DB:             c.db,
-		DailyTable:     "daily",
-		MovingAvgTable: "movingavg",
-		TrendTable:     "trend",
-		Codes:          codes,
-		FromDate:       fromDate,
-		ToDate:         c.targetDate,
-		MaxConcurrency: c.calcConcurrency,
-		// TODO: LongTermThresholdDaysも環境変数から指定する
+		DB:               c.db,
+		DailyTable:       "daily",
+		MovingAvgTable:   "movingavg",
+		TrendTable:       "trend",
+		VolatilityTable:  "volatility",
+		VolumeTable:      "volume",
+		CrossoverTable:   "crossover_events",
+		HighLowTable:     "highlow",
+		HighLowWeeks:     c.highLowWeeks,
+		PatternsTable:    patternsTable,
+		MovingAvgPairs:   c.movingAvgPairs,
+		TrendParams:      c.trendParams,
+		TrendParamsTable: "trend_params",
+		Codes:            codes,
+		FromDate:         fromDate,
+		ToDate:           c.targetDate,
+		MaxConcurrency:   c.calcConcurrency,
+		Checkpoint:       c.checkpoint,
 	}
 	calc, err := NewCalcMovingTrend(config)
 	if err != nil {
@@ -50,10 +74,47 @@ func (c CalculateDailyMovingAvgTrend) Exec(codes []string) error {
 		return fmt.Errorf("failed to Exec: %w", err)
 	}
 
+	if c.multiTimeframe {
+		for _, tf := range []timeframe{weekly, monthly} {
+			if err := calcTimeframeMovingTrend(c.db, tf, codes, c.targetDate, c.calcConcurrency, c.trendParams); err != nil {
+				return fmt.Errorf("failed to calcTimeframeMovingTrend %s: %w", tf.name, err)
+			}
+		}
+	}
+
+	// 全銘柄のtrendと騰落を集計する
+	// 52週高値(安値)の更新はcalc.Execで書き込んだhighlowのhighLowEventで数える
+	b, err := calcBreadth(c.db, "trend", "highlow", "breadth", codes, c.targetDate)
+	if err != nil {
+		return fmt.Errorf("failed to calcBreadth: %w", err)
+	}
+	c.summary.Add(b.slackMsg())
+
+	// 全銘柄の中でのgrowthRateや騰落率の順位を計算する
+	if err := calcRanking(c.db, "trend", "ranking", codes, c.targetDate); err != nil {
+		return fmt.Errorf("failed to calcRanking: %w", err)
+	}
+
 	// 最新のTrendをSpreadsheetに書き込む
 	if err := c.writeSheet(codes, c.targetDate); err != nil {
 		return fmt.Errorf("failed to writeSheet: %w", err)
 	}
+
+	// 当日のcrossoverをSpreadsheetとSlackに出す
+	if err := c.writeCrossover(codes, c.targetDate); err != nil {
+		return fmt.Errorf("failed to writeCrossover: %w", err)
+	}
+
+	// 当日検出したローソク足のパターンをSlackに出す
+	codeDatePatterns, err := fetchCodeDatePatterns(c.db, patternsTable, codes, c.targetDate, c.targetDate)
+	if err != nil {
+		return fmt.Errorf("failed to fetchCodeDatePatterns: %w", err)
+	}
+	codePatterns := make(map[string][]candlestick.Pattern, len(codeDatePatterns))
+	for code, dps := range codeDatePatterns {
+		codePatterns[code] = dps[c.targetDate]
+	}
+	c.summary.Add(createPatternsSlackMsg(c.targetDate, codePatterns))
 	return nil
 }
 
@@ -62,14 +123,217 @@ func (c CalculateDailyMovingAvgTrend) writeSheet(codes []string, date string) er
 	if err != nil {
 		return fmt.Errorf("failed to fetchTrendList: %v", err)
 	}
-	sheetData := makeTrendDataForSheet(convCodeTrendList(codeTrendList, date))
+	volumeSpikes, err := fetchVolumeSpikes(c.db, "volume", codes, date)
+	if err != nil {
+		return fmt.Errorf("failed to fetchVolumeSpikes: %v", err)
+	}
+	codeRanks, err := fetchRankings(c.db, "ranking", codes, date)
+	if err != nil {
+		return fmt.Errorf("failed to fetchRankings: %v", err)
+	}
+	ctl := convCodeTrendList(codeTrendList, date)
+	for i := range ctl {
+		ctl[i].volumeSpike = volumeSpikes[ctl[i].code]
+		ctl[i].ranks = codeRanks[ctl[i].code]
+	}
+	if c.multiTimeframe {
+		if err := setMultiTimeframeTrend(c.db, ctl, codes, date); err != nil {
+			return fmt.Errorf("failed to setMultiTimeframeTrend: %v", err)
+		}
+	}
+	sheetData := makeTrendDataForSheet(ctl)
 	log.Println("try to print trend to sheet")
 	if err := c.sheet.Update(sheetData); err != nil {
 		return fmt.Errorf("failed to print trend data to sheet: %w", err)
 	}
+	if err := formatTrendSheet(c.sheet); err != nil {
+		return fmt.Errorf("failed to formatTrendSheet: %w", err)
+	}
+
+	// 当日のtrendから抜き出したものをそれぞれのタブに書き込む
+	if err := c.writeSummarySheets(ctl, date); err != nil {
+		return fmt.Errorf("failed to writeSummarySheets: %w", err)
+	}
+
+	// 高値を更新した銘柄を別のSheetに書き込む
+	if err := c.writeNewHighs(ctl, codes, date); err != nil {
+		return fmt.Errorf("failed to writeNewHighs: %w", err)
+	}
+
+	// スクリーニングの条件に合致した銘柄をそれぞれのSheetに書き込む
+	if err := c.writeScreens(ctl, codes, date); err != nil {
+		return fmt.Errorf("failed to writeScreens: %w", err)
+	}
+
+	// watchlistの銘柄をそれぞれのSheetに書き込み、Slackに通知する
+	c.writeWatchlists(ctl, date)
+
+	// watchlistの銘柄の当日のtrendを履歴に追加し、終値の推移を書き込む
+	if err := c.writeTrendHistory(ctl, date); err != nil {
+		return fmt.Errorf("failed to writeTrendHistory: %w", err)
+	}
+	return nil
+}
+
+func (c CalculateDailyMovingAvgTrend) writeSummarySheets(ctl []codeDateTrendList, date string) error {
+	for _, t := range trendSummaryTabs {
+		sh, ok := c.summarySheets[t.name]
+		if !ok {
+			continue
+		}
+		sheetData := trendRowsForSheet(t.extract(ctl))
+		if len(sheetData) == 0 { // 該当する銘柄がなくてもカラム名と日付は書き込む
+			sheetData = [][]string{append(sheetColumnName(), strings.Replace(date, "/", "", -1))}
+		}
+		log.Printf("try to print %s to sheet", t.name)
+		if err := sh.Update(sheetData); err != nil {
+			return fmt.Errorf("failed to print %s to sheet: %w", t.name, err)
+		}
+		if err := formatTrendSheet(sh); err != nil {
+			return fmt.Errorf("failed to formatTrendSheet %s: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+func (c CalculateDailyMovingAvgTrend) writeNewHighs(ctl []codeDateTrendList, codes []string, date string) error {
+	if c.newHighsSheet == nil {
+		return nil
+	}
+	codeValues, err := fetchCodeValues(c.db, "highlow", []string{"rollingHigh", "distanceToHigh", "highLowEvent"}, codes, date)
+	if err != nil {
+		return fmt.Errorf("failed to fetchCodeValues: %v", err)
+	}
+	log.Println("try to print new highs to sheet")
+	if err := c.newHighsSheet.Update(makeNewHighsDataForSheet(ctl, codeValues, date)); err != nil {
+		return fmt.Errorf("failed to print new highs to sheet: %w", err)
+	}
 	return nil
 }
 
+// 高値を更新した銘柄だけをbreakout, newHighの順に、それぞれ高値に近い順に並べる
+func makeNewHighsDataForSheet(ctl []codeDateTrendList, codeValues map[string]map[string]float64, date string) [][]string {
+	type codeNewHigh struct {
+		t              codeDateTrendList
+		event          HighLowEvent
+		high           float64
+		distanceToHigh float64
+	}
+	var newHighs []codeNewHigh
+	for _, t := range ctl {
+		v, ok := codeValues[t.code]
+		if !ok {
+			continue
+		}
+		if e := HighLowEvent(v["highLowEvent"]); e == newHigh || e == breakout {
+			newHighs = append(newHighs, codeNewHigh{t: t, event: e, high: v["rollingHigh"], distanceToHigh: v["distanceToHigh"]})
+		}
+	}
+	sort.Slice(newHighs, func(i, j int) bool {
+		if newHighs[i].event != newHighs[j].event {
+			return newHighs[i].event > newHighs[j].event
+		}
+		if newHighs[i].distanceToHigh != newHighs[j].distanceToHigh {
+			return newHighs[i].distanceToHigh > newHighs[j].distanceToHigh
+		}
+		return newHighs[i].t.code < newHighs[j].t.code
+	})
+
+	// spreadsheetの最初の行にはカラム名と日付を記載する
+	newHighsData := [][]string{{"code", "highLowEvent", "rollingHigh", "distanceToHigh", "trend", "generalTrend", strings.Replace(date, "/", "", -1)}}
+	for _, n := range newHighs {
+		newHighsData = append(newHighsData, []string{
+			n.t.code,
+			n.event.String(),
+			fmt.Sprintf("%g", n.high),
+			fmt.Sprintf("%.4g", n.distanceToHigh),
+			n.t.trend.String(),
+			n.t.generalTrend.String(),
+		})
+	}
+	return newHighsData
+}
+
+func (c CalculateDailyMovingAvgTrend) writeScreens(ctl []codeDateTrendList, codes []string, date string) error {
+	if len(c.screens) == 0 {
+		return nil
+	}
+	envs, err := buildScreenEnvs(c.db, c.screens, codes, date)
+	if err != nil {
+		return fmt.Errorf("failed to buildScreenEnvs: %v", err)
+	}
+	for _, s := range c.screens {
+		matched := make(map[string]bool)
+		for _, code := range screenCodes(s, envs) {
+			matched[code] = true
+		}
+		var screened []codeDateTrendList
+		for _, t := range ctl {
+			if matched[t.code] {
+				screened = append(screened, t)
+			}
+		}
+		c.summary.Add(fmt.Sprintf("screen %s %s: %d銘柄", s.Name, date, len(screened)))
+
+		sh, ok := c.screenSheets[s.Name]
+		if !ok {
+			continue
+		}
+		sheetData := makeTrendDataForSheet(screened)
+		if len(sheetData) == 0 { // 合致する銘柄がなくてもカラム名と日付は書き込む
+			sheetData = [][]string{append(sheetColumnName(), strings.Replace(date, "/", "", -1))}
+		}
+		log.Printf("try to print screen %s to sheet", s.Name)
+		if err := sh.Update(sheetData); err != nil {
+			return fmt.Errorf("failed to print screen %s to sheet: %w", s.Name, err)
+		}
+		if err := formatTrendSheet(sh); err != nil {
+			return fmt.Errorf("failed to formatTrendSheet screen %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+func (c CalculateDailyMovingAvgTrend) writeCrossover(codes []string, date string) error {
+	codeEvents, err := fetchCrossoverEvents(c.db, "crossover_events", codes, date)
+	if err != nil {
+		return fmt.Errorf("failed to fetchCrossoverEvents: %v", err)
+	}
+	c.summary.Add(createCrossoverSlackMsg(date, codeEvents))
+
+	if c.crossoverSheet == nil {
+		return nil
+	}
+	log.Println("try to print crossover to sheet")
+	if err := c.crossoverSheet.Update(makeCrossoverDataForSheet(codeEvents, date)); err != nil {
+		return fmt.Errorf("failed to print crossover data to sheet: %w", err)
+	}
+	return nil
+}
+
+// pair, crossover, codeの順にソートする
+func makeCrossoverDataForSheet(codeEvents map[string][]CrossoverEvent, date string) [][]string {
+	var rows [][]string
+	for code, events := range codeEvents {
+		for _, e := range events {
+			rows = append(rows, []string{code, e.Pair.String(), e.Crossover.String()})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i][1] != rows[j][1] {
+			return rows[i][1] < rows[j][1]
+		}
+		if rows[i][2] != rows[j][2] {
+			return rows[i][2] > rows[j][2] // goldenCrossを先にする
+		}
+		return rows[i][0] < rows[j][0]
+	})
+
+	// spreadsheetの最初の行にはカラム名と日付を記載する
+	crossoverData := [][]string{{"code", "pair", "crossover", strings.Replace(date, "/", "", -1)}}
+	return append(crossoverData, rows...)
+}
+
 type codeDateTrendList struct {
 	code             string
 	date             string
@@ -78,20 +342,37 @@ type codeDateTrendList struct {
 	growthRate       float64          // 前営業日の終値/前々営業日の終値
 	crossMoving5     CrossMoving5Type // ２つの終値が５日移動平均線をどの向きにまたいでいるか
 	continuationDays int              // 同じ傾向のGrowthが連続何日続くか
+	generalTrend     GeneralTrend     // trend, trendTurn, growthRate, crossMoving5から判断した売買局面
+	volumeSpike      bool             // 売買高が急増しているか
+
+	multiTimeframeTrend MultiTimeframeTrend // 日足、週足、月足のtrendの組み合わせ
+	ranks               map[string]int      // rankingMetricsごとの全銘柄の中での順位
 }
 
 func (c codeDateTrendList) stringForSheet() []string {
-	return []string{
+	s := []string{
 		c.code,
 		c.trend.String(),
 		c.trendTurn.String(),
 		fmt.Sprintf("%.4g", c.growthRate),
 		c.crossMoving5.String(),
 		fmt.Sprintf("%d", c.continuationDays),
+		c.generalTrend.String(),
+		fmt.Sprintf("%t", c.volumeSpike),
+		c.multiTimeframeTrend.String(),
 	}
+	for _, m := range rankingMetrics {
+		rank, ok := c.ranks[m]
+		if !ok { // 順位がない場合は空欄にする
+			s = append(s, "")
+			continue
+		}
+		s = append(s, fmt.Sprintf("%d", rank))
+	}
+	return s
 }
 
-//codeDateTrendList のSliceに変換
+// codeDateTrendList のSliceに変換
 func convCodeTrendList(t map[string]TrendList, date string) []codeDateTrendList {
 	ctl := make([]codeDateTrendList, 0, len(t))
 	for code, tl := range t {
@@ -103,6 +384,7 @@ func convCodeTrendList(t map[string]TrendList, date string) []codeDateTrendList
 			growthRate:       tl.growthRate,
 			crossMoving5:     tl.crossMoving5,
 			continuationDays: tl.continuationDays,
+			generalTrend:     tl.generalTrend,
 		})
 	}
 	return ctl
@@ -118,6 +400,11 @@ func makeTrendDataForSheet(trends []codeDateTrendList) [][]string {
 	// growthRate順をなるべく保ちつつ、trend順にソート(stable sort)
 	sort.SliceStable(trends, func(i, j int) bool { return trends[i].trend > trends[j].trend })
 
+	return trendRowsForSheet(trends)
+}
+
+// 並び順は変えずにSheetに書き込む形にする
+func trendRowsForSheet(trends []codeDateTrendList) [][]string {
 	var trendData [][]string
 	first := 0
 	for _, c := range trends {
@@ -134,14 +421,21 @@ func makeTrendDataForSheet(trends []codeDateTrendList) [][]string {
 }
 
 func sheetColumnName() []string {
-	return []string{
+	columns := []string{
 		"code",
 		"trend",
 		"trendTurn",
 		"growthRate",
 		"crossMoving5",
 		"continuationDays",
+		"generalTrend",
+		"volumeSpike",
+		"multiTimeframeTrend",
+	}
+	for _, m := range rankingMetrics {
+		columns = append(columns, m+"Rank")
 	}
+	return columns
 }
 
 // // TrendTable has several types of trends.
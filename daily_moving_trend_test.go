@@ -126,11 +126,11 @@ func TestGrowthTrend(t *testing.T) {
 			}
 
 			calc := CalculateDailyMovingAvgTrend{
-				db:                    db,
-				sheet:                 trendSheet,
-				calcConcurrency:       3,
-				targetDate:            targetDateStr,
-				longTermThresholdDays: 2,
+				db:              db,
+				sheet:           trendSheet,
+				calcConcurrency: 3,
+				targetDate:      targetDateStr,
+				trendParams:     TrendParams{LongTermThresholdDays: 2},
 			}
 			if err := calc.Exec(codes); err != nil {
 				t.Errorf("failed to Exec: %v", err)
@@ -146,20 +146,21 @@ func TestGrowthTrend(t *testing.T) {
 			}
 
 			// 以下の形になるはず
-			// [code trend trendTurn growthRate crossMoving5 continuationDays 20201220]
-			// [1015 longTermAdvance upwardTurn 1.093 upwardCross 10]
-			// [1011 longTermAdvance noTurn 1.001 noCross 10]
-			// [1020 shortTermAdvance upwardTurn 1.002 upwardCross 1]
-			// [1014 shortTermAdvance noTurn 1.001 noCross 10]
-			// [1023 non upwardTurn 1.011 noCross 3]
-			// [1019 non upwardTurn 1.002 noCross 6]
-			// [1017 non noTurn 0.9991 noCross 10]
-			// [1018 non downwardTurn 0.9982 noCross 6]
-			// [1022 non downwardTurn 0.9907 noCross 3]
-			// [1013 shortTermDecline noTurn 0.999 noCross 10]
-			// [1021 shortTermDecline downwardTurn 0.998 downwardCross 1]
-			// [1012 longTermDecline noTurn 0.9989 noCross 10]
-			// [1016 longTermDecline downwardTurn 0.8914 downwardCross 10]
+			// rankの列(growthRateRank returnNRank continuationDaysRank)は省略
+			// [code trend trendTurn growthRate crossMoving5 continuationDays generalTrend volumeSpike multiTimeframeTrend 20201220]
+			// [1015 longTermAdvance upwardTurn 1.093 upwardCross 10 veryStrongBuy false unknownTimeframe]
+			// [1011 longTermAdvance noTurn 1.001 noCross 10 buy false unknownTimeframe]
+			// [1020 shortTermAdvance upwardTurn 1.002 upwardCross 1 veryStrongBuy false unknownTimeframe]
+			// [1014 shortTermAdvance noTurn 1.001 noCross 10 buy false unknownTimeframe]
+			// [1023 non upwardTurn 1.011 noCross 3 weakBuy false unknownTimeframe]
+			// [1019 non upwardTurn 1.002 noCross 6 weakBuy false unknownTimeframe]
+			// [1017 non noTurn 0.9991 noCross 10 neutral false unknownTimeframe]
+			// [1018 non downwardTurn 0.9982 noCross 6 weakSell false unknownTimeframe]
+			// [1022 non downwardTurn 0.9907 noCross 3 weakSell false unknownTimeframe]
+			// [1013 shortTermDecline noTurn 0.999 noCross 10 sell false unknownTimeframe]
+			// [1021 shortTermDecline downwardTurn 0.998 downwardCross 1 veryStrongSell false unknownTimeframe]
+			// [1012 longTermDecline noTurn 0.9989 noCross 10 sell false unknownTimeframe]
+			// [1016 longTermDecline downwardTurn 0.8914 downwardCross 10 veryStrongSell false unknownTimeframe]
 			if !reflect.DeepEqual(gotCodes, tc.wantCode) {
 				t.Errorf("gotCodes: %v, wantCodes: %v", gotCodes, tc.wantCode)
 			}
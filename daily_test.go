@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/ludwig125/gke-stockprice/dag"
 	//_ "github.com/go-sql-driver/mysql"
 	"github.com/pkg/errors"
 )
@@ -63,3 +66,113 @@ func TestFilterSuccessCodes(t *testing.T) {
 		})
 	}
 }
+
+func TestDailyTasks(t *testing.T) {
+	d := &daily{dayoff: DayOff{dayOff: true, reason: "holiday"}}
+	g, err := dag.New(append([]dag.Task{restructureTask(nil, nil), backupTask()}, d.tasks(nil)...)...)
+	if err != nil {
+		t.Fatalf("failed to dag.New: %v", err)
+	}
+	wantNames := []string{"restructureTablesFromDaily", "saveStockPrice", "retrySaveStockPrice", "calculateDailyMovingAvgTrend", "backupMySQL"}
+	if got := g.Names(); !reflect.DeepEqual(got, wantNames) {
+		t.Errorf("got: %v, want: %v", got, wantNames)
+	}
+
+	skips := make(map[string]bool)
+	for _, task := range d.tasks(nil) {
+		if task.SkipIf != nil {
+			skips[task.Name], _ = task.SkipIf()
+		}
+	}
+	// failedCodesがなければretryせず、前日が休日なら移動平均を計算しない
+	wantSkips := map[string]bool{"retrySaveStockPrice": true, "calculateDailyMovingAvgTrend": true}
+	if !reflect.DeepEqual(skips, wantSkips) {
+		t.Errorf("got: %v, want: %v", skips, wantSkips)
+	}
+}
+
+func TestDailyTasksRetry(t *testing.T) {
+	d := &daily{}
+	tasks := d.tasks(nil)
+	// saveStockPriceのretryはdagのRetryで試みる
+	if got := tasks[1].Retry.Attempts; tasks[1].Name != retrySaveStockPriceTask || got != 2 {
+		t.Errorf("got %s attempts: %d, want %s attempts: 2", tasks[1].Name, got, retrySaveStockPriceTask)
+	}
+
+	// failedCodesはretrySaveStockPriceが終わってから読む
+	if got := tasks[2].After; tasks[2].Name != calculateDailyMovingAvgTrendTask || !reflect.DeepEqual(got, []string{retrySaveStockPriceTask}) {
+		t.Errorf("got %s after: %v, want %s after: %v", tasks[2].Name, got, calculateDailyMovingAvgTrendTask, []string{retrySaveStockPriceTask})
+	}
+
+	// retrySaveStockPriceで失敗した銘柄が残っても、成功した銘柄の移動平均は計算する
+	var runs []string
+	for i := range tasks {
+		name := tasks[i].Name
+		tasks[i].SkipIf = nil
+		tasks[i].Retry.Interval = time.Microsecond
+		tasks[i].Run = func(ctx context.Context) error {
+			runs = append(runs, name)
+			if name == retrySaveStockPriceTask {
+				return errors.New("1 codes still failed")
+			}
+			return nil
+		}
+	}
+	// 渡す順番によらずretrySaveStockPriceの後に移動平均を計算する
+	g, err := dag.New(tasks[0], tasks[2], tasks[1])
+	if err != nil {
+		t.Fatalf("failed to dag.New: %v", err)
+	}
+	states, err := g.Run(context.Background(), nil)
+	if err == nil {
+		t.Error("want error of retrySaveStockPrice")
+	}
+	wantRuns := []string{"saveStockPrice", "retrySaveStockPrice", "retrySaveStockPrice", "calculateDailyMovingAvgTrend"}
+	if !reflect.DeepEqual(runs, wantRuns) {
+		t.Errorf("got runs: %v, want: %v", runs, wantRuns)
+	}
+	if s := states[calculateDailyMovingAvgTrendTask]; s != dag.Succeeded {
+		t.Errorf("got %s: %s, want: succeeded", calculateDailyMovingAvgTrendTask, s)
+	}
+}
+
+func TestMergeErr(t *testing.T) {
+	failedCodes := FailedCodes{FailedCode{err: errors.New("90000 error"), code: "90000"}}
+	tests := map[string]struct {
+		err         error
+		failedCodes FailedCodes
+		reported    bool
+		want        string
+	}{
+		"no_error": {
+			want: "",
+		},
+		"failed_codes_only": {
+			failedCodes: failedCodes,
+			want:        "code: 90000, error: 90000 error\n",
+		},
+		"error_and_failed_codes": {
+			err:         errors.New("failed to backupMySQL: error"),
+			failedCodes: failedCodes,
+			want:        "failed to backupMySQL: error\ncode: 90000, error: 90000 error\n",
+		},
+		"failed_codes_already_reported": {
+			err:         errors.New("failed to retrySaveStockPrice: 1 codes still failed\ncode: 90000, error: 90000 error\n"),
+			failedCodes: failedCodes,
+			reported:    true,
+			want:        "failed to retrySaveStockPrice: 1 codes still failed\ncode: 90000, error: 90000 error\n",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := mergeErr(tc.err, tc.failedCodes, tc.reported)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tc.want {
+				t.Errorf("got: %q, want: %q", got, tc.want)
+			}
+		})
+	}
+}
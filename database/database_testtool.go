@@ -125,7 +125,128 @@ func createTestTable(db *sql.DB) error {
 		growthRate DOUBLE,
 		crossMoving5 TINYINT(10),
 		continuationDays TINYINT(20),
+		generalTrend TINYINT(10),
+		paramsVersion VARCHAR(20),
 		PRIMARY KEY( code, date )
+	)`,
+		"stockprice_dev.volatility": `stockprice_dev.volatility (
+		code VARCHAR(10) NOT NULL,
+		date VARCHAR(10) NOT NULL,
+		bollingerUpper DOUBLE,
+		bollingerMiddle DOUBLE,
+		bollingerLower DOUBLE,
+		percentB DOUBLE,
+		bandwidth DOUBLE,
+		atr DOUBLE,
+		historicalVolatility DOUBLE,
+		squeeze TINYINT(1),
+		bandBreakout TINYINT(10),
+		PRIMARY KEY( code, date )
+	)`,
+		"stockprice_dev.volume": `stockprice_dev.volume (
+		code VARCHAR(10) NOT NULL,
+		date VARCHAR(10) NOT NULL,
+		volumeMovingAvg5 DOUBLE,
+		volumeMovingAvg20 DOUBLE,
+		obv DOUBLE,
+		volumeRatio DOUBLE,
+		volumeZScore DOUBLE,
+		volumeSpike TINYINT(1),
+		PRIMARY KEY( code, date )
+	)`,
+		"stockprice_dev.crossover_events": `stockprice_dev.crossover_events (
+		code VARCHAR(10) NOT NULL,
+		date VARCHAR(10) NOT NULL,
+		pair VARCHAR(20) NOT NULL,
+		crossover TINYINT(10),
+		PRIMARY KEY( code, date, pair )
+	)`,
+		"stockprice_dev.patterns": `stockprice_dev.patterns (
+		code VARCHAR(10) NOT NULL,
+		date VARCHAR(10) NOT NULL,
+		pattern VARCHAR(30) NOT NULL,
+		PRIMARY KEY( code, date, pattern )
+	)`,
+		"stockprice_dev.ranking": `stockprice_dev.ranking (
+		code VARCHAR(10) NOT NULL,
+		date VARCHAR(10) NOT NULL,
+		metric VARCHAR(20) NOT NULL,
+		value DOUBLE,
+		position INT,
+		percentile DOUBLE,
+		universe INT,
+		PRIMARY KEY( code, date, metric )
+	)`,
+		"stockprice_dev.task_status": `stockprice_dev.task_status (
+		task VARCHAR(100) NOT NULL,
+		run_id VARCHAR(30) NOT NULL,
+		started_at DATETIME NOT NULL,
+		finished_at DATETIME NOT NULL,
+		duration DOUBLE,
+		result VARCHAR(20),
+		error TEXT,
+		PRIMARY KEY( task, run_id, started_at ),
+		INDEX( task, result, finished_at )
+	)`,
+		"stockprice_dev.checkpoint": `stockprice_dev.checkpoint (
+		run_date VARCHAR(10) NOT NULL,
+		step VARCHAR(50) NOT NULL,
+		code VARCHAR(10) NOT NULL,
+		finished_at DATETIME NOT NULL,
+		PRIMARY KEY( run_date, step, code )
+	)`,
+		"stockprice_dev.runs": `stockprice_dev.runs (
+		run_id VARCHAR(30) NOT NULL,
+		started_at DATETIME NOT NULL,
+		finished_at DATETIME NOT NULL,
+		env VARCHAR(10),
+		target_date VARCHAR(10),
+		result VARCHAR(20),
+		codes_attempted INT,
+		codes_succeeded INT,
+		codes_failed INT,
+		codes_quarantined INT,
+		rows_submitted TEXT,
+		steps TEXT,
+		error TEXT,
+		PRIMARY KEY( run_id ),
+		INDEX( started_at )
+	)`,
+		"stockprice_dev.highlow": `stockprice_dev.highlow (
+		code VARCHAR(10) NOT NULL,
+		date VARCHAR(10) NOT NULL,
+		rollingHigh DOUBLE,
+		rollingLow DOUBLE,
+		distanceToHigh DOUBLE,
+		distanceToLow DOUBLE,
+		highLowEvent TINYINT(10),
+		PRIMARY KEY( code, date )
+	)`,
+		"stockprice_dev.trend_params": `stockprice_dev.trend_params (
+		version VARCHAR(20) NOT NULL,
+		classifier VARCHAR(20),
+		longTermThresholdDays INT,
+		maxContinuationDays INT,
+		PRIMARY KEY( version )
+	)`,
+		"stockprice_dev.breadth": `stockprice_dev.breadth (
+		date VARCHAR(10) NOT NULL,
+		longTermAdvance INT,
+		shortTermAdvance INT,
+		non INT,
+		shortTermDecline INT,
+		longTermDecline INT,
+		upwardTurn INT,
+		downwardTurn INT,
+		upwardCross INT,
+		downwardCross INT,
+		newHighs INT,
+		newLows INT,
+		advances INT,
+		declines INT,
+		unchanged INT,
+		advanceDeclineRatio DOUBLE,
+		PRIMARY KEY( date )
 	)`}
 	for table, ddl := range tables {
 		log.Printf("drop TestTable: %s if exists", table)
@@ -137,6 +258,19 @@ func createTestTable(db *sql.DB) error {
 			return fmt.Errorf("failed to create TestTable: %v", err)
 		}
 	}
+
+	// 週足、月足のtableは日足と同じカラムにする
+	for _, tf := range []string{"weekly", "monthly"} {
+		for _, base := range []string{"daily", "movingavg", "trend"} {
+			table := fmt.Sprintf("stockprice_dev.%s_%s", base, tf)
+			if _, err := db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", table)); err != nil {
+				return fmt.Errorf("failed to drop TestTable: %v", err)
+			}
+			if _, err := db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s LIKE stockprice_dev.%s", table, base)); err != nil {
+				return fmt.Errorf("failed to create TestTable: %v", err)
+			}
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// trendなどの各状態の日から何営業日か後までの騰落率を集計して、その状態に予測力があるかを確認する
+
+var defaultForwardReturnHorizons = []int{1, 5, 20}
+
+// 集計する状態(trend tableのカラム)と、値を名前に変換する関数
+var forwardReturnFeatures = []struct {
+	name   string
+	values func() []int // 値の大きい順
+	str    func(v int) string
+}{
+	{
+		name:   "trend",
+		values: func() []int { return descInts(int(unknown), int(longTermAdvance)) },
+		str:    func(v int) string { return Trend(v).String() },
+	},
+	{
+		name:   "trendTurn",
+		values: func() []int { return descInts(int(unknownTurn), int(upwardTurn)) },
+		str:    func(v int) string { return TrendTurnType(v).String() },
+	},
+	{
+		name:   "crossMoving5",
+		values: func() []int { return descInts(int(unknownCross), int(upwardCross)) },
+		str:    func(v int) string { return CrossMoving5Type(v).String() },
+	},
+}
+
+func descInts(min, max int) []int {
+	var vs []int
+	for v := max; v >= min; v-- {
+		vs = append(vs, v)
+	}
+	return vs
+}
+
+// ReturnStats is distribution of forward returns.
+type ReturnStats struct {
+	Count   int
+	Mean    float64
+	StdDev  float64
+	Min     float64
+	P25     float64
+	Median  float64
+	P75     float64
+	Max     float64
+	WinRate float64 // 騰落率が0より大きい割合
+}
+
+func calculateReturnStats(returns []float64) ReturnStats {
+	n := len(returns)
+	if n == 0 {
+		return ReturnStats{}
+	}
+	sorted := append([]float64{}, returns...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	var wins int
+	for _, r := range sorted {
+		sum += r
+		if r > 0 {
+			wins++
+		}
+	}
+	mean := sum / float64(n)
+	var sq float64
+	for _, r := range sorted {
+		sq += (r - mean) * (r - mean)
+	}
+	return ReturnStats{
+		Count:   n,
+		Mean:    mean,
+		StdDev:  math.Sqrt(sq / float64(n)),
+		Min:     sorted[0],
+		P25:     quantile(sorted, 0.25),
+		Median:  quantile(sorted, 0.5),
+		P75:     quantile(sorted, 0.75),
+		Max:     sorted[n-1],
+		WinRate: float64(wins) / float64(n),
+	}
+}
+
+// sortedは昇順。隣り合う値の間は線形補間する
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower))
+}
+
+// dateBarsは日付の降順で与えられる
+// 日付とhorizon営業日後の終値までの騰落率(%)のMapを返す。horizon営業日後のデータがない場合は含めない
+func calculateForwardReturns(dateBars []DateBar, horizons []int) map[string]map[int]float64 {
+	dateReturns := make(map[string]map[int]float64, len(dateBars))
+	for i, b := range dateBars {
+		if b.Close == 0 {
+			continue
+		}
+		returns := make(map[int]float64, len(horizons))
+		for _, h := range horizons {
+			if i-h < 0 {
+				continue
+			}
+			returns[h] = (dateBars[i-h].Close/b.Close - 1) * 100
+		}
+		dateReturns[b.Date] = returns
+	}
+	return dateReturns
+}
+
+type forwardReturnRow struct {
+	feature string
+	value   string
+	horizon int
+	stats   ReturnStats
+}
+
+// codeDateStatesはfetchCodeDateValuesで取得した銘柄、日付ごとのtrend tableの値
+// codeDateBarsは日付の降順で、codeDateStatesの期間よりhorizon営業日後までのデータが入っていることを期待する
+func evaluateForwardReturns(codeDateStates map[string]map[string]map[string]float64, codeDateBars map[string][]DateBar, horizons []int) []forwardReturnRow {
+	// feature, value, horizonごとの騰落率
+	returns := make(map[string]map[int]map[int][]float64)
+	for _, f := range forwardReturnFeatures {
+		returns[f.name] = make(map[int]map[int][]float64)
+	}
+	for code, dateStates := range codeDateStates {
+		dateReturns := calculateForwardReturns(codeDateBars[code], horizons)
+		for date, states := range dateStates {
+			rs, ok := dateReturns[date]
+			if !ok {
+				continue
+			}
+			for _, f := range forwardReturnFeatures {
+				v, ok := states[f.name]
+				if !ok {
+					continue
+				}
+				if _, ok := returns[f.name][int(v)]; !ok {
+					returns[f.name][int(v)] = make(map[int][]float64)
+				}
+				for h, r := range rs {
+					returns[f.name][int(v)][h] = append(returns[f.name][int(v)][h], r)
+				}
+			}
+		}
+	}
+
+	var rows []forwardReturnRow
+	for _, f := range forwardReturnFeatures {
+		for _, v := range f.values() {
+			for _, h := range horizons {
+				rows = append(rows, forwardReturnRow{
+					feature: f.name,
+					value:   f.str(v),
+					horizon: h,
+					stats:   calculateReturnStats(returns[f.name][v][h]),
+				})
+			}
+		}
+	}
+	return rows
+}
+
+func makeForwardReturnReport(rows []forwardReturnRow) [][]string {
+	report := [][]string{{"feature", "value", "horizon", "count", "mean", "stdDev", "min", "p25", "median", "p75", "max", "winRate"}}
+	for _, r := range rows {
+		s := r.stats
+		report = append(report, []string{
+			r.feature,
+			r.value,
+			fmt.Sprintf("%d", r.horizon),
+			fmt.Sprintf("%d", s.Count),
+			fmt.Sprintf("%.4g", s.Mean),
+			fmt.Sprintf("%.4g", s.StdDev),
+			fmt.Sprintf("%.4g", s.Min),
+			fmt.Sprintf("%.4g", s.P25),
+			fmt.Sprintf("%.4g", s.Median),
+			fmt.Sprintf("%.4g", s.P75),
+			fmt.Sprintf("%.4g", s.Max),
+			fmt.Sprintf("%.4g", s.WinRate),
+		})
+	}
+	return report
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trend, trendTurn, crossMoving5の値ごとに、その日から1/5/20営業日後までの騰落率の分布をCSVとSheetに出力する
+// classifyTrendのパラメータを調整する材料にする
+func execForwardReturn(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("forwardreturn", flag.ContinueOnError)
+	from := fs.String("from", now().AddDate(-1, 0, 0).Format("2006/01/02"), "from date. YYYY/MM/DD")
+	to := fs.String("to", now().Format("2006/01/02"), "to date. YYYY/MM/DD")
+	codesFlag := fs.String("codes", "", "comma separated codes. all codes in daily table if empty")
+	horizonsFlag := fs.String("horizons", "1,5,20", "comma separated days to measure forward returns")
+	out := fs.String("out", "forward_return.csv", "output CSV file")
+	sheetName := fs.String("sheet", "", "tab name of TREND_SHEETID to write the report. not written if empty")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %v", err)
+	}
+
+	horizons, err := parseHorizons(*horizonsFlag)
+	if err != nil {
+		return fmt.Errorf("failed to parseHorizons: %v", err)
+	}
+	toDate, err := time.Parse("2006/01/02", *to)
+	if err != nil {
+		return fmt.Errorf("failed to parse to date: %s, %v", *to, err)
+	}
+	// 期間の最後の日からもhorizon営業日後の終値がとれるように先まで取得する
+	barsTo := toDate.AddDate(0, 0, horizons[len(horizons)-1]*2+10).Format("2006/01/02")
+
+	db, err := getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to getDatabase: %v", err)
+	}
+	defer db.CloseDB()
+
+	codes := strToSlice(*codesFlag)
+	if *codesFlag == "" {
+		if codes, err = fetchDailyCodes(db); err != nil {
+			return fmt.Errorf("failed to fetchDailyCodes: %v", err)
+		}
+	}
+
+	codeDateStates, err := fetchCodeDateValues(db, "trend", []string{"trend", "trendTurn", "crossMoving5"}, codes, *from, *to)
+	if err != nil {
+		return fmt.Errorf("failed to fetchCodeDateValues: %v", err)
+	}
+	// 期間内にデータのない銘柄(上場前や上場廃止後など)は含めない
+	codeDateBars, err := fetchDailyBarsInBatches(db, codes, *from, barsTo)
+	if err != nil {
+		return fmt.Errorf("failed to fetchDailyBarsInBatches: %v", err)
+	}
+	report := makeForwardReturnReport(evaluateForwardReturns(codeDateStates, codeDateBars, horizons))
+	log.Printf("forward return evaluated. codes: %d, from-to: %s-%s, horizons: %v", len(codes), *from, *to, horizons)
+
+	if err := writeCSVFile(*out, report); err != nil {
+		return fmt.Errorf("failed to writeCSVFile: %v", err)
+	}
+	log.Printf("forward return report written: %s", *out)
+
+	if *sheetName == "" {
+		return nil
+	}
+	factory, err := newSheetFactory(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to newSheetFactory: %v", err)
+	}
+	if err := factory.sheet("TREND", *sheetName).Update(report); err != nil {
+		return fmt.Errorf("failed to print forward return report to sheet: %w", err)
+	}
+	log.Printf("forward return report written to sheet: %s", *sheetName)
+	return nil
+}
+
+// "1,5,20" のような文字列を昇順のintのSliceに変換する
+func parseHorizons(s string) ([]int, error) {
+	var horizons []int
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		h, err := strconv.Atoi(v)
+		if err != nil || h <= 0 {
+			return nil, fmt.Errorf("invalid horizon: '%s'", v)
+		}
+		if len(horizons) > 0 && h <= horizons[len(horizons)-1] {
+			return nil, fmt.Errorf("horizons must be in ascending order: '%s'", s)
+		}
+		horizons = append(horizons, h)
+	}
+	if len(horizons) == 0 {
+		return nil, fmt.Errorf("no horizon: '%s'", s)
+	}
+	return horizons, nil
+}
+
+func writeCSVFile(path string, records [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	cw := csv.NewWriter(f)
+	if err := cw.WriteAll(records); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return f.Close()
+}
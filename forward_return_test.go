@@ -0,0 +1,181 @@
+// +build !integration
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCalculateForwardReturns(t *testing.T) {
+	// 日付の降順
+	dateBars := []DateBar{
+		{Date: "2021/01/08", Close: 120},
+		{Date: "2021/01/07", Close: 110},
+		{Date: "2021/01/06", Close: 100},
+	}
+	pct := func(close, base float64) float64 { return (close/base - 1) * 100 }
+
+	got := calculateForwardReturns(dateBars, []int{1, 2})
+	want := map[string]map[int]float64{
+		"2021/01/08": {},
+		"2021/01/07": {1: pct(120, 110)},
+		"2021/01/06": {1: pct(110, 100), 2: pct(120, 100)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestCalculateReturnStats(t *testing.T) {
+	tests := map[string]struct {
+		returns []float64
+		want    ReturnStats
+	}{
+		"returns": {
+			returns: []float64{3, -1, 3, -1},
+			want:    ReturnStats{Count: 4, Mean: 1, StdDev: 2, Min: -1, P25: -1, Median: 1, P75: 3, Max: 3, WinRate: 0.5},
+		},
+		"interpolation": {
+			returns: []float64{1, 2},
+			want:    ReturnStats{Count: 2, Mean: 1.5, StdDev: 0.5, Min: 1, P25: 1.25, Median: 1.5, P75: 1.75, Max: 2, WinRate: 1},
+		},
+		"empty": {
+			returns: nil,
+			want:    ReturnStats{},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := calculateReturnStats(tc.returns); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %+v\nwant: %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateForwardReturns(t *testing.T) {
+	codeDateStates := map[string]map[string]map[string]float64{
+		"1001": {
+			"2021/01/06": {"trend": float64(longTermAdvance), "trendTurn": float64(upwardTurn), "crossMoving5": float64(upwardCross)},
+			"2021/01/07": {"trend": float64(longTermAdvance), "trendTurn": float64(noTurn), "crossMoving5": float64(noCross)},
+			"2021/01/08": {"trend": float64(longTermAdvance), "trendTurn": float64(noTurn), "crossMoving5": float64(noCross)}, // 翌営業日のデータがない
+		},
+		"1002": {
+			"2021/01/06": {"trend": float64(longTermDecline), "trendTurn": float64(downwardTurn), "crossMoving5": float64(downwardCross)},
+		},
+		"1003": { // 日足のデータがない
+			"2021/01/06": {"trend": float64(longTermAdvance), "trendTurn": float64(upwardTurn), "crossMoving5": float64(upwardCross)},
+		},
+	}
+	// 日付の降順
+	codeDateBars := map[string][]DateBar{
+		"1001": {{Date: "2021/01/08", Close: 121}, {Date: "2021/01/07", Close: 110}, {Date: "2021/01/06", Close: 100}},
+		"1002": {{Date: "2021/01/08", Close: 80}, {Date: "2021/01/07", Close: 90}, {Date: "2021/01/06", Close: 100}},
+	}
+
+	rows := evaluateForwardReturns(codeDateStates, codeDateBars, []int{1})
+	got := make(map[string]int)
+	for _, r := range rows {
+		got[r.feature+" "+r.value] = r.stats.Count
+	}
+	want := map[string]int{
+		"trend longTermAdvance":      2,
+		"trend shortTermAdvance":     0,
+		"trend non":                  0,
+		"trend shortTermDecline":     0,
+		"trend longTermDecline":      1,
+		"trend unknown":              0,
+		"trendTurn upwardTurn":       1,
+		"trendTurn noTurn":           1,
+		"trendTurn downwardTurn":     1,
+		"trendTurn unknownTurn":      0,
+		"crossMoving5 upwardCross":   1,
+		"crossMoving5 noCross":       1,
+		"crossMoving5 downwardCross": 1,
+		"crossMoving5 unknownCross":  0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v\nwant: %v", got, want)
+	}
+
+	// 値の大きい順に並ぶ
+	if rows[0].feature != "trend" || rows[0].value != "longTermAdvance" {
+		t.Errorf("first row: %+v", rows[0])
+	}
+	if s := rows[0].stats; !almostEqual(s.Mean, 10) || s.WinRate != 1 {
+		t.Errorf("longTermAdvance stats: %+v", s)
+	}
+
+	report := makeForwardReturnReport(rows)
+	if len(report) != len(rows)+1 || report[1][0] != "trend" || report[1][3] != "2" || report[1][4] != "10" {
+		t.Errorf("report: %v", report[:2])
+	}
+}
+
+func TestFetchDailyBarsInBatchesSkipsCodesWithoutData(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	db := newFakeDB([]string{"1001", "1002"}, 10, 0)
+	// 9999は期間内にデータがない(上場廃止など)
+	codeDateBars, err := fetchDailyBarsInBatches(db, []string{"1001", "9999", "1002"}, "2020/01/06", "2020/01/15")
+	if err != nil {
+		t.Fatalf("failed to fetchDailyBarsInBatches: %v", err)
+	}
+	if len(codeDateBars) != 2 || len(codeDateBars["1001"]) != 10 || len(codeDateBars["1002"]) != 10 {
+		t.Errorf("got codes: %d, 1001: %d bars, 1002: %d bars", len(codeDateBars), len(codeDateBars["1001"]), len(codeDateBars["1002"]))
+	}
+	if _, ok := codeDateBars["9999"]; ok {
+		t.Error("want no bars for 9999")
+	}
+}
+
+func TestParseHorizons(t *testing.T) {
+	tests := map[string]struct {
+		s       string
+		want    []int
+		wantErr bool
+	}{
+		"default":    {s: "1,5,20", want: []int{1, 5, 20}},
+		"spaces":     {s: " 1, 5 ,", want: []int{1, 5}},
+		"descending": {s: "5,1", wantErr: true},
+		"zero":       {s: "0", wantErr: true},
+		"empty":      {s: "", wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseHorizons(tc.s)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("gotErr: %v, wantErr: %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWriteCSVFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward_return")
+	if err != nil {
+		t.Fatalf("failed to TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "report.csv")
+	if err := writeCSVFile(path, [][]string{{"a", "b"}, {"1", "2,3"}}); err != nil {
+		t.Fatalf("failed to writeCSVFile: %v", err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to ReadFile: %v", err)
+	}
+	if want := "a,b\n1,\"2,3\"\n"; string(b) != want {
+		t.Errorf("got: %q, want: %q", string(b), want)
+	}
+}
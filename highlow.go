@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultHighLowWeeks = 52 // 高値、安値をとる期間(週)
+
+// CodeDateHighLows maps code and multiple DateHighLow.
+type CodeDateHighLows map[string][]DateHighLow
+
+// Slices converts CodeDateHighLows to double string slice.
+func (c CodeDateHighLows) Slices() [][]string {
+	trim := func(f float64) string {
+		return fmt.Sprintf("%g", f)
+	}
+	var highLowData [][]string
+	for code, dateHighLows := range c {
+		for _, h := range dateHighLows {
+			highLowData = append(highLowData, []string{
+				code,
+				h.Date,
+				trim(h.High),
+				trim(h.Low),
+				fmt.Sprintf("%.4g", h.DistanceToHigh),
+				fmt.Sprintf("%.4g", h.DistanceToLow),
+				fmt.Sprintf("%d", h.Event),
+			})
+		}
+	}
+	return highLowData
+}
+
+// DateHighLow has rolling high and low on a date.
+type DateHighLow struct {
+	Date           string
+	High           float64 // その日を含む期間内の高値の最大値
+	Low            float64 // その日を含む期間内の安値の最小値
+	DistanceToHigh float64 // 終値がHighから何%下にあるか(終値/High - 1)*100
+	DistanceToLow  float64 // 終値がLowから何%上にあるか(終値/Low - 1)*100
+	Event          HighLowEvent
+}
+
+// HighLowEvent is event of rolling high and low.
+type HighLowEvent int
+
+// 4: breakout : 終値が前日までの期間内の高値を上抜けた。抵抗線は別に求めず、期間内の高値を終値で超えたかで判定する
+// 3: newHigh : 高値が前日までの期間内の高値を更新した(終値は期間内の高値以下)
+// 2: noHighLowEvent
+// 1: newLow : 安値が前日までの期間内の安値を更新した
+// 0: unknownHighLowEvent : 期間の初日以前からのデータがない(上場して間もない銘柄など)
+
+const (
+	unknownHighLowEvent HighLowEvent = iota
+	newLow
+	noHighLowEvent
+	newHigh
+	breakout
+)
+
+// constのString変換メソッド
+func (h HighLowEvent) String() string {
+	return [5]string{"unknownHighLowEvent", "newLow", "noHighLowEvent", "newHigh", "breakout"}[h]
+}
+
+// fromDateより前の日付は期間内の高値、安値を計算するためだけに使い、結果には含めない
+func calculateCodeDateHighLows(codeDateBars map[string][]DateBar, weeks int, fromDate string) (map[string][]DateHighLow, error) {
+	cdhs := make(map[string][]DateHighLow, len(codeDateBars))
+	for code, dateBars := range codeDateBars {
+		dhs, err := calculateHighLow(dateBars, weeks, fromDate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculateHighLow: %v, code: %s", err, code)
+		}
+		cdhs[code] = dhs
+	}
+	return cdhs, nil
+}
+
+// dateBarsは日付の降順で与えられる
+// 最も古い足が期間の初日以前でなければ期間全体のデータがないので、Eventはunknownにする
+func calculateHighLow(dateBars []DateBar, weeks int, fromDate string) ([]DateHighLow, error) {
+	var dateHighLows []DateHighLow
+	for i, b := range dateBars {
+		if b.Date < fromDate {
+			break
+		}
+		t, err := time.Parse("2006/01/02", b.Date)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse date: %s, %v", b.Date, err)
+		}
+		windowStart := t.AddDate(0, 0, -weeks*7).Format("2006/01/02")
+
+		// 前日までの期間内の高値、安値
+		var priorHigh, priorLow float64
+		hasPrior := false
+		for _, p := range dateBars[i+1:] {
+			if p.Date <= windowStart {
+				break
+			}
+			if !hasPrior || p.High > priorHigh {
+				priorHigh = p.High
+			}
+			if !hasPrior || p.Low < priorLow {
+				priorLow = p.Low
+			}
+			hasPrior = true
+		}
+
+		h := DateHighLow{Date: b.Date, High: b.High, Low: b.Low}
+		if hasPrior {
+			if priorHigh > h.High {
+				h.High = priorHigh
+			}
+			if priorLow < h.Low {
+				h.Low = priorLow
+			}
+			if dateBars[len(dateBars)-1].Date <= windowStart {
+				h.Event = highLowEvent(b, priorHigh, priorLow)
+			}
+		}
+		if h.High != 0 {
+			h.DistanceToHigh = (b.Close/h.High - 1) * 100
+		}
+		if h.Low != 0 {
+			h.DistanceToLow = (b.Close/h.Low - 1) * 100
+		}
+		dateHighLows = append(dateHighLows, h)
+	}
+	return dateHighLows, nil
+}
+
+// 高値と安値を同時に更新した場合は高値を優先する
+func highLowEvent(b DateBar, priorHigh, priorLow float64) HighLowEvent {
+	switch {
+	case b.Close > priorHigh:
+		return breakout
+	case b.High > priorHigh:
+		return newHigh
+	case b.Low < priorLow:
+		return newLow
+	}
+	return noHighLowEvent
+}
+
+// 日付の降順のdateBarsからfromDate以降を返す
+func filterDateBarsFrom(dateBars []DateBar, fromDate string) []DateBar {
+	for i, b := range dateBars {
+		if b.Date < fromDate {
+			return dateBars[:i]
+		}
+	}
+	return dateBars
+}
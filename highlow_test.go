@@ -0,0 +1,134 @@
+// +build !integration
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCalculateHighLow(t *testing.T) {
+	// 日付の降順
+	dateBars := []DateBar{
+		{Date: "2021/01/08", High: 125, Low: 110, Close: 121}, // 前日までの高値120を終値で上抜け
+		{Date: "2021/01/07", High: 119, Low: 80, Close: 85},   // 安値更新
+		{Date: "2021/01/06", High: 120, Low: 95, Close: 100},  // 高値更新
+		{Date: "2021/01/05", High: 110, Low: 90, Close: 100},
+		{Date: "2020/12/20", High: 200, Low: 50, Close: 100}, // 2週より前なので期間外
+	}
+
+	got, err := calculateHighLow(dateBars, 2, "2021/01/06")
+	if err != nil {
+		t.Fatalf("failed to calculateHighLow: %v", err)
+	}
+	want := []DateHighLow{
+		{Date: "2021/01/08", High: 125, Low: 80, DistanceToHigh: (121.0/125 - 1) * 100, DistanceToLow: (121.0/80 - 1) * 100, Event: breakout},
+		{Date: "2021/01/07", High: 120, Low: 80, DistanceToHigh: (85.0/120 - 1) * 100, DistanceToLow: (85.0/80 - 1) * 100, Event: newLow},
+		{Date: "2021/01/06", High: 120, Low: 90, DistanceToHigh: (100.0/120 - 1) * 100, DistanceToLow: (100.0/90 - 1) * 100, Event: newHigh},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got: %#v\nwant: %#v", got, want)
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		if g.Date != w.Date || g.High != w.High || g.Low != w.Low || g.Event != w.Event ||
+			!almostEqual(g.DistanceToHigh, w.DistanceToHigh) || !almostEqual(g.DistanceToLow, w.DistanceToLow) {
+			t.Errorf("got: %#v\nwant: %#v", g, w)
+		}
+	}
+
+	// 期間の初日以前からのデータがない場合は、前日までのデータがあっても高値、安値の更新とみなさない
+	got, err = calculateHighLow(dateBars[:4], 2, "2021/01/06")
+	if err != nil {
+		t.Fatalf("failed to calculateHighLow: %v", err)
+	}
+	for _, g := range got {
+		if g.Event != unknownHighLowEvent {
+			t.Errorf("got: %#v, want unknownHighLowEvent", g)
+		}
+	}
+
+	// 前日までのデータがない場合はunknown
+	got, err = calculateHighLow(dateBars[3:4], 52, "2021/01/01")
+	if err != nil {
+		t.Fatalf("failed to calculateHighLow: %v", err)
+	}
+	if len(got) != 1 || got[0].Event != unknownHighLowEvent || got[0].High != 110 || got[0].Low != 90 {
+		t.Errorf("got: %#v", got)
+	}
+}
+
+func TestFilterDateBarsFrom(t *testing.T) {
+	dateBars := []DateBar{{Date: "2021/01/08"}, {Date: "2021/01/07"}, {Date: "2021/01/06"}}
+	tests := map[string]struct {
+		fromDate string
+		want     []DateBar
+	}{
+		"all":  {fromDate: "2021/01/01", want: dateBars},
+		"part": {fromDate: "2021/01/07", want: dateBars[:2]},
+		"none": {fromDate: "2021/01/09", want: []DateBar{}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := filterDateBarsFrom(dateBars, tc.fromDate); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// highlowを計算するために遡って取得したデータが他のtableの計算に影響しないこと
+func TestCalcMovingTrendHighLow(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	codes := makeCodes(3)
+	exec := func(highLowTable string) map[string][]string {
+		db := newFakeDB(codes, 200, 0)
+		c := newFakeCalcMovingTrend(t, db, codes)
+		c.FromDate = "2020/05/01"
+		c.HighLowTable = highLowTable
+		if err := c.Exec(); err != nil {
+			t.Fatalf("failed to Exec: %v", err)
+		}
+		return db.sortedTables()
+	}
+	without := exec("")
+	with := exec("highlow")
+
+	for _, table := range []string{"movingavg", "trend", "volatility", "volume"} {
+		if !reflect.DeepEqual(with[table], without[table]) {
+			t.Errorf("%s changed by highlow: got %d rows, want %d rows", table, len(with[table]), len(without[table]))
+		}
+	}
+	if len(with["highlow"]) != len(with["movingavg"]) {
+		t.Errorf("highlow rows: %d, movingavg rows: %d", len(with["highlow"]), len(with["movingavg"]))
+	}
+}
+
+func TestMakeNewHighsDataForSheet(t *testing.T) {
+	ctl := []codeDateTrendList{
+		{code: "1001", trend: longTermAdvance, generalTrend: buy},
+		{code: "1002", trend: shortTermAdvance, generalTrend: strongBuy},
+		{code: "1003", trend: non, generalTrend: neutral},
+		{code: "1004", trend: longTermAdvance, generalTrend: buy},
+	}
+	codeValues := map[string]map[string]float64{
+		"1001": {"rollingHigh": 120, "distanceToHigh": -2, "highLowEvent": float64(newHigh)},
+		"1002": {"rollingHigh": 300, "distanceToHigh": 0, "highLowEvent": float64(breakout)},
+		"1003": {"rollingHigh": 500, "distanceToHigh": -10, "highLowEvent": float64(noHighLowEvent)},
+		"1004": {"rollingHigh": 150, "distanceToHigh": -1, "highLowEvent": float64(newHigh)},
+	}
+	want := [][]string{
+		{"code", "highLowEvent", "rollingHigh", "distanceToHigh", "trend", "generalTrend", "20210108"},
+		{"1002", "breakout", "300", "0", "shortTermAdvance", "strongBuy"},
+		{"1004", "newHigh", "150", "-1", "longTermAdvance", "buy"},
+		{"1001", "newHigh", "120", "-2", "longTermAdvance", "buy"},
+	}
+	if got := makeNewHighsDataForSheet(ctl, codeValues, "2021/01/08"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v\nwant: %v", got, want)
+	}
+}
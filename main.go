@@ -16,9 +16,11 @@ import (
 	"google.golang.org/api/drive/v3"
 	sheets "google.golang.org/api/sheets/v4"
 
+	"github.com/ludwig125/gke-stockprice/dag"
 	"github.com/ludwig125/gke-stockprice/database"
 	"github.com/ludwig125/gke-stockprice/googledrive"
 	"github.com/ludwig125/gke-stockprice/retry"
+	"github.com/ludwig125/gke-stockprice/screen"
 	"github.com/ludwig125/gke-stockprice/sheet"
 	"github.com/ludwig125/gke-stockprice/status"
 )
@@ -38,6 +40,14 @@ func getLocation() *time.Location {
 }
 
 func main() {
+	// サブコマンドが指定された場合はそれだけ実行して終了する
+	if len(os.Args) > 1 {
+		if err := execSubcommand(context.Background(), os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("failed to execSubcommand: %v", err)
+		}
+		return
+	}
+
 	start := time.Now()
 	log.Println("start:", start)
 	if job := os.Getenv("DELETE_GKE_CLUSTER_JOB"); job != "" {
@@ -71,9 +81,13 @@ func main() {
 
 	result := "finished successfully"
 	emoji := ":sunny:"
+	summary := &SlackSummary{} // 処理中に集めたSlackに通知する内容
+	// 実行ごとにIDを振り、status、runs tableに記録する
+	ledger := newRunLedger(status.NewRunID(now()), now(), env)
+	log.Println("run id:", ledger.ID)
 	// 日時バッチ処理
 	if err := receivePanic(func() error { // execProcess内でpanicしたら原因をSlackに伝搬する
-		return execProcess(ctx)
+		return execProcess(ctx, summary, ledger)
 	}); err != nil {
 		log.Println("failed to execProcess:", err)
 		result = err.Error()
@@ -81,6 +95,10 @@ func main() {
 		cancel() // 何らかのエラーが発生した場合、他の処理も全てcancelさせる
 	}
 
+	if s := summary.String(); s != "" {
+		result += "\n\n" + s
+	}
+
 	finish := time.Now()
 	if os.Getenv("SEND_SLACK_MESSAGE") == "on" {
 		msg := createSlackMsg("gke-stockprice", start, finish, result)
@@ -93,7 +111,7 @@ func main() {
 	log.Println("process finished successfully")
 }
 
-func execProcess(ctx context.Context) error {
+func execProcess(ctx context.Context, summary *SlackSummary, ledger *RunLedger) (err error) {
 	// databaseの取得
 	db, err := getDatabase(ctx)
 	if err != nil {
@@ -102,21 +120,31 @@ func execProcess(ctx context.Context) error {
 	defer db.CloseDB()
 	log.Println("connected db successfully")
 
-	// spreadsheetのserviceを取得
-	srv, err := getSheetService(ctx, mustGetenv("CREDENTIAL_FILEPATH"))
+	// 実行の記録はdbをcloseする前に書き込む。runs table自体への書き込みは行数に含めない
+	targetDate := calculateTrendTargetDate()
+	ledger.TargetDate = targetDate
+	if err := ledger.save(db); err != nil {
+		log.Printf("failed to save run: %v", err)
+	}
+	defer ledger.saveOnExit(db, &err)
+	db = countingDB{DB: db, ledger: ledger}
+
+	// spreadsheetのserviceを取得(ローカルのファイルを使う場合は不要)
+	factory, err := newSheetFactory(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to getSheetService: %v", err)
+		return fmt.Errorf("failed to newSheetFactory: %v", err)
 	}
 	log.Println("got sheet service successfully")
+	defer factory.logUsage()
 
 	var dayoff DayOff
 	if env == "prod" && os.Getenv("CHECK_DAYOFF") == "on" {
 		previousDate := now().AddDate(0, 0, -1)
-		dayoff = isDayOff(previousDate, sheet.NewSpreadSheet(srv, mustGetenv("HOLIDAY_SHEETID"), "holiday"))
+		dayoff = isDayOff(previousDate, factory.sheet("HOLIDAY", "holiday"))
 	}
 
 	// 銘柄一覧の取得
-	codeSheet := sheet.NewSpreadSheet(srv, mustGetenv("COMPANYCODE_SHEETID"), "tse-first")
+	codeSheet := factory.sheet("COMPANYCODE", "tse-first")
 	codes, err := fetchCompanyCode(codeSheet)
 	if err != nil {
 		return fmt.Errorf("failed to fetchCompanyCode: %v", err)
@@ -126,49 +154,127 @@ func execProcess(ctx context.Context) error {
 	}
 
 	// 株価trendを表示するためのSheet
-	trendSheet := sheet.NewSpreadSheet(srv, mustGetenv("TREND_SHEETID"), "trend")
+	trendSheet := factory.sheet("TREND", "trend")
+	// 移動平均線のゴールデンクロス、デッドクロスを表示するためのSheet
+	crossoverSheet := factory.sheet("TREND", "crossover")
+	// 高値を更新した銘柄を表示するためのSheet
+	newHighsSheet := factory.sheet("TREND", "newhighs")
+	// trend転換した銘柄やgrowthRateの上位、下位などを表示するためのSheet
+	summarySheets := make(map[string]sheet.Sheet, len(trendSummaryTabs))
+	for _, t := range trendSummaryTabs {
+		summarySheets[t.name] = factory.sheet("TREND", t.name)
+	}
+
+	// スクリーニングの条件と、条件に合致した銘柄を書き込むSheet
+	screens, err := screen.ParseScreens(useEnvOrDefault("SCREEN_RULES", ""))
+	if err != nil {
+		return fmt.Errorf("failed to ParseScreens: %v", err)
+	}
+	if err := validateScreens(screens); err != nil {
+		return fmt.Errorf("failed to validateScreens: %v", err)
+	}
+	screenSheets := make(map[string]sheet.Sheet, len(screens))
+	for _, s := range screens {
+		screenSheets[s.Name] = factory.sheet("TREND", "screen_"+s.Name)
+	}
 
-	// daily処理の進捗を管理するためのSheet
-	statusSheet := sheet.NewSpreadSheet(srv, mustGetenv("STATUS_SHEETID"), "status")
+	// 各自が見たい銘柄のwatchlistと、watchlistごとのtrendを書き込むSheet
+	// WATCHLIST_TABが空の場合はwatchlistを使わない
+	// watchlistは株価の取得やtrendの計算に関係ないので、読めなくても処理を止めずにwatchlistなしで続ける
+	var watchlists []Watchlist
+	if tab := useEnvOrDefault("WATCHLIST_TAB", ""); tab != "" {
+		var skipped []string
+		watchlists, skipped, err = fetchWatchlists(factory.sheet("TREND", tab))
+		if err != nil {
+			log.Printf("failed to fetchWatchlists. continue without watchlists: %v", err)
+			summary.Add(fmt.Sprintf("watchlistを読み込めなかったのでwatchlistなしで実行しました: %v", err))
+		}
+		for _, s := range skipped {
+			log.Printf("skip watchlist %s", s)
+			summary.Add(fmt.Sprintf("watchlistの不正な行を読み飛ばしました: %s", s))
+		}
+	}
+	watchlistSheets := make(map[string]sheet.Sheet, len(watchlists))
+	for _, w := range watchlists {
+		watchlistSheets[w.Name] = factory.sheet("TREND", w.tabName())
+	}
+	var watchlistSlack func(channel string) Slack
+	if os.Getenv("SEND_SLACK_MESSAGE") == "on" {
+		token := mustGetenv("SLACK_TOKEN")
+		watchlistSlack = func(channel string) Slack { return NewSlackClient(token, channel) }
+	}
 
-	if err := restructureTablesFromDaily(db, codes, statusSheet); err != nil {
-		return fmt.Errorf("failed to restructureTablesFromDaily: %v", err)
+	movingAvgPairs, err := parseMovingAvgPairs(useEnvOrDefault("CROSSOVER_MOVING_AVG_PAIRS", "M5/M20,M20/M60,M60/M100,EMA12/EMA26"))
+	if err != nil {
+		return fmt.Errorf("failed to parseMovingAvgPairs: %v", err)
+	}
+
+	// daily処理の進捗をMySQLで管理する。STATUS_SHEET_MIRRORがonならSheetにも書き込む
+	var statusStore status.Store = status.MySQLStore{DB: db, Table: "task_status"}
+	if os.Getenv("STATUS_SHEET_MIRROR") == "on" {
+		statusStore = status.MirrorStore{Primary: statusStore, Mirror: status.SheetStore{Sheet: factory.sheet("STATUS", "status")}}
 	}
+	st := status.Status{Store: statusStore, RunID: ledger.ID}
 
-	d := daily{
-		status: statusSheet,
+	d := &daily{
+		ledger: ledger,
+		status: st,
 		dayoff: dayoff,
 		dailyStockPrice: DailyStockPrice{
 			db:                 db,
 			dailyStockpriceURL: mustGetenv("DAILY_PRICE_URL"),                                                          // 日足株価scrape先のURL
 			fetchInterval:      time.Duration(strToInt(useEnvOrDefault("SCRAPE_INTERVAL", "1000"))) * time.Millisecond, // スクレイピングの間隔(millisec)
 			fetchTimeout:       time.Duration(strToInt(useEnvOrDefault("SCRAPE_TIMEOUT", "1000"))) * time.Millisecond,  // スクレイピングのtimeout(millisec)
+			checkpoint:         NewCheckpoint(db, now(), saveStockPriceTask),
 		},
 		calculateDailyMovingAvgTrend: CalculateDailyMovingAvgTrend{
-			db:                    db,
-			sheet:                 trendSheet,
-			calcConcurrency:       strToInt(useEnvOrDefault("CALC_MOVING_TREND_CONCURRENCY", "3")), // 最大同時並列処理数
-			targetDate:            calculateTrendTargetDate(),
-			longTermThresholdDays: 2, // TODO: どれくらいにすればいいか考える
+			db:              db,
+			sheet:           trendSheet,
+			crossoverSheet:  crossoverSheet,
+			newHighsSheet:   newHighsSheet,
+			highLowWeeks:    strToInt(useEnvOrDefault("HIGHLOW_WEEKS", strconv.Itoa(defaultHighLowWeeks))),
+			summary:         summary,
+			calcConcurrency: strToInt(useEnvOrDefault("CALC_MOVING_TREND_CONCURRENCY", "3")), // 最大同時並列処理数
+			targetDate:      targetDate,
+			movingAvgPairs:  movingAvgPairs,
+			trendParams:     trendParamsFromEnv(),
+			screens:         screens,
+			screenSheets:    screenSheets,
+			summarySheets:   summarySheets,
+			watchlists:      watchlists,
+			watchlistSheets: watchlistSheets,
+			watchlistSlack:  watchlistSlack,
+			historySheet:    factory.sheet("TREND", trendHistoryTab),
+			sparklineSheet:  factory.sheet("TREND", sparklineTab),
+			sparklineDays:   strToInt(useEnvOrDefault("SPARKLINE_DAYS", strconv.Itoa(defaultSparklineDays))),
+			multiTimeframe:  useEnvOrDefault("CALC_MULTI_TIMEFRAME", "false") == "true", // 週足、月足のtrendも計算する
+			checkpoint:      NewTargetCheckpoint(db, now(), "calcMovingTrend", targetDate),
 		},
 	}
-	if err := d.exec(ctx, codes); err != nil {
+	// restructureはdailyと独立に、backupはdailyの後に実行する
+	if err := d.exec(ctx, codes, restructureTask(db, codes), backupTask()); err != nil {
 		return fmt.Errorf("failed to daily: %v", err)
 	}
 
-	// MySQLの中身をGoogleDriveにbackup
-	// mysqldump and upload to google drive
-	driveSrv, err := googledrive.GetDriveService(ctx, mustGetenv("CREDENTIAL_FILEPATH")) // rootディレクトリに置いてあるserviceaccountのjsonを使う
-	if err != nil {
-		return fmt.Errorf("failed to GetDriveService: %v", err)
-	}
-	if err := backupMySQL(ctx, driveSrv); err != nil {
-		return fmt.Errorf("failed to backupMySQL: %v", err)
-	}
-
 	return nil
 }
 
+// MySQLの中身をGoogleDriveにbackup
+// mysqldump and upload to google drive
+func backupTask() dag.Task {
+	return dag.Task{
+		Name:      "backupMySQL",
+		DependsOn: []string{calculateDailyMovingAvgTrendTask},
+		Run: func(ctx context.Context) error {
+			driveSrv, err := googledrive.GetDriveService(ctx, mustGetenv("CREDENTIAL_FILEPATH")) // rootディレクトリに置いてあるserviceaccountのjsonを使う
+			if err != nil {
+				return fmt.Errorf("failed to GetDriveService: %v", err)
+			}
+			return backupMySQL(ctx, driveSrv)
+		},
+	}
+}
+
 func mustGetenv(k string) string {
 	v := os.Getenv(k)
 	if v == "" {
@@ -192,6 +298,15 @@ func useEnvOrDefault(key, def string) string {
 	return v
 }
 
+// trendの計算に使うパラメータ。指定がなければdefaultTrendParamsの値を使う
+func trendParamsFromEnv() TrendParams {
+	return TrendParams{
+		Classifier:            useEnvOrDefault("TREND_CLASSIFIER", defaultTrendParams.Classifier),
+		LongTermThresholdDays: strToInt(useEnvOrDefault("TREND_LONG_TERM_THRESHOLD_DAYS", strconv.Itoa(defaultTrendParams.LongTermThresholdDays))),
+		MaxContinuationDays:   strToInt(useEnvOrDefault("TREND_MAX_CONTINUATION_DAYS", strconv.Itoa(defaultTrendParams.MaxContinuationDays))),
+	}
+}
+
 func strToInt(s string) int {
 	i, err := strconv.Atoi(s)
 	if err != nil {
@@ -298,38 +413,58 @@ func fetchCompanyCode(s sheet.Sheet) ([]string, error) {
 	return codes, nil
 }
 
-func restructureTablesFromDaily(db database.DB, codes []string, statusSheet sheet.Sheet) error {
-	st := status.Status{Sheet: statusSheet} // Status管理用の変数
-	start := now()
-
-	executeDate := os.Getenv("RESTRUCTURE_EXECUTE_DATE")
-	if executeDate == "" {
-		log.Printf("RESTRUCTURE_EXECUTE_DATE is not set. no need to restructure")
-		return nil
+// RESTRUCTURE_EXECUTE_DATEが今日の場合だけ実行する。当日完了済みならskipする
+func restructureTask(db database.DB, codes []string) dag.Task {
+	return dag.Task{
+		Name: "restructureTablesFromDaily",
+		Once: true,
+		SkipIf: func() (bool, string) {
+			executeDate := os.Getenv("RESTRUCTURE_EXECUTE_DATE")
+			if executeDate == "" {
+				return true, "RESTRUCTURE_EXECUTE_DATE is not set. no need to restructure"
+			}
+			today := time.Now().Format("2006/01/02")
+			if executeDate != today {
+				return true, fmt.Sprintf("RESTRUCTURE_EXECUTE_DATE(%s) is not today(%s). no need to restructure", executeDate, today)
+			}
+			return false, ""
+		},
+		Run: func(ctx context.Context) error {
+			return restructureTablesFromDaily(db, codes)
+		},
 	}
-	today := time.Now().Format("2006/01/02")
-	if executeDate != today {
-		log.Printf("RESTRUCTURE_EXECUTE_DATE(%s) is not today(%s). no need to restructure", executeDate, today)
-		return nil
+}
+
+func restructureTablesFromDaily(db database.DB, codes []string) error {
+	log.Println("Trying to restructure...")
+
+	// 比較用に別のTrendClassifierで計算したtrendを書き込むtable
+	comparisonTrendTables, err := parseComparisonTrendTables(useEnvOrDefault("RESTRUCTURE_TO_COMPARISON_TREND_TABLES", ""))
+	if err != nil {
+		return fmt.Errorf("failed to parseComparisonTrendTables: %v", err)
 	}
-	log.Printf("RESTRUCTURE_EXECUTE_DATE(%s) is today(%s). Trying to restructure...", executeDate, today)
-	defer func() {
-		st.InsertStatus("restructureTablesFromDaily", now(), now().Sub(start)) // now().Sub(start)で所要時間も入れておく
-		log.Println("restructureTablesFromDaily", now(), now().Sub(start))
-	}()
 
 	config := CalcMovingTrendConfig{
-		DB:             db,
-		DailyTable:     useEnvOrDefault("RESTRUCTURE_FROM_DAILY_TABLE", "daily"),
-		MovingAvgTable: mustGetenv("RESTRUCTURE_TO_MOVINGAVG_TABLE"),
-		TrendTable:     mustGetenv("RESTRUCTURE_TO_TREND_TABLE"),
-		Codes:          codes,
-		FromDate:       useEnvOrDefault("RESTRUCTURE_FROM_DATE", time.Now().AddDate(0, 0, -10).Format("2006/01/02")),
-		ToDate:         useEnvOrDefault("RESTRUCTURE_TO_DATE", time.Now().Format("2006/01/02")),
-		MaxConcurrency: strToInt(useEnvOrDefault("RESTRUCTURE_MAX_CONCURRENCY", "10")),
+		DB:                    db,
+		DailyTable:            useEnvOrDefault("RESTRUCTURE_FROM_DAILY_TABLE", "daily"),
+		MovingAvgTable:        mustGetenv("RESTRUCTURE_TO_MOVINGAVG_TABLE"),
+		TrendTable:            mustGetenv("RESTRUCTURE_TO_TREND_TABLE"),
+		VolatilityTable:       useEnvOrDefault("RESTRUCTURE_TO_VOLATILITY_TABLE", ""), // 空の場合はvolatilityを再計算しない
+		VolumeTable:           useEnvOrDefault("RESTRUCTURE_TO_VOLUME_TABLE", ""),     // 空の場合はvolumeを再計算しない
+		CrossoverTable:        useEnvOrDefault("RESTRUCTURE_TO_CROSSOVER_TABLE", ""),  // 空の場合はcrossoverを再計算しない
+		HighLowTable:          useEnvOrDefault("RESTRUCTURE_TO_HIGHLOW_TABLE", ""),    // 空の場合は高値、安値を再計算しない
+		HighLowWeeks:          strToInt(useEnvOrDefault("HIGHLOW_WEEKS", strconv.Itoa(defaultHighLowWeeks))),
+		PatternsTable:         useEnvOrDefault("RESTRUCTURE_TO_PATTERNS_TABLE", ""), // 空の場合はローソク足のパターンを再検出しない
+		TrendParams:           trendParamsFromEnv(),
+		ComparisonTrendTables: comparisonTrendTables,
+		TrendParamsTable:      useEnvOrDefault("RESTRUCTURE_TO_TREND_PARAMS_TABLE", "trend_params"),
+		Codes:                 codes,
+		FromDate:              useEnvOrDefault("RESTRUCTURE_FROM_DATE", time.Now().AddDate(0, 0, -10).Format("2006/01/02")),
+		ToDate:                useEnvOrDefault("RESTRUCTURE_TO_DATE", time.Now().Format("2006/01/02")),
+		MaxConcurrency:        strToInt(useEnvOrDefault("RESTRUCTURE_MAX_CONCURRENCY", "10")),
+		PipelineWorkers:       strToInt(useEnvOrDefault("RESTRUCTURE_PIPELINE_WORKERS", "2")),
 		// RestructureMovingavg: true,
 		// RestructureTrend:     true,
-		// TODO: LongTermThresholdDaysも環境変数から指定する
 	}
 	calc, err := NewCalcMovingTrend(config)
 	if err != nil {
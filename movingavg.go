@@ -61,6 +61,27 @@ type DateClose struct {
 	Close float64
 }
 
+// DateBar has Date, Open, High, Low, Close and Turnover.
+type DateBar struct {
+	Date     string
+	Open     float64
+	High     float64
+	Low      float64
+	Close    float64
+	Turnover float64 // 売買高
+}
+
+// DateBars has Date and Bars.
+type DateBars []DateBar
+
+func (d DateBars) dateCloses() []DateClose {
+	dcs := make([]DateClose, len(d))
+	for i, v := range d {
+		dcs[i] = DateClose{Date: v.Date, Close: v.Close}
+	}
+	return dcs
+}
+
 // DateCloses has Date and Closes.
 type DateCloses []DateClose
 
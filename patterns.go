@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ludwig125/gke-stockprice/candlestick"
+	"github.com/ludwig125/gke-stockprice/database"
+)
+
+// patterns tableは1行が1つのpatternなので、screeningでは特別に扱う
+const patternsTable = "patterns"
+
+// CodeDatePatterns maps code and multiple DatePatterns.
+type CodeDatePatterns map[string][]candlestick.DatePatterns
+
+// Slices converts CodeDatePatterns to double string slice.
+func (c CodeDatePatterns) Slices() [][]string {
+	var patternData [][]string
+	for code, dps := range c {
+		for _, dp := range dps {
+			for _, p := range dp.Patterns {
+				patternData = append(patternData, []string{code, dp.Date, p.String()})
+			}
+		}
+	}
+	return patternData
+}
+
+// fromDateより前の日付は前日との比較にだけ使い、結果には含めない
+// 返り値は日付の降順にする
+func calculateCodeDatePatterns(codeDateBars map[string][]DateBar, fromDate string) map[string][]candlestick.DatePatterns {
+	cdps := make(map[string][]candlestick.DatePatterns, len(codeDateBars))
+	for code, dateBars := range codeDateBars {
+		cdps[code] = detectPatterns(dateBars, fromDate)
+	}
+	return cdps
+}
+
+// dateBarsは日付の降順で与えられる
+func detectPatterns(dateBars []DateBar, fromDate string) []candlestick.DatePatterns {
+	bars := make([]candlestick.Bar, 0, len(dateBars))
+	for i := len(dateBars) - 1; i >= 0; i-- { // 日付の昇順
+		b := dateBars[i]
+		bars = append(bars, candlestick.Bar{Date: b.Date, Open: b.Open, High: b.High, Low: b.Low, Close: b.Close})
+	}
+	var dps []candlestick.DatePatterns
+	all := candlestick.DetectAll(bars)
+	for i := len(all) - 1; i >= 0; i-- {
+		if all[i].Date < fromDate {
+			break
+		}
+		dps = append(dps, all[i])
+	}
+	return dps
+}
+
+// 指定した期間に検出されたpatternを銘柄、日付ごとに返す
+func fetchCodeDatePatterns(db database.DB, table string, targetCodes []string, fromDate, toDate string) (map[string]map[string][]candlestick.Pattern, error) {
+	codes := joinCodeForWhereInStatement(targetCodes)
+
+	q := fmt.Sprintf("SELECT code, date, pattern FROM %s WHERE code in (%s) AND date >= '%s' AND date <= '%s' ORDER BY code, date, pattern;", table, codes, fromDate, toDate)
+	res, err := db.SelectDB(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to selectTable %v, query: %s", err, q)
+	}
+
+	codeDatePatterns := make(map[string]map[string][]candlestick.Pattern)
+	for _, r := range res {
+		p, err := candlestick.ParsePattern(r[2])
+		if err != nil {
+			return nil, fmt.Errorf("failed to ParsePattern: %v, code: %s", err, r[0])
+		}
+		if _, ok := codeDatePatterns[r[0]]; !ok {
+			codeDatePatterns[r[0]] = make(map[string][]candlestick.Pattern)
+		}
+		codeDatePatterns[r[0]][r[1]] = append(codeDatePatterns[r[0]][r[1]], p)
+	}
+	return codeDatePatterns, nil
+}
+
+// スクリーニングの条件式で使う値
+// hammer == true のように書けるよう、検出されたpatternを1、それ以外を0とする
+func patternValues(ps []candlestick.Pattern) map[string]float64 {
+	values := make(map[string]float64, len(candlestick.Patterns()))
+	for _, p := range candlestick.Patterns() {
+		values[p.String()] = 0
+	}
+	for _, p := range ps {
+		values[p.String()] = 1
+	}
+	return values
+}
+
+func createPatternsSlackMsg(date string, codePatterns map[string][]candlestick.Pattern) string {
+	const maxCodes = 10 // Slackに列挙する銘柄数の上限
+
+	grouped := make(map[candlestick.Pattern][]string)
+	for code, ps := range codePatterns {
+		for _, p := range ps {
+			grouped[p] = append(grouped[p], code)
+		}
+	}
+	if len(grouped) == 0 {
+		return fmt.Sprintf("patterns %s: なし", date)
+	}
+
+	msg := fmt.Sprintf("patterns %s:", date)
+	for _, p := range candlestick.Patterns() { // patternの定義順に出す
+		codes, ok := grouped[p]
+		if !ok {
+			continue
+		}
+		sort.Strings(codes)
+		listed := codes
+		if len(listed) > maxCodes {
+			listed = listed[:maxCodes]
+		}
+		msg += fmt.Sprintf("\n%s: %d銘柄 %s", p, len(codes), strings.Join(listed, ","))
+		if len(codes) > maxCodes {
+			msg += ",..."
+		}
+	}
+	return msg
+}
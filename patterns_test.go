@@ -0,0 +1,115 @@
+// +build !integration
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ludwig125/gke-stockprice/candlestick"
+)
+
+func TestDetectPatterns(t *testing.T) {
+	// 日付の降順
+	dateBars := []DateBar{
+		{Date: "2021/01/08", Open: 112, High: 116, Low: 111, Close: 112.2}, // 十字線で窓開け
+		{Date: "2021/01/07", Open: 104, High: 110, Low: 103, Close: 108},
+		{Date: "2021/01/06", Open: 102, High: 103, Low: 99, Close: 100},   // 前日の実体を包む陰線
+		{Date: "2021/01/05", Open: 100, High: 105, Low: 95, Close: 100.5}, // fromDateより前なので前日との比較にだけ使う
+	}
+	tests := map[string]struct {
+		fromDate string
+		want     []candlestick.DatePatterns
+	}{
+		"all": {
+			fromDate: "2021/01/06",
+			want: []candlestick.DatePatterns{
+				{Date: "2021/01/08", Patterns: []candlestick.Pattern{candlestick.Doji, candlestick.GapUp}},
+				{Date: "2021/01/06", Patterns: []candlestick.Pattern{candlestick.BearishEngulfing}},
+			},
+		},
+		"from_latest": {
+			fromDate: "2021/01/08",
+			want: []candlestick.DatePatterns{
+				{Date: "2021/01/08", Patterns: []candlestick.Pattern{candlestick.Doji, candlestick.GapUp}},
+			},
+		},
+		"none": {
+			fromDate: "2021/01/09",
+			want:     nil,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := detectPatterns(dateBars, tc.fromDate); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %v\nwant: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPatternValues(t *testing.T) {
+	got := patternValues([]candlestick.Pattern{candlestick.Hammer})
+	if len(got) != len(candlestick.Patterns()) {
+		t.Errorf("got %d values, want %d", len(got), len(candlestick.Patterns()))
+	}
+	if got["hammer"] != 1 || got["doji"] != 0 {
+		t.Errorf("got: %v", got)
+	}
+}
+
+func TestCreatePatternsSlackMsg(t *testing.T) {
+	tests := map[string]struct {
+		codePatterns map[string][]candlestick.Pattern
+		want         string
+	}{
+		"patterns": {
+			codePatterns: map[string][]candlestick.Pattern{
+				"1002": {candlestick.Hammer},
+				"1001": {candlestick.Doji, candlestick.Hammer},
+				"1003": nil,
+			},
+			want: "patterns 2021/01/08:\\ndoji: 1銘柄 1001\\nhammer: 2銘柄 1001,1002",
+		},
+		"no_pattern": {
+			codePatterns: map[string][]candlestick.Pattern{"1001": nil},
+			want:         "patterns 2021/01/08: なし",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			want := strings.Replace(tc.want, "\\n", "\n", -1)
+			if got := createPatternsSlackMsg("2021/01/08", tc.codePatterns); got != want {
+				t.Errorf("got: %s\nwant: %s", got, want)
+			}
+		})
+	}
+}
+
+func TestCalcMovingTrendPatterns(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	codes := makeCodes(3)
+	db := newFakeDB(codes, 100, 0)
+	c := newFakeCalcMovingTrend(t, db, codes)
+	c.PatternsTable = "patterns"
+	if err := c.Exec(); err != nil {
+		t.Fatalf("failed to Exec: %v", err)
+	}
+
+	// fakeDBの足は始値と終値が同じなので毎日十字線になる
+	tables := db.sortedTables()
+	if len(tables["patterns"]) != len(tables["movingavg"]) {
+		t.Errorf("patterns rows: %d, movingavg rows: %d", len(tables["patterns"]), len(tables["movingavg"]))
+	}
+	for _, r := range tables["patterns"] {
+		if !strings.HasSuffix(r, ",doji") {
+			t.Errorf("unexpected pattern: %s", r)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ludwig125/gke-stockprice/database"
+)
+
+// growthRateなどは銘柄ごとの値でしかないので、日付ごとに全銘柄の中での順位とパーセンタイルを計算する
+
+// 何営業日前の終値からの騰落率を順位づけするか
+var rankingReturnDays = []int{5, 20, 60}
+
+// 60営業日前の終値がとれるように遡る日数(営業日ではなく暦日)
+const rankingFetchDays = 100
+
+// 順位づけする指標。Sheetにはこの順に順位を出す
+var rankingMetrics = []string{"growthRate", "return5", "return20", "return60", "continuationDays"}
+
+// Ranking is cross-sectional rank of a metric on a date.
+type Ranking struct {
+	Metric     string
+	Value      float64
+	Rank       int     // 値が大きい順に1から。同じ値は同じ順位
+	Percentile float64 // 全銘柄の中で何%の銘柄より上位か。1位が100
+	Universe   int     // 順位づけした銘柄数
+}
+
+// CodeRankings maps code and multiple Ranking.
+type CodeRankings map[string][]Ranking
+
+// Slices converts CodeRankings to double string slice.
+func (c CodeRankings) Slices(date string) [][]string {
+	var rankingData [][]string
+	for code, rs := range c {
+		for _, r := range rs {
+			rankingData = append(rankingData, []string{
+				code,
+				date,
+				r.Metric,
+				fmt.Sprintf("%g", r.Value),
+				fmt.Sprintf("%d", r.Rank),
+				fmt.Sprintf("%.4g", r.Percentile),
+				fmt.Sprintf("%d", r.Universe),
+			})
+		}
+	}
+	return rankingData
+}
+
+// dateBarsは日付の降順で与えられる
+// dateのデータがない、または遡るデータが足りない騰落率は含めない
+func calculateReturns(dateBars []DateBar, date string) map[string]float64 {
+	returns := make(map[string]float64, len(rankingReturnDays))
+	if len(dateBars) == 0 || dateBars[0].Date != date {
+		return returns
+	}
+	for _, days := range rankingReturnDays {
+		if len(dateBars) <= days || dateBars[days].Close == 0 {
+			continue
+		}
+		returns[fmt.Sprintf("return%d", days)] = (dateBars[0].Close/dateBars[days].Close - 1) * 100
+	}
+	return returns
+}
+
+// 値が大きい順に順位をつける
+func rankValues(metric string, codeValues map[string]float64) map[string]Ranking {
+	codes := make([]string, 0, len(codeValues))
+	for code := range codeValues {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if codeValues[codes[i]] != codeValues[codes[j]] {
+			return codeValues[codes[i]] > codeValues[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+
+	n := len(codes)
+	rankings := make(map[string]Ranking, n)
+	rank := 0
+	for i, code := range codes {
+		if i == 0 || codeValues[code] != codeValues[codes[i-1]] {
+			rank = i + 1
+		}
+		percentile := 100.0
+		if n > 1 {
+			percentile = float64(n-rank) / float64(n-1) * 100
+		}
+		rankings[code] = Ranking{Metric: metric, Value: codeValues[code], Rank: rank, Percentile: percentile, Universe: n}
+	}
+	return rankings
+}
+
+// continuationDaysは上昇、下落のどちらの連続日数も正の値なので、下落の連続は負にして順位づけする
+// continuationDaysの方向は前営業日と前々営業日の終値の比較で決まるので、growthRateが1より小さければ下落とみなす
+func signedContinuationDays(tl TrendList) float64 {
+	if tl.growthRate < 1 {
+		return -float64(tl.continuationDays)
+	}
+	return float64(tl.continuationDays)
+}
+
+// codeDateBarsは銘柄ごとに日付の降順で、dateから60営業日前までのデータが入っていることを期待する
+// 返り値の各銘柄のRankingはrankingMetricsの順にする
+func calculateRankings(date string, trends map[string]TrendList, codeDateBars map[string][]DateBar) map[string][]Ranking {
+	metricValues := make(map[string]map[string]float64, len(rankingMetrics))
+	for _, m := range rankingMetrics {
+		metricValues[m] = make(map[string]float64)
+	}
+	for code, tl := range trends {
+		metricValues["growthRate"][code] = tl.growthRate
+		metricValues["continuationDays"][code] = signedContinuationDays(tl)
+	}
+	for code, dateBars := range codeDateBars {
+		for m, v := range calculateReturns(dateBars, date) {
+			metricValues[m][code] = v
+		}
+	}
+
+	codeRankings := make(map[string][]Ranking)
+	for _, m := range rankingMetrics {
+		for code, r := range rankValues(m, metricValues[m]) {
+			codeRankings[code] = append(codeRankings[code], r)
+		}
+	}
+	return codeRankings
+}
+
+// rankingの計算に必要なtrendと日足を取得して、ranking tableに書き込む
+func calcRanking(db database.DB, trendTable, rankingTable string, codes []string, date string) error {
+	t, err := time.Parse("2006/01/02", date)
+	if err != nil {
+		return fmt.Errorf("failed to parse date: %s, %v", date, err)
+	}
+	fromDate := t.AddDate(0, 0, -rankingFetchDays).Format("2006/01/02")
+
+	trends, err := fetchTrendList(db, trendTable, codes, date)
+	if err != nil {
+		return fmt.Errorf("failed to fetchTrendList: %v", err)
+	}
+	codeDateBars, err := fetchDailyBarsInBatches(db, codes, fromDate, date)
+	if err != nil {
+		return fmt.Errorf("failed to fetchDailyBarsInBatches: %v", err)
+	}
+
+	rankingData := CodeRankings(calculateRankings(date, trends, codeDateBars)).Slices(date)
+	if len(rankingData) == 0 {
+		return nil
+	}
+	if err := db.InsertOrUpdateDB(rankingTable, rankingData); err != nil {
+		return fmt.Errorf("failed to insert %s: %v", rankingTable, err)
+	}
+	log.Printf("write %s successfully, date: %s", rankingTable, date)
+	return nil
+}
+
+// 指定した日付の順位を銘柄、指標ごとに返す
+func fetchRankings(db database.DB, rankingTable string, targetCodes []string, date string) (map[string]map[string]int, error) {
+	codes := joinCodeForWhereInStatement(targetCodes)
+
+	q := fmt.Sprintf("SELECT code, metric, position FROM %s WHERE code in (%s) AND date = '%s';", rankingTable, codes, date)
+	res, err := db.SelectDB(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to selectTable %v, query: %s", err, q)
+	}
+
+	codeRanks := make(map[string]map[string]int)
+	for _, r := range res {
+		rank, err := strconv.Atoi(r[2])
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert position to int: %v, code: %s", err, r[0])
+		}
+		if _, ok := codeRanks[r[0]]; !ok {
+			codeRanks[r[0]] = make(map[string]int)
+		}
+		codeRanks[r[0]][r[1]] = rank
+	}
+	return codeRanks, nil
+}
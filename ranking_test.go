@@ -0,0 +1,151 @@
+// +build !integration
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRankValues(t *testing.T) {
+	tests := map[string]struct {
+		codeValues map[string]float64
+		want       map[string]Ranking
+	}{
+		"ties": {
+			codeValues: map[string]float64{"1001": 1.5, "1002": 3, "1003": 1.5, "1004": -2, "1005": 0},
+			want: map[string]Ranking{
+				"1002": {Metric: "m", Value: 3, Rank: 1, Percentile: 100, Universe: 5},
+				"1001": {Metric: "m", Value: 1.5, Rank: 2, Percentile: 75, Universe: 5},
+				"1003": {Metric: "m", Value: 1.5, Rank: 2, Percentile: 75, Universe: 5},
+				"1005": {Metric: "m", Value: 0, Rank: 4, Percentile: 25, Universe: 5},
+				"1004": {Metric: "m", Value: -2, Rank: 5, Percentile: 0, Universe: 5},
+			},
+		},
+		"one_code": {
+			codeValues: map[string]float64{"1001": 1},
+			want:       map[string]Ranking{"1001": {Metric: "m", Value: 1, Rank: 1, Percentile: 100, Universe: 1}},
+		},
+		"no_code": {
+			codeValues: map[string]float64{},
+			want:       map[string]Ranking{},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := rankValues("m", tc.codeValues); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %v\nwant: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCalculateReturns(t *testing.T) {
+	// 日付の降順に61日分。終値は古い日ほど小さい
+	latest, _ := time.Parse("2006/01/02", "2021/01/05")
+	var dateBars []DateBar
+	for i := 0; i <= 60; i++ {
+		dateBars = append(dateBars, DateBar{Date: latest.AddDate(0, 0, -i).Format("2006/01/02"), Close: float64(200 - i)})
+	}
+	pct := func(close, past float64) float64 { return (close/past - 1) * 100 }
+
+	tests := map[string]struct {
+		dateBars []DateBar
+		want     map[string]float64
+	}{
+		"all": {
+			dateBars: dateBars,
+			want: map[string]float64{
+				"return5":  pct(200, 195),
+				"return20": pct(200, 180),
+				"return60": pct(200, 140),
+			},
+		},
+		"short_history": {
+			dateBars: dateBars[:21],
+			want: map[string]float64{
+				"return5":  pct(200, 195),
+				"return20": pct(200, 180),
+			},
+		},
+		"no_target_date": {
+			dateBars: dateBars[1:],
+			want:     map[string]float64{},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := calculateReturns(tc.dateBars, "2021/01/05"); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %v\nwant: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCalculateRankings(t *testing.T) {
+	trends := map[string]TrendList{
+		"1001": {growthRate: 1.02, continuationDays: 3},
+		"1002": {growthRate: 0.98, continuationDays: 5}, // 5日連続の下落
+	}
+	// 日付の降順
+	codeDateBars := map[string][]DateBar{
+		"1001": {{Date: "2021/01/05", Close: 100}, {Date: "2021/01/04", Close: 100}, {Date: "2020/12/30", Close: 100}, {Date: "2020/12/29", Close: 100}, {Date: "2020/12/28", Close: 100}, {Date: "2020/12/25", Close: 100}},
+		"1002": {{Date: "2021/01/05", Close: 110}, {Date: "2021/01/04", Close: 100}, {Date: "2020/12/30", Close: 100}, {Date: "2020/12/29", Close: 100}, {Date: "2020/12/28", Close: 100}, {Date: "2020/12/25", Close: 100}},
+	}
+
+	got := calculateRankings("2021/01/05", trends, codeDateBars)
+	close, past := 110.0, 100.0
+	want := map[string][]Ranking{
+		"1001": {
+			{Metric: "growthRate", Value: 1.02, Rank: 1, Percentile: 100, Universe: 2},
+			{Metric: "return5", Value: 0, Rank: 2, Percentile: 0, Universe: 2},
+			{Metric: "continuationDays", Value: 3, Rank: 1, Percentile: 100, Universe: 2},
+		},
+		"1002": {
+			{Metric: "growthRate", Value: 0.98, Rank: 2, Percentile: 0, Universe: 2},
+			{Metric: "return5", Value: (close/past - 1) * 100, Rank: 1, Percentile: 100, Universe: 2},
+			{Metric: "continuationDays", Value: -5, Rank: 2, Percentile: 0, Universe: 2},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestSignedContinuationDays(t *testing.T) {
+	// 同じ日数の連続でも上昇の連続を上位にする
+	trends := map[string]TrendList{
+		"1001": {growthRate: 1.01, continuationDays: 11}, // 11日連続の上昇
+		"1002": {growthRate: 0.99, continuationDays: 11}, // 11日連続の下落
+		"1003": {growthRate: 1, continuationDays: 0},
+	}
+	got := make(map[string]Ranking)
+	for code, rs := range calculateRankings("2021/01/05", trends, nil) {
+		for _, r := range rs {
+			if r.Metric == "continuationDays" {
+				got[code] = r
+			}
+		}
+	}
+	want := map[string]Ranking{
+		"1001": {Metric: "continuationDays", Value: 11, Rank: 1, Percentile: 100, Universe: 3},
+		"1003": {Metric: "continuationDays", Value: 0, Rank: 2, Percentile: 50, Universe: 3},
+		"1002": {Metric: "continuationDays", Value: -11, Rank: 3, Percentile: 0, Universe: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestCodeDateTrendListRanks(t *testing.T) {
+	c := codeDateTrendList{code: "1001", ranks: map[string]int{"growthRate": 3, "return20": 10}}
+	got := c.stringForSheet()
+	want := []string{"3", "", "10", "", ""}
+	if r := got[len(got)-len(rankingMetrics):]; !reflect.DeepEqual(r, want) {
+		t.Errorf("got: %v, want: %v", r, want)
+	}
+	if len(got) != len(sheetColumnName()) {
+		t.Errorf("got %d columns, sheetColumnName has %d columns", len(got), len(sheetColumnName()))
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/ludwig125/gke-stockprice/database"
+)
+
+// 日足を週足、月足にまとめて、それぞれの足でmovingavgとtrendを計算する
+
+type timeframe struct {
+	name string // table名の接尾辞
+	// 日付が属する期間の初日を返す。同じ値になる日付を一つの足にまとめ、足の日付にする
+	periodStart func(t time.Time) time.Time
+	// targetDateからmovingavgとtrendを計算するのに使う期間の開始日を返す
+	// 最初の足が途中から始まらないように期間の初日にそろえる
+	fromDate func(targetDate time.Time) time.Time
+}
+
+func weekStart(t time.Time) time.Time {
+	return t.AddDate(0, 0, -(int(t.Weekday())+6)%7) // 月曜日
+}
+
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// movingavgの最長の期間(moving100)を計算できる足の数
+const timeframeBars = 100
+
+var (
+	weekly = timeframe{
+		name:        "weekly",
+		periodStart: weekStart,
+		fromDate: func(targetDate time.Time) time.Time {
+			return weekStart(targetDate.AddDate(0, 0, -7*timeframeBars))
+		},
+	}
+	monthly = timeframe{
+		name:        "monthly",
+		periodStart: monthStart,
+		fromDate: func(targetDate time.Time) time.Time {
+			// 先に月初にそろえてから遡る。月末から遡ると存在しない日付が翌月に繰り越されるため
+			return monthStart(targetDate).AddDate(0, -timeframeBars, 0)
+		},
+	}
+)
+
+// dateBarsは日付の降順で与えられる。返り値も日付の降順にする
+// 足の日付はその期間の初日(週足は月曜日、月足は1日)とする
+// 期間の途中で何度実行しても同じ日付の行を上書きするので、daily_<timeframe>などに途中の足が残らない
+func resample(dateBars []DateBar, tf timeframe) ([]DateBar, error) {
+	var resampled []DateBar
+	currentPeriod := ""
+	for i := len(dateBars) - 1; i >= 0; i-- { // 日付の古い順
+		b := dateBars[i]
+		t, err := time.Parse("2006/01/02", b.Date)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse date: %s, %v", b.Date, err)
+		}
+		period := tf.periodStart(t).Format("2006/01/02")
+		if period != currentPeriod { // 新しい足の始まり
+			b.Date = period
+			resampled = append(resampled, b)
+			currentPeriod = period
+			continue
+		}
+		last := &resampled[len(resampled)-1]
+		if b.High > last.High {
+			last.High = b.High
+		}
+		if b.Low < last.Low {
+			last.Low = b.Low
+		}
+		last.Close = b.Close
+		last.Turnover += b.Turnover
+	}
+
+	// 日付の降順にする
+	for i, j := 0, len(resampled)-1; i < j; i, j = i+1, j-1 {
+		resampled[i], resampled[j] = resampled[j], resampled[i]
+	}
+	return resampled, nil
+}
+
+// daily tableと同じカラムにする。modifiedは日足にしかないので空にする
+func codeDateBarsToDailySlices(codeDateBars map[string][]DateBar) [][]string {
+	trim := func(f float64) string {
+		return fmt.Sprintf("%g", f)
+	}
+	var dailyData [][]string
+	for code, dateBars := range codeDateBars {
+		for _, b := range dateBars {
+			dailyData = append(dailyData, []string{code, b.Date, trim(b.Open), trim(b.High), trim(b.Low), trim(b.Close), trim(b.Turnover), ""})
+		}
+	}
+	return dailyData
+}
+
+// daily tableから週足(月足)を作ってdaily_<timeframe>に書き込み、
+// movingavg_<timeframe>, trend_<timeframe>を計算する
+func calcTimeframeMovingTrend(db database.DB, tf timeframe, codes []string, targetDate string, maxConcurrency int, params TrendParams) error {
+	t, err := time.Parse("2006/01/02", targetDate)
+	if err != nil {
+		return fmt.Errorf("failed to parse date: %s, %v", targetDate, err)
+	}
+	fromDate := tf.fromDate(t).Format("2006/01/02")
+	dailyTable := "daily_" + tf.name
+
+	// 一度に取得する日足が多くなりすぎないようにmaxConcurrencyごとに処理する
+	for start := 0; start < len(codes); start += maxConcurrency {
+		end := start + maxConcurrency
+		if end > len(codes) {
+			end = len(codes)
+		}
+		targetCodes := codes[start:end]
+
+		codeDateBars, err := fetchCodesDateBars(db, "daily", targetCodes, fmt.Sprintf("AND date >= '%s'", fromDate), fmt.Sprintf("AND date <= '%s'", targetDate), "")
+		if err != nil {
+			return fmt.Errorf("failed to fetchCodesDateBars: %v", err)
+		}
+		resampled := make(map[string][]DateBar, len(codeDateBars))
+		for code, dateBars := range codeDateBars {
+			r, err := resample(dateBars, tf)
+			if err != nil {
+				return fmt.Errorf("failed to resample %s: %v, code: %s", tf.name, err, code)
+			}
+			resampled[code] = r
+		}
+		if err := db.InsertOrUpdateDB(dailyTable, codeDateBarsToDailySlices(resampled)); err != nil {
+			return fmt.Errorf("failed to insert %s: %v", dailyTable, err)
+		}
+	}
+	log.Printf("write %s successfully, from-to: %s-%s", dailyTable, fromDate, targetDate)
+
+	calc, err := NewCalcMovingTrend(CalcMovingTrendConfig{
+		DB:               db,
+		DailyTable:       dailyTable,
+		MovingAvgTable:   "movingavg_" + tf.name,
+		TrendTable:       "trend_" + tf.name,
+		TrendParams:      params,
+		TrendParamsTable: "trend_params",
+		Codes:            codes,
+		FromDate:         fromDate,
+		ToDate:           targetDate,
+		MaxConcurrency:   maxConcurrency,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to NewCalcMovingTrend: %w", err)
+	}
+	if err := calc.Exec(); err != nil {
+		return fmt.Errorf("failed to Exec: %w", err)
+	}
+	return nil
+}
+
+// MultiTimeframeTrend is combination of daily, weekly and monthly Trend.
+type MultiTimeframeTrend int
+
+// 5: alignedAdvance : 日足、週足、月足のすべてがAdvance
+// 4: mostlyAdvance : Advanceの数がDeclineの数より2つ多い
+// 3: mixedTimeframe : other
+// 2: mostlyDecline : Declineの数がAdvanceの数より2つ多い
+// 1: alignedDecline : 日足、週足、月足のすべてがDecline
+// 0: unknownTimeframe : どれかのTrendがunknown
+
+const (
+	unknownTimeframe MultiTimeframeTrend = iota
+	alignedDecline
+	mostlyDecline
+	mixedTimeframe
+	mostlyAdvance
+	alignedAdvance
+)
+
+// constのString変換メソッド
+func (m MultiTimeframeTrend) String() string {
+	return [6]string{"unknownTimeframe", "alignedDecline", "mostlyDecline", "mixedTimeframe", "mostlyAdvance", "alignedAdvance"}[m]
+}
+
+func multiTimeframeTrend(daily, weekly, monthly Trend) MultiTimeframeTrend {
+	score := 0
+	for _, t := range []Trend{daily, weekly, monthly} {
+		switch t {
+		case shortTermAdvance, longTermAdvance:
+			score++
+		case shortTermDecline, longTermDecline:
+			score--
+		case non:
+		default:
+			return unknownTimeframe
+		}
+	}
+	switch score {
+	case 3:
+		return alignedAdvance
+	case 2:
+		return mostlyAdvance
+	case -2:
+		return mostlyDecline
+	case -3:
+		return alignedDecline
+	}
+	return mixedTimeframe
+}
+
+// 各銘柄のtargetDate以前で最新のtrendを返す
+// 週足(月足)の日付は期間の初日なので、targetDateと一致するとは限らない
+func fetchLatestTrends(db database.DB, trendTable string, targetCodes []string, date string) (map[string]Trend, error) {
+	codes := joinCodeForWhereInStatement(targetCodes)
+
+	q := fmt.Sprintf("SELECT t.code, t.trend FROM %s t INNER JOIN (SELECT code, MAX(date) AS maxDate FROM %s WHERE code in (%s) AND date <= '%s' GROUP BY code) m ON t.code = m.code AND t.date = m.maxDate;",
+		trendTable, trendTable, codes, date)
+	res, err := db.SelectDB(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to selectTable %v, query: %s", err, q)
+	}
+
+	codeTrends := make(map[string]Trend, len(res))
+	for _, r := range res {
+		trend, err := strconv.Atoi(r[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert string trend to int: %v, code: %s", err, r[0])
+		}
+		codeTrends[r[0]] = Trend(trend)
+	}
+	return codeTrends, nil
+}
+
+func setMultiTimeframeTrend(db database.DB, ctl []codeDateTrendList, codes []string, date string) error {
+	weeklyTrends, err := fetchLatestTrends(db, "trend_"+weekly.name, codes, date)
+	if err != nil {
+		return fmt.Errorf("failed to fetchLatestTrends weekly: %v", err)
+	}
+	monthlyTrends, err := fetchLatestTrends(db, "trend_"+monthly.name, codes, date)
+	if err != nil {
+		return fmt.Errorf("failed to fetchLatestTrends monthly: %v", err)
+	}
+	for i := range ctl {
+		// 週足、月足のtrendがない銘柄はunknown(0)になる
+		ctl[i].multiTimeframeTrend = multiTimeframeTrend(ctl[i].trend, weeklyTrends[ctl[i].code], monthlyTrends[ctl[i].code])
+	}
+	return nil
+}
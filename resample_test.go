@@ -0,0 +1,140 @@
+// +build !integration
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResample(t *testing.T) {
+	// 日付の降順
+	// 2020/12/28(月)-2021/01/01(金)は2021/01/01が休日で、ISO週では2020年の第53週
+	dateBars := []DateBar{
+		{Date: "2021/01/05", Open: 108, High: 112, Low: 107, Close: 111, Turnover: 50},
+		{Date: "2021/01/04", Open: 105, High: 109, Low: 104, Close: 108, Turnover: 40},
+		{Date: "2020/12/30", Open: 103, High: 106, Low: 101, Close: 105, Turnover: 30},
+		{Date: "2020/12/29", Open: 101, High: 104, Low: 99, Close: 103, Turnover: 20},
+		{Date: "2020/12/28", Open: 100, High: 102, Low: 98, Close: 101, Turnover: 10},
+		{Date: "2020/12/25", Open: 95, High: 101, Low: 94, Close: 100, Turnover: 5},
+	}
+
+	tests := map[string]struct {
+		tf   timeframe
+		want []DateBar
+	}{
+		"weekly": {
+			tf: weekly,
+			want: []DateBar{
+				{Date: "2021/01/04", Open: 105, High: 112, Low: 104, Close: 111, Turnover: 90},
+				{Date: "2020/12/28", Open: 100, High: 106, Low: 98, Close: 105, Turnover: 60},
+				{Date: "2020/12/21", Open: 95, High: 101, Low: 94, Close: 100, Turnover: 5},
+			},
+		},
+		"monthly": {
+			tf: monthly,
+			want: []DateBar{
+				{Date: "2021/01/01", Open: 105, High: 112, Low: 104, Close: 111, Turnover: 90},
+				{Date: "2020/12/01", Open: 95, High: 106, Low: 94, Close: 105, Turnover: 65},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := resample(dateBars, tc.tf)
+			if err != nil {
+				t.Fatalf("failed to resample: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %#v, want: %#v", got, tc.want)
+			}
+		})
+	}
+
+	// 期間の途中で再実行しても足の日付は変わらない
+	for name, tf := range map[string]timeframe{"weekly": weekly, "monthly": monthly} {
+		got, err := resample(dateBars[1:], tf)
+		if err != nil {
+			t.Fatalf("failed to resample: %v", err)
+		}
+		if got[0].Date != tests[name].want[0].Date {
+			t.Errorf("%s: got date: %s, want: %s", name, got[0].Date, tests[name].want[0].Date)
+		}
+	}
+
+	if _, err := resample([]DateBar{{Date: "20210105"}}, weekly); err == nil {
+		t.Error("want error for invalid date")
+	}
+}
+
+func TestTimeframeFromDate(t *testing.T) {
+	tests := map[string]struct {
+		tf     timeframe
+		target string
+		want   string
+	}{
+		"weekly": {
+			tf:     weekly,
+			target: "2021/01/06",
+			want:   "2019/02/04", // 100週前の2019/02/06(水)の週の月曜日
+		},
+		"monthly": {
+			tf:     monthly,
+			target: "2021/01/06",
+			want:   "2012/09/01", // 100ヶ月前の月初
+		},
+		"monthly_end_of_month": {
+			tf:     monthly,
+			target: "2021/03/31", // 100ヶ月前の2012/11/31は存在しない
+			want:   "2012/11/01",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			target, _ := time.Parse("2006/01/02", tc.target)
+			if got := tc.tf.fromDate(target).Format("2006/01/02"); got != tc.want {
+				t.Errorf("got: %s, want: %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMultiTimeframeTrend(t *testing.T) {
+	tests := map[string]struct {
+		daily, weekly, monthly Trend
+		want                   MultiTimeframeTrend
+	}{
+		"aligned_advance": {
+			daily: shortTermAdvance, weekly: longTermAdvance, monthly: shortTermAdvance,
+			want: alignedAdvance,
+		},
+		"mostly_advance": {
+			daily: non, weekly: longTermAdvance, monthly: shortTermAdvance,
+			want: mostlyAdvance,
+		},
+		"mixed": {
+			daily: shortTermDecline, weekly: longTermAdvance, monthly: non,
+			want: mixedTimeframe,
+		},
+		"mostly_decline": {
+			daily: shortTermDecline, weekly: longTermDecline, monthly: non,
+			want: mostlyDecline,
+		},
+		"aligned_decline": {
+			daily: shortTermDecline, weekly: longTermDecline, monthly: longTermDecline,
+			want: alignedDecline,
+		},
+		"unknown": {
+			daily: shortTermAdvance, weekly: shortTermAdvance, monthly: unknown,
+			want: unknownTimeframe,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := multiTimeframeTrend(tc.daily, tc.weekly, tc.monthly); got != tc.want {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
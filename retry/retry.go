@@ -49,3 +49,30 @@ func WithContext(ctx context.Context, limit int, interval time.Duration, fn func
 		return err
 	}
 }
+
+// Backoff is retry function with exponential backoff.
+// 失敗するたびにintervalを2倍にしてmaxIntervalまで伸ばす
+// retryableがfalseを返すエラーはリトライしても無駄なのですぐに返す
+func Backoff(limit int, interval, maxInterval time.Duration, retryable func(error) bool, fn func() error) error {
+	attempt := 1
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if !retryable(err) {
+			return err
+		}
+		if attempt < limit {
+			log.Printf("attempt %d failed: %v. sleep %v and retry.", attempt, err, interval)
+			time.Sleep(interval)
+			attempt++
+			if interval *= 2; interval > maxInterval {
+				interval = maxInterval
+			}
+			continue
+		}
+		log.Printf("attempt %d failed: %v. reached attempt limit %d.", attempt, err, limit)
+		return err
+	}
+}
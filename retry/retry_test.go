@@ -96,3 +96,52 @@ func TestWithContext(t *testing.T) {
 		})
 	}
 }
+
+func TestBackoff(t *testing.T) {
+	errRetryable := errors.New("retryable")
+	errFatal := errors.New("fatal")
+
+	cases := map[string]struct {
+		limit     int
+		errs      []error // 呼ばれるたびに先頭から返すエラー
+		wantErr   error
+		wantCalls int
+	}{
+		"success_after_retry": {
+			limit:     3,
+			errs:      []error{errRetryable, errRetryable, nil},
+			wantErr:   nil,
+			wantCalls: 3,
+		},
+		"fail_reach_retry_limit": {
+			limit:     2,
+			errs:      []error{errRetryable, errRetryable, nil},
+			wantErr:   errRetryable,
+			wantCalls: 2,
+		},
+		"fail_not_retryable": {
+			limit:     3,
+			errs:      []error{errFatal, nil},
+			wantErr:   errFatal,
+			wantCalls: 1,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			fn := func() error {
+				err := tc.errs[calls]
+				calls++
+				return err
+			}
+			retryable := func(err error) bool { return err == errRetryable }
+			err := Backoff(tc.limit, 1*time.Microsecond, 2*time.Microsecond, retryable, fn)
+			if err != tc.wantErr {
+				t.Errorf("got error: %v, want error: %v", err, tc.wantErr)
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("got calls: %d, want calls: %d", calls, tc.wantCalls)
+			}
+		})
+	}
+}
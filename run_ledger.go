@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ludwig125/gke-stockprice/dag"
+	"github.com/ludwig125/gke-stockprice/database"
+)
+
+// 日次処理の実行ごとの記録を書き込むtable
+const runsTable = "runs"
+
+// RunLedgerのResult
+const (
+	runRunning = "running"
+	runSuccess = "success"
+	runFailure = "failure"
+)
+
+// DATETIMEのカラムに書き込む形式
+const runTimeLayout = "2006-01-02 15:04:05"
+
+// RunLedger is a record of a daily run.
+// 実行中に銘柄数やtableごとの書き込み行数、taskごとのリトライ回数と所要時間を集め、runs tableに書き込む
+// nilの場合は何も記録しない
+type RunLedger struct {
+	mu            sync.Mutex
+	ID            string
+	StartedAt     time.Time
+	FinishedAt    time.Time
+	Env           string
+	TargetDate    string
+	Result        string
+	Attempted     int            // 株価の取得を試みた銘柄数
+	Succeeded     int            // 株価を格納できた銘柄数
+	Failed        int            // 最初の取得で失敗した銘柄数
+	Quarantined   int            // retryしても失敗し、計算から除外した銘柄数
+	SubmittedRows map[string]int // tableごとにINSERTで送った行数。INSERT IGNOREで無視された行も含む
+	Steps         []*StepMetrics // 実行順
+	Error         string
+}
+
+// StepMetrics is the result of a task in the run.
+type StepMetrics struct {
+	Name     string  `json:"name"`
+	State    string  `json:"state"`
+	Retries  int     `json:"retries"`
+	Duration float64 `json:"duration"` // 秒。リトライを含む
+	runs     int
+}
+
+func newRunLedger(id string, start time.Time, env string) *RunLedger {
+	return &RunLedger{ID: id, StartedAt: start, Env: env, Result: runRunning, SubmittedRows: make(map[string]int)}
+}
+
+// 実行順にtaskを並べておく
+func (l *RunLedger) initSteps(names []string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, name := range names {
+		l.step(name)
+	}
+}
+
+// l.muをlockしてから呼ぶ
+func (l *RunLedger) step(name string) *StepMetrics {
+	for _, s := range l.Steps {
+		if s.Name == name {
+			return s
+		}
+	}
+	s := &StepMetrics{Name: name}
+	l.Steps = append(l.Steps, s)
+	return s
+}
+
+// taskのRunを実行するたびに所要時間を足す。2回目以降の実行はリトライとして数える
+func (l *RunLedger) wrap(tasks []dag.Task) []dag.Task {
+	if l == nil {
+		return tasks
+	}
+	wrapped := make([]dag.Task, len(tasks))
+	for i, t := range tasks {
+		name, run := t.Name, t.Run
+		t.Run = func(ctx context.Context) error {
+			start := time.Now()
+			err := run(ctx)
+
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			s := l.step(name)
+			s.runs++
+			if s.runs > 1 {
+				s.Retries++
+			}
+			s.Duration += time.Since(start).Seconds()
+			return err
+		}
+		wrapped[i] = t
+	}
+	return wrapped
+}
+
+// task内でリトライした回数を足す
+func (l *RunLedger) addRetries(name string, n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.step(name).Retries += n
+}
+
+func (l *RunLedger) setStates(states map[string]dag.State) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for name, state := range states {
+		l.step(name).State = state.String()
+	}
+}
+
+func (l *RunLedger) setFailed(n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Failed = n
+}
+
+func (l *RunLedger) setCodes(attempted, succeeded, quarantined int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Attempted, l.Succeeded, l.Quarantined = attempted, succeeded, quarantined
+}
+
+func (l *RunLedger) addSubmittedRows(table string, n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.SubmittedRows[table] += n
+}
+
+func (l *RunLedger) finish(t time.Time, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.FinishedAt = t
+	l.Result = runSuccess
+	if err != nil {
+		l.Result = runFailure
+		l.Error = err.Error()
+	}
+}
+
+func (l *RunLedger) save(db database.DB) error {
+	if l == nil {
+		return nil
+	}
+	row, err := l.row()
+	if err != nil {
+		return fmt.Errorf("failed to make row: %v", err)
+	}
+	if err := db.InsertOrUpdateDB(runsTable, [][]string{row}); err != nil {
+		return fmt.Errorf("failed to insert run: %v", err)
+	}
+	return nil
+}
+
+// execProcessの最後にdeferで呼び、errpの結果を書き込む
+// panicした場合もfailureとして書き込んでからpanicし直す
+func (l *RunLedger) saveOnExit(db database.DB, errp *error) {
+	if l == nil {
+		return
+	}
+	err := *errp
+	r := recover()
+	if r != nil {
+		// recoverした後ではpanicした箇所のstacktraceがとれないのでここで残す
+		err = fmt.Errorf("panic: %v\nstacktrace: %s", r, string(debug.Stack()))
+	}
+	l.finish(now(), err)
+	if err := l.save(db); err != nil {
+		log.Printf("failed to save run %s: %v", l.ID, err)
+	}
+	if r != nil {
+		panic(err) // receivePanicでSlackに伝える
+	}
+}
+
+func (l *RunLedger) row() ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rows, err := json.Marshal(l.SubmittedRows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rows: %v", err)
+	}
+	steps, err := json.Marshal(l.Steps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal steps: %v", err)
+	}
+	finishedAt := l.FinishedAt
+	if finishedAt.IsZero() { // 実行中
+		finishedAt = l.StartedAt
+	}
+	return []string{
+		l.ID,
+		l.StartedAt.In(jst).Format(runTimeLayout),
+		finishedAt.In(jst).Format(runTimeLayout),
+		l.Env,
+		l.TargetDate,
+		l.Result,
+		strconv.Itoa(l.Attempted),
+		strconv.Itoa(l.Succeeded),
+		strconv.Itoa(l.Failed),
+		strconv.Itoa(l.Quarantined),
+		string(rows),
+		string(steps),
+		l.Error,
+	}, nil
+}
+
+const runsColumns = "run_id, started_at, finished_at, env, target_date, result, codes_attempted, codes_succeeded, codes_failed, codes_quarantined, rows_submitted, steps, error"
+
+func runLedgerFromRow(row []string) (*RunLedger, error) {
+	if len(row) != 13 {
+		return nil, fmt.Errorf("unexpected columns: %v", row)
+	}
+	l := &RunLedger{ID: row[0], Env: row[3], TargetDate: row[4], Result: row[5], Error: row[12]}
+	var err error
+	if l.StartedAt, err = time.ParseInLocation(runTimeLayout, row[1], jst); err != nil {
+		return nil, fmt.Errorf("failed to parse started_at: %v", err)
+	}
+	if l.FinishedAt, err = time.ParseInLocation(runTimeLayout, row[2], jst); err != nil {
+		return nil, fmt.Errorf("failed to parse finished_at: %v", err)
+	}
+	for i, p := range []*int{&l.Attempted, &l.Succeeded, &l.Failed, &l.Quarantined} {
+		if *p, err = strconv.Atoi(row[6+i]); err != nil {
+			return nil, fmt.Errorf("failed to convert codes count: %v", err)
+		}
+	}
+	if err := json.Unmarshal([]byte(row[10]), &l.SubmittedRows); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rows_submitted: %v", err)
+	}
+	if err := json.Unmarshal([]byte(row[11]), &l.Steps); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal steps: %v", err)
+	}
+	return l, nil
+}
+
+// 新しい順にlimit件の実行を返す
+func fetchRuns(db database.DB, limit int) ([]*RunLedger, error) {
+	q := fmt.Sprintf("SELECT %s FROM %s ORDER BY started_at DESC LIMIT %d;", runsColumns, runsTable, limit)
+	res, err := db.SelectDB(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to selectTable %v", err)
+	}
+	var runs []*RunLedger
+	for _, r := range res {
+		l, err := runLedgerFromRow(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to runLedgerFromRow: %v", err)
+		}
+		runs = append(runs, l)
+	}
+	return runs, nil
+}
+
+// idの実行を返す。なければfalseを返す
+func fetchRun(db database.DB, id string) (*RunLedger, bool, error) {
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE run_id = '%s';", runsColumns, runsTable, id)
+	res, err := db.SelectDB(q)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to selectTable %v", err)
+	}
+	if len(res) == 0 {
+		return nil, false, nil
+	}
+	l, err := runLedgerFromRow(res[0])
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to runLedgerFromRow: %v", err)
+	}
+	return l, true, nil
+}
+
+// 書き込みに成功したINSERTで送った行数をtableごとにRunLedgerに足していくdatabase.DB
+// database.DBは影響を受けた行数を返さないので、INSERT IGNOREで無視された行も数える
+type countingDB struct {
+	database.DB
+	ledger *RunLedger
+}
+
+func (c countingDB) InsertDB(table string, records [][]string) error {
+	if err := c.DB.InsertDB(table, records); err != nil {
+		return err
+	}
+	c.ledger.addSubmittedRows(table, len(records))
+	return nil
+}
+
+func (c countingDB) InsertOrUpdateDB(table string, records [][]string) error {
+	if err := c.DB.InsertOrUpdateDB(table, records); err != nil {
+		return err
+	}
+	c.ledger.addSubmittedRows(table, len(records))
+	return nil
+}
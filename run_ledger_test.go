@@ -0,0 +1,162 @@
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ludwig125/gke-stockprice/dag"
+)
+
+func TestRunLedgerSteps(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	l := newRunLedger("20200601180000-abcdef", time.Date(2020, 6, 1, 18, 0, 0, 0, jst), "dev")
+	calls := 0
+	tasks := l.wrap([]dag.Task{
+		{
+			Name:  "flaky",
+			Retry: dag.Retry{Attempts: 3},
+			Run: func(ctx context.Context) error {
+				calls++
+				if calls < 3 {
+					return errors.New("error")
+				}
+				return nil
+			},
+		},
+		{Name: "fail", Run: func(ctx context.Context) error { return errors.New("error") }},
+		{Name: "blocked", DependsOn: []string{"fail"}, Run: func(ctx context.Context) error { return nil }},
+	})
+	g, err := dag.New(tasks...)
+	if err != nil {
+		t.Fatalf("failed to dag.New: %v", err)
+	}
+	l.initSteps(g.Names())
+	states, _ := g.Run(context.Background(), nil)
+	l.setStates(states)
+	l.addRetries("fail", 2)
+
+	got := make(map[string][2]string)
+	for _, s := range l.Steps {
+		got[s.Name] = [2]string{s.State, strings.Repeat("r", s.Retries)}
+	}
+	want := map[string][2]string{
+		"flaky":   {"succeeded", "rr"},
+		"fail":    {"failed", "rr"},
+		"blocked": {"blocked", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestRunLedgerRow(t *testing.T) {
+	start := time.Date(2020, 6, 1, 18, 0, 0, 0, jst)
+	l := newRunLedger("20200601180000-abcdef", start, "prod")
+	l.TargetDate = "2020/06/01"
+	l.SubmittedRows = map[string]int{"daily": 10, "trend": 8}
+	l.Steps = []*StepMetrics{{Name: "saveStockPrice", State: "succeeded", Retries: 1, Duration: 1.5}}
+	l.setCodes(10, 8, 2)
+	l.setFailed(3)
+
+	row, err := l.row()
+	if err != nil {
+		t.Fatalf("failed to row: %v", err)
+	}
+	// 実行中はfinished_atをstarted_atにする
+	if row[1] != "2020-06-01 18:00:00" || row[2] != row[1] || row[5] != runRunning {
+		t.Errorf("got row: %v", row)
+	}
+
+	l.finish(start.Add(90*time.Second), errors.New("failed to daily"))
+	row, err = l.row()
+	if err != nil {
+		t.Fatalf("failed to row: %v", err)
+	}
+	got, err := runLedgerFromRow(row)
+	if err != nil {
+		t.Fatalf("failed to runLedgerFromRow: %v", err)
+	}
+	want := &RunLedger{
+		ID:          "20200601180000-abcdef",
+		StartedAt:   start,
+		FinishedAt:  start.Add(90 * time.Second),
+		Env:         "prod",
+		TargetDate:  "2020/06/01",
+		Result:      runFailure,
+		Attempted:   10,
+		Succeeded:   8,
+		Failed:      3,
+		Quarantined: 2,
+		SubmittedRows:        map[string]int{"daily": 10, "trend": 8},
+		Steps:       []*StepMetrics{{Name: "saveStockPrice", State: "succeeded", Retries: 1, Duration: 1.5}},
+		Error:       "failed to daily",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %#v, want: %#v", got, want)
+	}
+
+	if _, err := runLedgerFromRow(row[:5]); err == nil {
+		t.Error("want error for short row")
+	}
+}
+
+func TestCountingDB(t *testing.T) {
+	l := newRunLedger("id", time.Now(), "dev")
+	fdb := newFakeDB(nil, 0, 0)
+	fdb.failTable = "volume"
+	db := countingDB{DB: fdb, ledger: l}
+
+	db.InsertDB("daily", [][]string{{"1"}, {"2"}})
+	db.InsertOrUpdateDB("trend", [][]string{{"1"}})
+	db.InsertOrUpdateDB("trend", [][]string{{"2"}})
+	if err := db.InsertOrUpdateDB("volume", [][]string{{"1"}}); err == nil {
+		t.Error("want error")
+	}
+	want := map[string]int{"daily": 2, "trend": 2} // 失敗した書き込みは数えない
+	if !reflect.DeepEqual(l.SubmittedRows, want) {
+		t.Errorf("got: %v, want: %v", l.SubmittedRows, want)
+	}
+}
+
+func TestFormatRuns(t *testing.T) {
+	start := time.Date(2020, 6, 1, 18, 0, 0, 0, jst)
+	runs := []*RunLedger{
+		{ID: "20200602180000-000002", StartedAt: start.AddDate(0, 0, 1), FinishedAt: start.AddDate(0, 0, 1), Env: "prod", Result: runRunning},
+		{ID: "20200601180000-000001", StartedAt: start, FinishedAt: start.Add(time.Hour), Env: "prod", TargetDate: "2020/06/01", Result: runSuccess, Attempted: 10, Succeeded: 10},
+	}
+	lines := strings.Split(strings.TrimSpace(formatRuns(runs)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines: %v", len(lines), lines)
+	}
+	for i, want := range [][]string{
+		{"RUN_ID", "STARTED", "DURATION", "ENV", "TARGET", "RESULT", "ATTEMPTED", "SUCCEEDED", "FAILED", "QUARANTINED"},
+		{"20200602180000-000002", "2020-06-02", "18:00:00", "prod", "running", "0", "0", "0", "0"},
+		{"20200601180000-000001", "2020-06-01", "18:00:00", "1h0m0s", "prod", "2020/06/01", "success", "10", "10", "0", "0"},
+	} {
+		if got := strings.Fields(lines[i]); !reflect.DeepEqual(got, want) {
+			t.Errorf("line %d got: %v, want: %v", i, got, want)
+		}
+	}
+
+	detail := formatRun(&RunLedger{
+		ID: "20200601180000-000001", StartedAt: start, FinishedAt: start.Add(time.Hour), Result: runSuccess,
+		SubmittedRows:  map[string]int{"trend": 8, "daily": 10},
+		Steps: []*StepMetrics{{Name: "saveStockPrice", State: "succeeded", Retries: 1, Duration: 1.5}},
+	})
+	for _, want := range []string{"(1h0m0s)", "saveStockPrice  succeeded  1        1.5s", "daily  10\ntrend  8"} {
+		if !strings.Contains(detail, want) {
+			t.Errorf("detail does not contain %q:\n%s", want, detail)
+		}
+	}
+}
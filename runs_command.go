@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// runs tableから最近の日次処理の実行を一覧する。-idを指定した場合はその実行の詳細を出す
+func execRuns(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("runs", flag.ContinueOnError)
+	limit := fs.Int("limit", 10, "number of recent runs to list")
+	id := fs.String("id", "", "run id to inspect. list recent runs if empty")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %v", err)
+	}
+
+	db, err := getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to getDatabase: %v", err)
+	}
+	defer db.CloseDB()
+
+	if *id != "" {
+		run, ok, err := fetchRun(db, *id)
+		if err != nil {
+			return fmt.Errorf("failed to fetchRun: %v", err)
+		}
+		if !ok {
+			return fmt.Errorf("run not found: %s", *id)
+		}
+		fmt.Print(formatRun(run))
+		return nil
+	}
+	runs, err := fetchRuns(db, *limit)
+	if err != nil {
+		return fmt.Errorf("failed to fetchRuns: %v", err)
+	}
+	fmt.Print(formatRuns(runs))
+	return nil
+}
+
+// 実行中のものはdurationを空にする
+func runDuration(r *RunLedger) string {
+	if r.Result == runRunning {
+		return ""
+	}
+	return r.FinishedAt.Sub(r.StartedAt).String()
+}
+
+func formatRuns(runs []*RunLedger) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN_ID\tSTARTED\tDURATION\tENV\tTARGET\tRESULT\tATTEMPTED\tSUCCEEDED\tFAILED\tQUARANTINED")
+	for _, r := range runs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\n",
+			r.ID, r.StartedAt.In(jst).Format(runTimeLayout), runDuration(r), r.Env, r.TargetDate, r.Result,
+			r.Attempted, r.Succeeded, r.Failed, r.Quarantined)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+func formatRun(r *RunLedger) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "run id:      %s\n", r.ID)
+	fmt.Fprintf(&buf, "started:     %s\n", r.StartedAt.In(jst).Format(runTimeLayout))
+	fmt.Fprintf(&buf, "finished:    %s (%s)\n", r.FinishedAt.In(jst).Format(runTimeLayout), runDuration(r))
+	fmt.Fprintf(&buf, "env:         %s\n", r.Env)
+	fmt.Fprintf(&buf, "target date: %s\n", r.TargetDate)
+	fmt.Fprintf(&buf, "result:      %s\n", r.Result)
+	fmt.Fprintf(&buf, "codes:       attempted %d, succeeded %d, failed %d, quarantined %d\n", r.Attempted, r.Succeeded, r.Failed, r.Quarantined)
+	if r.Error != "" {
+		fmt.Fprintf(&buf, "error:       %s\n", r.Error)
+	}
+
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nSTEP\tSTATE\tRETRIES\tDURATION")
+	for _, s := range r.Steps {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", s.Name, s.State, s.Retries, (time.Duration(s.Duration*1000) * time.Millisecond).String())
+	}
+	w.Flush()
+
+	tables := make([]string, 0, len(r.SubmittedRows))
+	for t := range r.SubmittedRows {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	fmt.Fprintln(w, "\nTABLE\tROWS SUBMITTED")
+	for _, t := range tables {
+		fmt.Fprintf(w, "%s\t%d\n", t, r.SubmittedRows[t])
+	}
+	w.Flush()
+	return buf.String()
+}
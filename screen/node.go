@@ -0,0 +1,116 @@
+package screen
+
+import (
+	"fmt"
+)
+
+type node interface {
+	eval(env map[string]float64) (float64, error)
+	identifiers(fn func(string))
+}
+
+type numberNode float64
+
+func (n numberNode) eval(map[string]float64) (float64, error) {
+	return float64(n), nil
+}
+
+func (n numberNode) identifiers(func(string)) {}
+
+type identNode string
+
+func (n identNode) eval(env map[string]float64) (float64, error) {
+	v, ok := env[string(n)]
+	if !ok {
+		return 0, fmt.Errorf("unknown identifier: %s", string(n))
+	}
+	return v, nil
+}
+
+func (n identNode) identifiers(fn func(string)) {
+	fn(string(n))
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n unaryNode) eval(env map[string]float64) (float64, error) {
+	v, err := n.operand.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	if n.op == "!" {
+		return boolToFloat(v == 0), nil
+	}
+	return -v, nil
+}
+
+func (n unaryNode) identifiers(fn func(string)) {
+	n.operand.identifiers(fn)
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n binaryNode) eval(env map[string]float64) (float64, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	// 短絡評価
+	if n.op == "&&" && l == 0 {
+		return 0, nil
+	}
+	if n.op == "||" && l != 0 {
+		return 1, nil
+	}
+	r, err := n.right.eval(env)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n.op {
+	case "&&", "||":
+		return boolToFloat(r != 0), nil
+	case "==":
+		return boolToFloat(l == r), nil
+	case "!=":
+		return boolToFloat(l != r), nil
+	case ">=":
+		return boolToFloat(l >= r), nil
+	case "<=":
+		return boolToFloat(l <= r), nil
+	case ">":
+		return boolToFloat(l > r), nil
+	case "<":
+		return boolToFloat(l < r), nil
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	}
+	return 0, fmt.Errorf("unknown operator: %s", n.op)
+}
+
+func (n binaryNode) identifiers(fn func(string)) {
+	n.left.identifiers(fn)
+	n.right.identifiers(fn)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
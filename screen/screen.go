@@ -0,0 +1,95 @@
+package screen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Screen is named Rule.
+type Screen struct {
+	Name string
+	Rule *Rule
+}
+
+// ParseScreens parses screens like "name1:expr1;name2:expr2".
+func ParseScreens(s string) ([]Screen, error) {
+	var screens []Screen
+	names := make(map[string]bool)
+	for _, v := range strings.Split(s, ";") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		i := strings.Index(v, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid screen: '%s'. Please set like 'name:expr'", v)
+		}
+		name := strings.TrimSpace(v[:i])
+		if names[name] {
+			return nil, fmt.Errorf("duplicate screen name: %s", name)
+		}
+		names[name] = true
+
+		rule, err := Parse(v[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to Parse screen %s: %v", name, err)
+		}
+		screens = append(screens, Screen{Name: name, Rule: rule})
+	}
+	return screens, nil
+}
+
+// Rule is parsed expression.
+type Rule struct {
+	src  string
+	root node
+}
+
+// Parse parses expression like "trend >= shortTermAdvance && continuationDays >= 3".
+func Parse(src string) (*Rule, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tokenize: %v", err)
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected token '%s' at %d", t.text, t.pos)
+	}
+	return &Rule{src: src, root: root}, nil
+}
+
+func (r *Rule) String() string {
+	return r.src
+}
+
+// Identifiers returns identifiers used in Rule.
+func (r *Rule) Identifiers() []string {
+	seen := make(map[string]bool)
+	var ids []string
+	r.root.identifiers(func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	})
+	return ids
+}
+
+// Eval evaluates Rule with env.
+// 比較や論理演算の結果は真なら1, 偽なら0として扱い、最終的に0以外なら真とする
+func (r *Rule) Eval(env map[string]float64) (bool, error) {
+	v, err := r.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+	return v != 0, nil
+}
+
+// Value evaluates Rule with env and returns the value as float64.
+func (r *Rule) Value(env map[string]float64) (float64, error) {
+	return r.root.eval(env)
+}
@@ -0,0 +1,163 @@
+package screen
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	env := map[string]float64{
+		"trend":            4,
+		"shortTermAdvance": 4,
+		"crossMoving5":     3,
+		"upwardCross":      3,
+		"continuationDays": 5,
+		"growthRate":       1.02,
+		"moving5":          110,
+		"moving20":         100,
+	}
+	tests := map[string]struct {
+		src     string
+		want    bool
+		wantErr bool
+	}{
+		"and": {
+			src:  "trend >= shortTermAdvance && crossMoving5 == upwardCross && continuationDays >= 3",
+			want: true,
+		},
+		"and_false": {
+			src:  "trend >= shortTermAdvance && continuationDays > 5",
+			want: false,
+		},
+		"or": {
+			src:  "continuationDays > 5 || growthRate > 1.01",
+			want: true,
+		},
+		"precedence": {
+			// && は || より先に評価する
+			src:  "1 == 1 || 1 == 0 && 1 == 0",
+			want: true,
+		},
+		"paren": {
+			src:  "(1 == 1 || 1 == 0) && 1 == 0",
+			want: false,
+		},
+		"not": {
+			src:  "!(trend < shortTermAdvance)",
+			want: true,
+		},
+		"arithmetic": {
+			src:  "moving5 / moving20 - 1 >= 0.1",
+			want: true,
+		},
+		"unary_minus": {
+			src:  "-growthRate < -1",
+			want: true,
+		},
+		"number_only": {
+			src:  "0",
+			want: false,
+		},
+		"unknown_identifier": {
+			src:     "volumeSpike == 1",
+			wantErr: true,
+		},
+		"short_circuit": {
+			// 左辺で決まる場合は右辺の未定義の識別子は評価しない
+			src:  "trend < 0 && volumeSpike == 1",
+			want: false,
+		},
+		"division_by_zero": {
+			src:     "moving5 / 0 > 1",
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, err := Parse(tc.src)
+			if err != nil {
+				t.Fatalf("failed to Parse: %v", err)
+			}
+			got, err := r.Eval(env)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("gotErr: %v, wantErr: %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := map[string]string{
+		"empty":          "",
+		"unclosed_paren": "(trend > 1",
+		"extra_paren":    "trend > 1)",
+		"no_operand":     "trend >",
+		"invalid_char":   "trend # 1",
+		"double_compare": "1 < 2 < 3",
+		"invalid_number": "1.2.3 > 1",
+	}
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse(src); err == nil {
+				t.Errorf("want error: %s", src)
+			}
+		})
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	r, err := Parse("trend >= shortTermAdvance && (trend < longTermAdvance || moving5 > 1)")
+	if err != nil {
+		t.Fatalf("failed to Parse: %v", err)
+	}
+	want := []string{"trend", "shortTermAdvance", "longTermAdvance", "moving5"}
+	if got := r.Identifiers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestParseScreens(t *testing.T) {
+	tests := map[string]struct {
+		s         string
+		wantNames []string
+		wantErr   bool
+	}{
+		"empty": {
+			s: "",
+		},
+		"two_screens": {
+			s:         "advance: trend >= shortTermAdvance; cross:crossMoving5 == upwardCross;",
+			wantNames: []string{"advance", "cross"},
+		},
+		"no_name": {
+			s:       ":trend > 1",
+			wantErr: true,
+		},
+		"duplicate": {
+			s:       "a:trend > 1;a:trend > 2",
+			wantErr: true,
+		},
+		"invalid_rule": {
+			s:       "a:trend >",
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			screens, err := ParseScreens(tc.s)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("gotErr: %v, wantErr: %v", err, tc.wantErr)
+			}
+			var names []string
+			for _, s := range screens {
+				names = append(names, s.Name)
+			}
+			if !reflect.DeepEqual(names, tc.wantNames) {
+				t.Errorf("got: %v, want: %v", names, tc.wantNames)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/ludwig125/gke-stockprice/candlestick"
+	"github.com/ludwig125/gke-stockprice/database"
+	"github.com/ludwig125/gke-stockprice/screen"
+)
+
+// スクリーニングの条件式で使える変数と、その値を取得するtableのカラム
+// 変数名はtableのカラム名と同じにする
+var screenVariableTables = map[string][]string{
+	"trend":       {"trend", "trendTurn", "growthRate", "crossMoving5", "continuationDays", "generalTrend"},
+	"movingavg":   {"moving3", "moving5", "moving7", "moving10", "moving20", "moving60", "moving100"},
+	"volatility":  {"bollingerUpper", "bollingerMiddle", "bollingerLower", "percentB", "bandwidth", "atr", "historicalVolatility", "squeeze", "bandBreakout"},
+	"volume":      {"volumeMovingAvg5", "volumeMovingAvg20", "obv", "volumeRatio", "volumeZScore", "volumeSpike"},
+	"highlow":     {"rollingHigh", "rollingLow", "distanceToHigh", "distanceToLow", "highLowEvent"},
+	"daily":       {"open", "high", "low", "close", "turnover"},
+	patternsTable: candlestick.PatternNames(), // hammer == true のように書く
+}
+
+// スクリーニングの条件式で使える定数
+// trend >= shortTermAdvance のように各typeのconstを名前で書けるようにする
+func screenConstants() map[string]float64 {
+	consts := map[string]float64{
+		"true":  1,
+		"false": 0,
+	}
+	for t := unknown; t <= longTermAdvance; t++ {
+		consts[t.String()] = float64(t)
+	}
+	for t := unknownTurn; t <= upwardTurn; t++ {
+		consts[t.String()] = float64(t)
+	}
+	for c := unknownCross; c <= upwardCross; c++ {
+		consts[c.String()] = float64(c)
+	}
+	for g := unknownGeneralTrend; g <= veryStrongBuy; g++ {
+		consts[g.String()] = float64(g)
+	}
+	for b := unknownBreakout; b <= upwardBreakout; b++ {
+		consts[b.String()] = float64(b)
+	}
+	for h := unknownHighLowEvent; h <= breakout; h++ {
+		consts[h.String()] = float64(h)
+	}
+	return consts
+}
+
+// 条件式の変数から値を取得するtableを返す
+func screenVariableTable(variable string) (string, bool) {
+	for table, columns := range screenVariableTables {
+		for _, c := range columns {
+			if c == variable {
+				return table, true
+			}
+		}
+	}
+	return "", false
+}
+
+// 条件式で使われている識別子がすべて変数か定数であることを確認する
+func validateScreens(screens []screen.Screen) error {
+	consts := screenConstants()
+	for _, s := range screens {
+		for _, id := range s.Rule.Identifiers() {
+			if _, ok := consts[id]; ok {
+				continue
+			}
+			if _, ok := screenVariableTable(id); !ok {
+				return fmt.Errorf("unknown identifier '%s' in screen %s", id, s.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// 銘柄ごとに条件式を評価するための変数と定数のMapを作る
+// 条件式で使われている変数のtableだけ参照する
+func buildScreenEnvs(db database.DB, screens []screen.Screen, codes []string, date string) (map[string]map[string]float64, error) {
+	tableColumns := make(map[string][]string)
+	for _, s := range screens {
+		for _, id := range s.Rule.Identifiers() {
+			if table, ok := screenVariableTable(id); ok {
+				tableColumns[table] = screenVariableTables[table]
+			}
+		}
+	}
+
+	consts := screenConstants()
+	envs := make(map[string]map[string]float64, len(codes))
+	for _, code := range codes {
+		env := make(map[string]float64, len(consts))
+		for k, v := range consts {
+			env[k] = v
+		}
+		envs[code] = env
+	}
+	for table, columns := range tableColumns {
+		if table == patternsTable {
+			codeDatePatterns, err := fetchCodeDatePatterns(db, table, codes, date, date)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetchCodeDatePatterns: %v", err)
+			}
+			for code, env := range envs {
+				for k, v := range patternValues(codeDatePatterns[code][date]) {
+					env[k] = v
+				}
+			}
+			continue
+		}
+		codeValues, err := fetchCodeValues(db, table, columns, codes, date)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetchCodeValues: %v", err)
+		}
+		for code, values := range codeValues {
+			env, ok := envs[code]
+			if !ok {
+				continue
+			}
+			for k, v := range values {
+				env[k] = v
+			}
+		}
+	}
+	return envs, nil
+}
+
+// 条件に合致した銘柄を昇順で返す
+// 変数の値がない銘柄は条件に合致しないものとする
+func screenCodes(s screen.Screen, envs map[string]map[string]float64) []string {
+	var codes []string
+	var evalErrs int
+	for code, env := range envs {
+		ok, err := s.Rule.Eval(env)
+		if err != nil {
+			evalErrs++
+			continue
+		}
+		if ok {
+			codes = append(codes, code)
+		}
+	}
+	if evalErrs > 0 {
+		log.Printf("screen %s: failed to evaluate %d codes", s.Name, evalErrs)
+	}
+	sort.Strings(codes)
+	return codes
+}
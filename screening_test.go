@@ -0,0 +1,71 @@
+// +build !integration
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ludwig125/gke-stockprice/screen"
+)
+
+func TestValidateScreens(t *testing.T) {
+	tests := map[string]struct {
+		rules   string
+		wantErr bool
+	}{
+		"trend_and_constants": {
+			rules: "a:trend >= shortTermAdvance && crossMoving5 == upwardCross && continuationDays >= 3",
+		},
+		"other_tables": {
+			rules: "b:moving5 > moving20 && volumeSpike == true && bandBreakout == upwardBreakout && close > 100",
+		},
+		"patterns": {
+			rules: "c:hammer == true && trend <= shortTermDecline",
+		},
+		"unknown_identifier": {
+			rules:   "c:rsi > 70",
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			screens, err := screen.ParseScreens(tc.rules)
+			if err != nil {
+				t.Fatalf("failed to ParseScreens: %v", err)
+			}
+			if err := validateScreens(screens); (err != nil) != tc.wantErr {
+				t.Errorf("gotErr: %v, wantErr: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestScreenCodes(t *testing.T) {
+	screens, err := screen.ParseScreens("advance:trend >= shortTermAdvance && continuationDays >= 3")
+	if err != nil {
+		t.Fatalf("failed to ParseScreens: %v", err)
+	}
+	consts := screenConstants()
+	env := func(vars map[string]float64) map[string]float64 {
+		e := make(map[string]float64)
+		for k, v := range consts {
+			e[k] = v
+		}
+		for k, v := range vars {
+			e[k] = v
+		}
+		return e
+	}
+	envs := map[string]map[string]float64{
+		"1003": env(map[string]float64{"trend": float64(longTermAdvance), "continuationDays": 5}),
+		"1001": env(map[string]float64{"trend": float64(shortTermAdvance), "continuationDays": 3}),
+		"1002": env(map[string]float64{"trend": float64(non), "continuationDays": 10}),
+		"1004": env(map[string]float64{"trend": float64(shortTermAdvance), "continuationDays": 1}),
+		"1005": env(nil), // trendのデータがない銘柄
+	}
+	want := []string{"1001", "1003"}
+	if got := screenCodes(screens[0], envs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
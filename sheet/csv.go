@@ -0,0 +1,69 @@
+package sheet
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CSVSheet is Sheet backed by a local CSV file.
+// Google Spreadsheetを使わずに手元で動かす場合やテストで使う
+type CSVSheet struct {
+	Path string
+}
+
+// NewCSVSheet returns CSVSheet of dir/name.csv.
+func NewCSVSheet(dir, name string) Sheet {
+	return CSVSheet{Path: filepath.Join(dir, name+".csv")}
+}
+
+// Read reads all rows. ファイルがなければ空として扱う
+func (c CSVSheet) Read() ([][]string, error) {
+	f, err := os.Open(c.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", c.Path, err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1 // 行ごとに列数が違ってもよい
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", c.Path, err)
+	}
+	return rows, nil
+}
+
+// Insert appends rows without clearing.
+func (c CSVSheet) Insert(inputs [][]string) error {
+	return c.write(inputs, os.O_APPEND)
+}
+
+// Update clears the file and writes rows.
+func (c CSVSheet) Update(inputs [][]string) error {
+	return c.write(inputs, os.O_TRUNC)
+}
+
+// Clear deletes all rows.
+func (c CSVSheet) Clear() error {
+	return c.write(nil, os.O_TRUNC)
+}
+
+func (c CSVSheet) write(inputs [][]string, flag int) error {
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0755); err != nil {
+		return fmt.Errorf("failed to MkdirAll: %v", err)
+	}
+	f, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_CREATE|flag, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", c.Path, err)
+	}
+	if err := csv.NewWriter(f).WriteAll(inputs); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %v", c.Path, err)
+	}
+	return f.Close()
+}
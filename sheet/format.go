@@ -0,0 +1,194 @@
+package sheet
+
+import (
+	"fmt"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// Formatter is Sheet which can be formatted.
+// 書式はSheetごとに違うので、Sheet interfaceとは別にしてtype assertionで使う
+type Formatter interface {
+	Format(f Format) error
+}
+
+// Format is formatting of a sheet.
+type Format struct {
+	FrozenRows    int64          // 固定する先頭の行数
+	BoldHeader    bool           // 先頭の行を太字にする
+	NumberFormats []NumberFormat // 列ごとの数値の表示形式
+	TextRules     []TextRule     // 値に応じた条件付き書式
+}
+
+// NumberFormat is number format of a column.
+type NumberFormat struct {
+	Column  int64  // 0始まりの列番号
+	Pattern string // 例: "0.000"
+}
+
+// TextRule is conditional format applied when a cell of the column equals Text.
+type TextRule struct {
+	Column     int64 // 0始まりの列番号
+	Text       string
+	Background *Color // nilの場合は背景色を変えない
+	Bold       bool
+}
+
+// Color is RGB color. Each value is between 0 and 1.
+type Color struct {
+	Red   float64
+	Green float64
+	Blue  float64
+}
+
+// Format applies formatting to the sheet by batchUpdate.
+// 以前に設定した条件付き書式は削除してから設定し直す
+func (s SpreadSheet) Format(f Format) error {
+	spreadSheet, err := s.getSpreadsheet()
+	if err != nil {
+		return fmt.Errorf("failed to getSpreadsheet: %v", err)
+	}
+	var target *sheets.Sheet
+	for _, sh := range spreadSheet.Sheets {
+		if sh.Properties.Title == s.ReadRange {
+			target = sh
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("failed to match sheet title. SpreadsheetID: %s, ReadRange: %s", s.SpreadsheetID, s.ReadRange)
+	}
+
+	rb := &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: formatRequests(target.Properties.SheetId, len(target.ConditionalFormats), f),
+	}
+	if err := s.batchUpdate("format", rb); err != nil {
+		return fmt.Errorf("unable to BatchUpdate: %w", err)
+	}
+	return nil
+}
+
+// existingRulesはすでにSheetに設定されている条件付き書式の数
+func formatRequests(sheetID int64, existingRules int, f Format) []*sheets.Request {
+	var reqs []*sheets.Request
+
+	// 条件付き書式は削除すると後ろが詰まるので、先頭を既存の数だけ削除する
+	for i := 0; i < existingRules; i++ {
+		reqs = append(reqs, &sheets.Request{
+			DeleteConditionalFormatRule: &sheets.DeleteConditionalFormatRuleRequest{
+				Index:           0,
+				SheetId:         sheetID,
+				ForceSendFields: []string{"Index", "SheetId"},
+			},
+		})
+	}
+
+	if f.FrozenRows > 0 {
+		reqs = append(reqs, &sheets.Request{
+			UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
+				Properties: &sheets.SheetProperties{
+					SheetId:        sheetID,
+					GridProperties: &sheets.GridProperties{FrozenRowCount: f.FrozenRows},
+				},
+				Fields: "gridProperties.frozenRowCount",
+			},
+		})
+	}
+
+	if f.BoldHeader {
+		reqs = append(reqs, &sheets.Request{
+			RepeatCell: &sheets.RepeatCellRequest{
+				Range: &sheets.GridRange{SheetId: sheetID, StartRowIndex: 0, EndRowIndex: 1, ForceSendFields: []string{"SheetId"}},
+				Cell: &sheets.CellData{
+					UserEnteredFormat: &sheets.CellFormat{TextFormat: &sheets.TextFormat{Bold: true}},
+				},
+				Fields: "userEnteredFormat.textFormat.bold",
+			},
+		})
+	}
+
+	// 数値の表示形式と条件付き書式は先頭の行(カラム名)を除いて設定する
+	for _, n := range f.NumberFormats {
+		reqs = append(reqs, &sheets.Request{
+			RepeatCell: &sheets.RepeatCellRequest{
+				Range: columnRange(sheetID, n.Column),
+				Cell: &sheets.CellData{
+					UserEnteredFormat: &sheets.CellFormat{
+						NumberFormat: &sheets.NumberFormat{Type: "NUMBER", Pattern: n.Pattern},
+					},
+				},
+				Fields: "userEnteredFormat.numberFormat",
+			},
+		})
+	}
+
+	for i, r := range f.TextRules {
+		format := &sheets.CellFormat{}
+		if r.Background != nil {
+			format.BackgroundColor = &sheets.Color{Red: r.Background.Red, Green: r.Background.Green, Blue: r.Background.Blue}
+		}
+		if r.Bold {
+			format.TextFormat = &sheets.TextFormat{Bold: true}
+		}
+		reqs = append(reqs, &sheets.Request{
+			AddConditionalFormatRule: &sheets.AddConditionalFormatRuleRequest{
+				Index: int64(i),
+				Rule: &sheets.ConditionalFormatRule{
+					Ranges: []*sheets.GridRange{columnRange(sheetID, r.Column)},
+					BooleanRule: &sheets.BooleanRule{
+						Condition: &sheets.BooleanCondition{
+							Type:   "TEXT_EQ",
+							Values: []*sheets.ConditionValue{{UserEnteredValue: r.Text}},
+						},
+						Format: format,
+					},
+				},
+				ForceSendFields: []string{"Index"},
+			},
+		})
+	}
+	return reqs
+}
+
+// 2行目以降の1列
+func columnRange(sheetID, column int64) *sheets.GridRange {
+	return &sheets.GridRange{
+		SheetId:          sheetID,
+		StartRowIndex:    1,
+		StartColumnIndex: column,
+		EndColumnIndex:   column + 1,
+		ForceSendFields:  []string{"SheetId", "StartColumnIndex"},
+	}
+}
+
+// TabAdder is Sheet which can add its tab before reading.
+// ローカルのファイルはタブがなくても空として読めるので、SpreadSheetだけが実装する
+type TabAdder interface {
+	AddSheetIfMissing() error
+}
+
+// AddSheetIfMissing adds the tab if the spreadsheet does not have it.
+func (s SpreadSheet) AddSheetIfMissing() error {
+	var resp *sheets.Spreadsheet
+	if err := s.call("get sheet titles", "", func() error {
+		r, err := s.Service.Spreadsheets.Get(s.SpreadsheetID).Fields("sheets.properties.title").Do()
+		resp = r
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to get spreadsheet: %w", err)
+	}
+	for _, sh := range resp.Sheets {
+		if sh.Properties.Title == s.ReadRange {
+			return nil
+		}
+	}
+
+	rb := &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{{
+			AddSheet: &sheets.AddSheetRequest{Properties: &sheets.SheetProperties{Title: s.ReadRange}},
+		}},
+	}
+	if err := s.batchUpdate("add sheet", rb); err != nil {
+		return fmt.Errorf("unable to add sheet: %w", err)
+	}
+	return nil
+}
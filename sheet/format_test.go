@@ -0,0 +1,51 @@
+package sheet
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFormatRequests(t *testing.T) {
+	f := Format{
+		FrozenRows:    1,
+		BoldHeader:    true,
+		NumberFormats: []NumberFormat{{Column: 3, Pattern: "0.000"}},
+		TextRules: []TextRule{
+			{Column: 1, Text: "longTermAdvance", Background: &Color{Green: 1}},
+			{Column: 2, Text: "upwardTurn", Bold: true},
+		},
+	}
+	reqs := formatRequests(10, 2, f)
+
+	var got []string
+	for _, r := range reqs {
+		b, err := json.Marshal(r)
+		if err != nil {
+			t.Fatalf("failed to Marshal: %v", err)
+		}
+		got = append(got, string(b))
+	}
+	want := []string{
+		`{"deleteConditionalFormatRule":{"index":0,"sheetId":10}}`,
+		`{"deleteConditionalFormatRule":{"index":0,"sheetId":10}}`,
+		`{"updateSheetProperties":{"fields":"gridProperties.frozenRowCount","properties":{"gridProperties":{"frozenRowCount":1},"sheetId":10}}}`,
+		`{"repeatCell":{"cell":{"userEnteredFormat":{"textFormat":{"bold":true}}},"fields":"userEnteredFormat.textFormat.bold","range":{"endRowIndex":1,"sheetId":10}}}`,
+		`{"repeatCell":{"cell":{"userEnteredFormat":{"numberFormat":{"pattern":"0.000","type":"NUMBER"}}},"fields":"userEnteredFormat.numberFormat","range":{"endColumnIndex":4,"sheetId":10,"startColumnIndex":3,"startRowIndex":1}}}`,
+		`{"addConditionalFormatRule":{"index":0,"rule":{"booleanRule":{"condition":{"type":"TEXT_EQ","values":[{"userEnteredValue":"longTermAdvance"}]},"format":{"backgroundColor":{"green":1}}},"ranges":[{"endColumnIndex":2,"sheetId":10,"startColumnIndex":1,"startRowIndex":1}]}}}`,
+		`{"addConditionalFormatRule":{"index":1,"rule":{"booleanRule":{"condition":{"type":"TEXT_EQ","values":[{"userEnteredValue":"upwardTurn"}]},"format":{"textFormat":{"bold":true}}},"ranges":[{"endColumnIndex":3,"sheetId":10,"startColumnIndex":2,"startRowIndex":1}]}}}`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d requests, want %d requests: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("request %d\ngot:  %s\nwant: %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFormatRequestsEmpty(t *testing.T) {
+	if reqs := formatRequests(0, 0, Format{}); len(reqs) != 0 {
+		t.Errorf("got %d requests, want no request", len(reqs))
+	}
+}
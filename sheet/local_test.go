@@ -0,0 +1,119 @@
+package sheet
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLocalSheets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sheet")
+	if err != nil {
+		t.Fatalf("failed to TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sheets := map[string]Sheet{
+		"csv":  NewCSVSheet(filepath.Join(dir, "csv"), "trend"),
+		"xlsx": NewXLSXSheet(filepath.Join(dir, "trend.xlsx"), "trend"),
+	}
+	for name, s := range sheets {
+		t.Run(name, func(t *testing.T) {
+			got, err := s.Read()
+			if err != nil {
+				t.Fatalf("failed to Read: %v", err)
+			}
+			if len(got) != 0 {
+				t.Errorf("got: %v, want empty before writing", got)
+			}
+
+			data := [][]string{
+				{"code", "trend", "growthRate", "20210105"},
+				{"1301", "longTermAdvance", "1.093"},
+				{"0012", "a,b \"c\" <d> & e", ""},
+			}
+			if err := s.Update(data); err != nil {
+				t.Fatalf("failed to Update: %v", err)
+			}
+			if err := s.Insert([][]string{{"1302", "non", "-0.5"}}); err != nil {
+				t.Fatalf("failed to Insert: %v", err)
+			}
+			got, err = s.Read()
+			if err != nil {
+				t.Fatalf("failed to Read: %v", err)
+			}
+			want := append(data, []string{"1302", "non", "-0.5"})
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got: %q\nwant: %q", got, want)
+			}
+
+			if err := s.Update(data[:1]); err != nil {
+				t.Fatalf("failed to Update: %v", err)
+			}
+			if got, _ = s.Read(); !reflect.DeepEqual(got, data[:1]) {
+				t.Errorf("got: %q, want: %q", got, data[:1])
+			}
+
+			if err := s.Clear(); err != nil {
+				t.Fatalf("failed to Clear: %v", err)
+			}
+			if got, _ = s.Read(); len(got) != 0 {
+				t.Errorf("got: %v, want empty after Clear", got)
+			}
+		})
+	}
+}
+
+func TestXLSXSheetTabs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sheet")
+	if err != nil {
+		t.Fatalf("failed to TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "trend.xlsx")
+	trend := NewXLSXSheet(path, "trend")
+	crossover := NewXLSXSheet(path, "crossover")
+	if err := trend.Update([][]string{{"a"}}); err != nil {
+		t.Fatalf("failed to Update: %v", err)
+	}
+	if err := crossover.Update([][]string{{"b", "", "c"}}); err != nil {
+		t.Fatalf("failed to Update: %v", err)
+	}
+
+	// 別のタブを書き込んでも消えない
+	if got, _ := trend.Read(); !reflect.DeepEqual(got, [][]string{{"a"}}) {
+		t.Errorf("trend got: %v", got)
+	}
+	if got, _ := crossover.Read(); !reflect.DeepEqual(got, [][]string{{"b", "", "c"}}) {
+		t.Errorf("crossover got: %v", got)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("failed to open xlsx as zip: %v", err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	want := []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got: %v, want: %v", names, want)
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) got: %s, want: %s", i, got, want)
+		}
+		if got := columnIndex(want + "12"); got != i {
+			t.Errorf("columnIndex(%s12) got: %d, want: %d", want, got, i)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package sheet
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+
+	"github.com/ludwig125/gke-stockprice/retry"
+)
+
+// Sheets APIは1リクエストのpayloadと1分あたりのリクエスト数に上限があるので、
+// 大きな書き込みは分割し、429や5xxは間隔を伸ばしながらリトライする
+// ref. https://developers.google.com/sheets/api/limits
+const (
+	defaultChunkRows = 500 // 1回のAppendで書き込む行数
+	maxAttempts      = 5
+)
+
+// テストで待たないように変数にしておく
+var (
+	initialBackoff = 2 * time.Second
+	maxBackoff     = 32 * time.Second
+)
+
+// ErrBudgetExceeded is returned when requests exceed the Budget.
+var ErrBudgetExceeded = errors.New("sheet request budget exceeded")
+
+// Budget is the number of Sheets API requests allowed in a run.
+// 複数のSpreadSheetで同じBudgetを共有して、1回の実行で使うリクエスト数を制限する
+type Budget struct {
+	mu    sync.Mutex
+	limit int
+	used  int
+}
+
+// NewBudget returns Budget. limitが0以下なら無制限
+func NewBudget(limit int) *Budget {
+	return &Budget{limit: limit}
+}
+
+// Used returns the number of requests used.
+func (b *Budget) Used() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+func (b *Budget) take() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limit > 0 && b.used >= b.limit {
+		return fmt.Errorf("%w: used %d of %d", ErrBudgetExceeded, b.used, b.limit)
+	}
+	b.used++
+	return nil
+}
+
+// RequestError is error of a Sheets API request with the range which failed.
+type RequestError struct {
+	Op            string // "read", "append"など
+	SpreadsheetID string
+	Range         string // タブ名
+	Rows          string // 分割して書き込んだ場合に失敗した入力の行。例: "501-1000/1200"
+	Err           error
+}
+
+func (e *RequestError) Error() string {
+	if e.Rows != "" {
+		return fmt.Sprintf("failed to %s sheetID: %s, range: %s, rows: %s: %v", e.Op, e.SpreadsheetID, e.Range, e.Rows, e.Err)
+	}
+	return fmt.Sprintf("failed to %s sheetID: %s, range: %s: %v", e.Op, e.SpreadsheetID, e.Range, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Budgetを1つ使ってfnを実行し、429や5xxならリトライする。リトライもBudgetを使う
+func (s SpreadSheet) call(op, rows string, fn func() error) error {
+	return s.callWith(op, rows, isRetryable, fn)
+}
+
+// retryableがtrueを返すエラーならリトライする
+func (s SpreadSheet) callWith(op, rows string, retryable func(error) bool, fn func() error) error {
+	err := retry.Backoff(maxAttempts, initialBackoff, maxBackoff, retryable, func() error {
+		if err := s.Budget.take(); err != nil {
+			return err
+		}
+		return fn()
+	})
+	if err != nil {
+		return &RequestError{Op: op, SpreadsheetID: s.SpreadsheetID, Range: s.ReadRange, Rows: rows, Err: err}
+	}
+	return nil
+}
+
+// 429(Too Many Requests)と5xxは時間をおけば成功する可能性がある
+func isRetryable(err error) bool {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) {
+		return false
+	}
+	return gerr.Code == 429 || gerr.Code >= 500
+}
+
+// 5xxや通信エラーではリクエストが処理されたかどうかわからない
+// 429はリクエストを処理する前に拒否される
+func isAmbiguous(err error) bool {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		return gerr.Code >= 500
+	}
+	var uerr *url.Error
+	return errors.As(err, &uerr)
+}
+
+// appendは冪等ではないので、5xxや通信エラーは書き込まれていないことを確かめてから返す
+// appendChunkから返ってきたこれらのエラーはリトライしてよい
+func isRetryableAppend(err error) bool {
+	var uerr *url.Error
+	return isRetryable(err) || errors.As(err, &uerr)
+}
+
+// inputsをsize行ずつに分割する
+func chunkRows(inputs [][]string, size int) [][][]string {
+	if size <= 0 {
+		size = defaultChunkRows
+	}
+	var chunks [][][]string
+	for i := 0; i < len(inputs); i += size {
+		end := i + size
+		if end > len(inputs) {
+			end = len(inputs)
+		}
+		chunks = append(chunks, inputs[i:end])
+	}
+	return chunks
+}
@@ -0,0 +1,146 @@
+package sheet
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestChunkRows(t *testing.T) {
+	inputs := [][]string{{"1"}, {"2"}, {"3"}, {"4"}, {"5"}}
+
+	cases := map[string]struct {
+		inputs [][]string
+		size   int
+		want   [][][]string
+	}{
+		"divisible": {
+			inputs: inputs[:4],
+			size:   2,
+			want:   [][][]string{{{"1"}, {"2"}}, {{"3"}, {"4"}}},
+		},
+		"remainder": {
+			inputs: inputs,
+			size:   2,
+			want:   [][][]string{{{"1"}, {"2"}}, {{"3"}, {"4"}}, {{"5"}}},
+		},
+		"default_size": {
+			inputs: inputs,
+			size:   0,
+			want:   [][][]string{inputs},
+		},
+		"empty": {
+			inputs: nil,
+			size:   2,
+			want:   nil,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := chunkRows(tc.inputs, tc.size); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBudget(t *testing.T) {
+	b := NewBudget(2)
+	for i := 0; i < 2; i++ {
+		if err := b.take(); err != nil {
+			t.Fatalf("failed to take %d: %v", i, err)
+		}
+	}
+	if err := b.take(); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("got error: %v, want ErrBudgetExceeded", err)
+	}
+	if got := b.Used(); got != 2 {
+		t.Errorf("got used: %d, want 2", got)
+	}
+
+	// 0以下とnilは無制限
+	unlimited := NewBudget(0)
+	for i := 0; i < 10; i++ {
+		if err := unlimited.take(); err != nil {
+			t.Fatalf("failed to take %d: %v", i, err)
+		}
+	}
+	var nilBudget *Budget
+	if err := nilBudget.take(); err != nil {
+		t.Errorf("failed to take nil budget: %v", err)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	cases := map[string]struct {
+		err  error
+		want bool
+	}{
+		"too_many_requests": {err: &googleapi.Error{Code: 429}, want: true},
+		"internal_error":    {err: &googleapi.Error{Code: 500}, want: true},
+		"unavailable":       {err: fmt.Errorf("wrapped: %w", &googleapi.Error{Code: 503}), want: true},
+		"bad_request":       {err: &googleapi.Error{Code: 400}, want: false},
+		"budget_exceeded":   {err: ErrBudgetExceeded, want: false},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := isRetryable(tc.err); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsRetryableAppend(t *testing.T) {
+	cases := map[string]struct {
+		err       error
+		ambiguous bool
+		retryable bool
+	}{
+		"too_many_requests": {err: &googleapi.Error{Code: 429}, ambiguous: false, retryable: true},
+		"unavailable":       {err: &googleapi.Error{Code: 503}, ambiguous: true, retryable: true},
+		"transport":         {err: &url.Error{Op: "Post", URL: "https://sheets.googleapis.com", Err: errors.New("connection reset")}, ambiguous: true, retryable: true},
+		"bad_request":       {err: &googleapi.Error{Code: 400}, ambiguous: false, retryable: false},
+		"rows_changed":      {err: fmt.Errorf("rows changed: %v", &googleapi.Error{Code: 503}), ambiguous: false, retryable: false},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := isAmbiguous(tc.err); got != tc.ambiguous {
+				t.Errorf("got ambiguous %v, want %v", got, tc.ambiguous)
+			}
+			if got := isRetryableAppend(tc.err); got != tc.retryable {
+				t.Errorf("got retryable %v, want %v", got, tc.retryable)
+			}
+		})
+	}
+}
+
+func TestRequestError(t *testing.T) {
+	cases := map[string]struct {
+		err  *RequestError
+		want string
+	}{
+		"with_rows": {
+			err:  &RequestError{Op: "append", SpreadsheetID: "id", Range: "trend", Rows: "501-1000/1200", Err: ErrBudgetExceeded},
+			want: "failed to append sheetID: id, range: trend, rows: 501-1000/1200: sheet request budget exceeded",
+		},
+		"without_rows": {
+			err:  &RequestError{Op: "read", SpreadsheetID: "id", Range: "trend", Err: ErrBudgetExceeded},
+			want: "failed to read sheetID: id, range: trend: sheet request budget exceeded",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.err.Error(); got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+			if !errors.Is(tc.err, ErrBudgetExceeded) {
+				t.Errorf("failed to unwrap %v", tc.err)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 
 	"golang.org/x/oauth2/google" // to get sheet client
+	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 )
 
@@ -16,23 +17,51 @@ import (
 // ref. https://developers.google.com/sheets/api/quickstart/go
 // 他参考: https://developers.google.com/sheets/api/quickstart/go#step_3_set_up_the_sample
 // spreadsheets clientを取得
-func GetSheetClient(ctx context.Context, sheetCredential string) (*sheets.Service, error) {
-	// googleAPIへのclientを作成
-	client, err := getClientWithJSON(ctx, sheetCredential)
-	if err != nil {
-		return nil, fmt.Errorf("failed to getClientWithJSON: %v", err)
+func GetSheetClient(ctx context.Context, sheetCredential string, opts ...ClientOption) (*sheets.Service, error) {
+	var conf clientConfig
+	for _, o := range opts {
+		o(&conf)
+	}
+
+	var options []option.ClientOption
+	if conf.endpoint != "" {
+		options = append(options, option.WithEndpoint(conf.endpoint))
+	}
+	if sheetCredential == "" && conf.endpoint != "" {
+		// テスト用のfake serverなど認証の不要なendpoint
+		options = append(options, option.WithoutAuthentication())
+	} else {
+		// googleAPIへのclientを作成
+		client, err := getClientWithJSON(ctx, sheetCredential)
+		if err != nil {
+			return nil, fmt.Errorf("failed to getClientWithJSON: %v", err)
+		}
+		options = append(options, option.WithHTTPClient(client))
 	}
 	// spreadsheets clientを取得
-	// TODO: deprecatedなので直す
-	// https://godoc.org/google.golang.org/api/sheets/v4#New
-	// > Deprecated: please use NewService instead. To provide a custom HTTP client, use option.WithHTTPClient. If you are using google.golang.org/api/googleapis/transport.APIKey, use option.WithAPIKey with NewService instead.
-	srv, err := sheets.New(client)
+	// https://godoc.org/google.golang.org/api/sheets/v4#NewService
+	srv, err := sheets.NewService(ctx, options...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve Sheets Client: %v", err)
 	}
 	return srv, nil
 }
 
+// ClientOption is option of GetSheetClient.
+type ClientOption func(*clientConfig)
+
+type clientConfig struct {
+	endpoint string
+}
+
+// WithEndpoint overrides the Sheets API endpoint. e.g. URL of sheettest.Server
+// endpointを指定してsheetCredentialが空の場合は認証しない
+func WithEndpoint(endpoint string) ClientOption {
+	return func(c *clientConfig) {
+		c.endpoint = endpoint
+	}
+}
+
 func getClientWithJSON(ctx context.Context, sheetCredential string) (*http.Client, error) {
 	data, err := ioutil.ReadFile(sheetCredential)
 	if err != nil {
@@ -58,8 +87,10 @@ type Sheet interface {
 // SpreadSheet has SpreadsheetID and ReadRange to identify sheet
 type SpreadSheet struct {
 	Service       *sheets.Service
-	SpreadsheetID string // sheetのID
-	ReadRange     string // sheetのタブ名
+	SpreadsheetID string  // sheetのID
+	ReadRange     string  // sheetのタブ名
+	ChunkRows     int     // 1回のAppendで書き込む行数。0ならdefaultChunkRows
+	Budget        *Budget // nilならリクエスト数を制限しない
 }
 
 // NewSpreadSheet return SpreadSheet
@@ -74,13 +105,19 @@ func NewSpreadSheet(srv *sheets.Service, id string, name string) Sheet {
 // ReadSheet fetch data from spread sheet
 func (s SpreadSheet) Read() ([][]string, error) {
 	// ref. https://developers.google.com/sheets/api/reference/rest/v4/spreadsheets.values/get
-	resp, err := s.Service.Spreadsheets.Values.Get(s.SpreadsheetID, s.ReadRange).Do()
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve data from sheet: %v, sheetID: %s, readRange: %s", err, s.SpreadsheetID, s.ReadRange)
-	}
-	status := resp.ServerResponse.HTTPStatusCode
-	if status != 200 {
-		return nil, fmt.Errorf("error HTTPstatus: %v", status)
+	var resp *sheets.ValueRange
+	if err := s.call("read", "", func() error {
+		r, err := s.Service.Spreadsheets.Values.Get(s.SpreadsheetID, s.ReadRange).Do()
+		if err != nil {
+			return err
+		}
+		if status := r.ServerResponse.HTTPStatusCode; status != 200 {
+			return fmt.Errorf("error HTTPstatus: %v", status)
+		}
+		resp = r
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to retrieve data from sheet: %w", err)
 	}
 
 	// [][]interface{}を[][]stringに変換する
@@ -101,18 +138,22 @@ func (s SpreadSheet) Read() ([][]string, error) {
 
 // Insert write data to spreadsheet without clearing
 func (s SpreadSheet) Insert(inputs [][]string) error {
-	if err := write(s.Service, s.SpreadsheetID, s.ReadRange, inputs); err != nil {
+	if err := s.write(inputs); err != nil {
 		return fmt.Errorf("failed to write sheet: %w", err)
 	}
 	return nil
 }
 
 // Update clear spreadsheet and write data
+// タブがなければ追加してから書き込む
 func (s SpreadSheet) Update(inputs [][]string) error {
+	if err := s.AddSheetIfMissing(); err != nil {
+		return fmt.Errorf("failed to AddSheetIfMissing: %w", err)
+	}
 	if err := s.Clear(); err != nil {
 		return fmt.Errorf("failed to clear sheet: %w", err)
 	}
-	if err := write(s.Service, s.SpreadsheetID, s.ReadRange, inputs); err != nil {
+	if err := s.write(inputs); err != nil {
 		return fmt.Errorf("failed to write sheet: %w", err)
 	}
 	return nil
@@ -120,13 +161,17 @@ func (s SpreadSheet) Update(inputs [][]string) error {
 
 // Clear delete all spreadsheet data.
 func (s SpreadSheet) Clear() error {
-	resp, err := s.Service.Spreadsheets.Values.Clear(s.SpreadsheetID, s.ReadRange, &sheets.ClearValuesRequest{}).Do()
-	if err != nil {
-		return fmt.Errorf("unable to clear value. %v", err)
-	}
-	status := resp.ServerResponse.HTTPStatusCode
-	if status != 200 {
-		return fmt.Errorf("HTTPstatus error. %v", status)
+	if err := s.call("clear", "", func() error {
+		resp, err := s.Service.Spreadsheets.Values.Clear(s.SpreadsheetID, s.ReadRange, &sheets.ClearValuesRequest{}).Do()
+		if err != nil {
+			return err
+		}
+		if status := resp.ServerResponse.HTTPStatusCode; status != 200 {
+			return fmt.Errorf("HTTPstatus error. %v", status)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to clear value: %w", err)
 	}
 	// 10000行を超えるセルはClearの際に削除して余計な空白セルを増大させないようにする
 	if err := s.deleteRowMoreThan(10000); err != nil {
@@ -169,13 +214,8 @@ func (s SpreadSheet) deleteRowMoreThan(rowThresHold int64) error {
 		Requests: []*sheets.Request{&req},
 	}
 
-	resp, err := s.Service.Spreadsheets.BatchUpdate(s.SpreadsheetID, rb).Do()
-	if err != nil {
-		return fmt.Errorf("unable to BatchUpdate: %v, rowThresHold: %d", err, rowThresHold)
-	}
-	status := resp.ServerResponse.HTTPStatusCode
-	if status != 200 {
-		return fmt.Errorf("HTTPstatus error. %v", status)
+	if err := s.batchUpdate("delete rows", rb); err != nil {
+		return fmt.Errorf("unable to BatchUpdate: %w, rowThresHold: %d", err, rowThresHold)
 	}
 	return nil
 }
@@ -231,35 +271,116 @@ func (s SpreadSheet) getSpreadsheet() (*sheets.Spreadsheet, error) {
 
 	// Rangesメソッドでシートの絞り込みをしないとSpreadsheet内の全シートの情報が得られる
 	includeGridData := true
-	resp, err := s.Service.Spreadsheets.Get(s.SpreadsheetID).Ranges(s.ReadRange).IncludeGridData(includeGridData).Do()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get spreadsheet: %v, sheetID: %s, readRange: %s", err, s.SpreadsheetID, s.ReadRange)
-	}
-	status := resp.ServerResponse.HTTPStatusCode
-	if status != 200 {
-		return nil, fmt.Errorf("error HTTPstatus: %v", status)
+	var resp *sheets.Spreadsheet
+	if err := s.call("get spreadsheet", "", func() error {
+		r, err := s.Service.Spreadsheets.Get(s.SpreadsheetID).Ranges(s.ReadRange).IncludeGridData(includeGridData).Do()
+		if err != nil {
+			return err
+		}
+		if status := r.ServerResponse.HTTPStatusCode; status != 200 {
+			return fmt.Errorf("error HTTPstatus: %v", status)
+		}
+		resp = r
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 	return resp, nil
 }
 
-// sheetService, sheetID, sheet名, 入力データを引数に取り、SpreadSheetに記入する
-func write(srv *sheets.Service, sid, srange string, inputs [][]string) error {
-	valueRange := &sheets.ValueRange{
-		MajorDimension: "ROWS",
-		Values:         interfaceSlices(inputs),
+func (s SpreadSheet) batchUpdate(op string, rb *sheets.BatchUpdateSpreadsheetRequest) error {
+	return s.call(op, "", func() error {
+		resp, err := s.Service.Spreadsheets.BatchUpdate(s.SpreadsheetID, rb).Do()
+		if err != nil {
+			return err
+		}
+		if status := resp.ServerResponse.HTTPStatusCode; status != 200 {
+			return fmt.Errorf("HTTPstatus error. %v", status)
+		}
+		return nil
+	})
+}
+
+// 入力データをChunkRows行ずつに分けてSpreadSheetに追記する
+// 途中で失敗した場合、それより前のchunkは書き込まれたままになる
+func (s SpreadSheet) write(inputs [][]string) error {
+	if len(inputs) == 0 {
+		return nil
 	}
-	// Write spreadsheet
-	resp, err := srv.Spreadsheets.Values.Append(sid, srange, valueRange).ValueInputOption("USER_ENTERED").InsertDataOption("INSERT_ROWS").Do()
+	// appendの失敗後に書き込まれたかどうかを確かめるために、書き込む前の行数を覚えておく
+	dataRows, err := s.dataRows()
 	if err != nil {
-		return fmt.Errorf("unable to write value: %v", err)
+		return fmt.Errorf("unable to count rows: %w", err)
 	}
-	status := resp.ServerResponse.HTTPStatusCode
-	if status != 200 {
-		return fmt.Errorf("HTTPstatus error: %v", status)
+	chunks := chunkRows(inputs, s.ChunkRows)
+	start := 0
+	for _, chunk := range chunks {
+		rows := fmt.Sprintf("%d-%d/%d", start+1, start+len(chunk), len(inputs))
+		if err := s.appendChunk(chunk, rows, dataRows); err != nil {
+			return fmt.Errorf("unable to write value: %w", err)
+		}
+		start += len(chunk)
+		dataRows += len(chunk)
 	}
 	return nil
 }
 
+// values.appendは冪等ではなく、5xxや応答前に接続が切れた場合でも書き込まれていることがある
+// そのような失敗のあとは行数を読み直し、書き込まれていればリトライせずに成功とみなす
+// dataRowsはappendする前の行数
+func (s SpreadSheet) appendChunk(chunk [][]string, rows string, dataRows int) error {
+	valueRange := &sheets.ValueRange{
+		MajorDimension: "ROWS",
+		Values:         interfaceSlices(chunk),
+	}
+	return s.callWith("append", rows, isRetryableAppend, func() error {
+		resp, err := s.Service.Spreadsheets.Values.Append(s.SpreadsheetID, s.ReadRange, valueRange).ValueInputOption("USER_ENTERED").InsertDataOption("INSERT_ROWS").Do()
+		if err == nil {
+			if status := resp.ServerResponse.HTTPStatusCode; status != 200 {
+				return fmt.Errorf("HTTPstatus error: %v", status)
+			}
+			return nil
+		}
+		if !isAmbiguous(err) {
+			return err
+		}
+		n, rerr := s.dataRows()
+		if rerr != nil {
+			// 書き込まれたかわからないのでリトライしない
+			return fmt.Errorf("failed to count rows after append error %v: %v", err, rerr)
+		}
+		switch n {
+		case dataRows + len(chunk):
+			log.Printf("append rows %s returned error but rows were written: %v", rows, err)
+			return nil
+		case dataRows:
+			return err // 書き込まれていないのでリトライしてよい
+		}
+		return fmt.Errorf("rows changed from %d to %d by failed append, not retry: %v", dataRows, n, err)
+	})
+}
+
+// 値の入っている行数を返す。appendはこの次の行から書き込む
+// タブ全体を読むと大きなタブでは書き込みのたびに重くなるので、A列だけ読んで数える
+// (このpackageで書き込む行はA列に必ず値が入っている)
+func (s SpreadSheet) dataRows() (int, error) {
+	n := 0
+	if err := s.call("count rows", "", func() error {
+		r, err := s.Service.Spreadsheets.Values.Get(s.SpreadsheetID, s.ReadRange+"!A:A").Do()
+		if err != nil {
+			return err
+		}
+		if status := r.ServerResponse.HTTPStatusCode; status != 200 {
+			return fmt.Errorf("error HTTPstatus: %v", status)
+		}
+		n = len(r.Values)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 // interfaceSlices convert two-dimensional string slice to two-dimensional interface slice
 func interfaceSlices(sss [][]string) [][]interface{} {
 	iss := make([][]interface{}, len(sss))
@@ -0,0 +1,391 @@
+// Package sheettest provides a fake Google Sheets API server for tests.
+package sheettest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// 実際のSheets APIのうち、sheet packageが使う以下だけを実装する
+// - spreadsheets.values.get, append, clear
+// - spreadsheets.get (gridProperties)
+// - spreadsheets.batchUpdate (addSheet, deleteDimension)
+// ref. https://developers.google.com/sheets/api/reference/rest
+
+// 新しいタブの行数、列数。Google Spreadsheetで作ったタブと同じ
+const (
+	defaultRowCount    = 1000
+	defaultColumnCount = 26
+)
+
+// Server is fake Google Sheets API server.
+type Server struct {
+	server *httptest.Server
+
+	mu            sync.Mutex
+	spreadsheets  map[string][]*tab
+	nextSheetID   int64
+	failures      []int // 先頭から順にこのHTTP statusでリクエストを失敗させる
+	writeFailures []int // 先頭から順にPOSTのリクエストを処理せずにこのHTTP statusで失敗させる
+	failuresAfter []int // 先頭から順にPOSTのリクエストを処理した後にこのHTTP statusを返す
+	requests      int
+}
+
+type tab struct {
+	sheetID     int64
+	title       string
+	rowCount    int64
+	columnCount int64
+	values      [][]string
+}
+
+// NewServer starts fake server. 使い終わったらCloseする
+func NewServer() *Server {
+	s := &Server{spreadsheets: make(map[string][]*tab)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// URL returns endpoint of the server for sheet.WithEndpoint.
+func (s *Server) URL() string {
+	return s.server.URL + "/"
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// AddSheet adds a tab with rowCount rows to the spreadsheet. spreadsheetがなければ作る
+func (s *Server) AddSheet(spreadsheetID, title string, rowCount int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addTab(spreadsheetID, title, rowCount)
+}
+
+// Values returns values of the tab.
+func (s *Server) Values(spreadsheetID, title string) [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t := s.findTab(spreadsheetID, title); t != nil {
+		return t.values
+	}
+	return nil
+}
+
+// RowCount returns the number of rows of the tab including empty rows.
+func (s *Server) RowCount(spreadsheetID, title string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t := s.findTab(spreadsheetID, title); t != nil {
+		return t.rowCount
+	}
+	return 0
+}
+
+// FailNext makes following requests fail with the HTTP status codes in order.
+func (s *Server) FailNext(codes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, codes...)
+}
+
+// FailNextWrite makes following POST requests fail with the HTTP status codes in order without applying them.
+// 読み込みのリクエストは失敗させない
+func (s *Server) FailNextWrite(codes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writeFailures = append(s.writeFailures, codes...)
+}
+
+// FailNextAfterWrite makes following POST requests return the HTTP status codes in order after they are applied.
+// 書き込みは成功したのに応答が5xxになった場合を再現する
+func (s *Server) FailNextAfterWrite(codes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failuresAfter = append(s.failuresAfter, codes...)
+}
+
+// Requests returns the number of requests the server received.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) addTab(spreadsheetID, title string, rowCount int64) *tab {
+	s.nextSheetID++
+	t := &tab{sheetID: s.nextSheetID, title: title, rowCount: rowCount, columnCount: defaultColumnCount}
+	s.spreadsheets[spreadsheetID] = append(s.spreadsheets[spreadsheetID], t)
+	return t
+}
+
+func (s *Server) findTab(spreadsheetID, title string) *tab {
+	for _, t := range s.spreadsheets[spreadsheetID] {
+		if t.title == title {
+			return t
+		}
+	}
+	return nil
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if len(s.failures) > 0 {
+		code := s.failures[0]
+		s.failures = s.failures[1:]
+		writeError(w, code, "injected failure")
+		return
+	}
+	if len(s.writeFailures) > 0 && r.Method == http.MethodPost {
+		code := s.writeFailures[0]
+		s.writeFailures = s.writeFailures[1:]
+		writeError(w, code, "injected failure")
+		return
+	}
+	if len(s.failuresAfter) > 0 && r.Method == http.MethodPost {
+		code := s.failuresAfter[0]
+		s.failuresAfter = s.failuresAfter[1:]
+		s.route(httptest.NewRecorder(), r)
+		writeError(w, code, "injected failure after write")
+		return
+	}
+	s.route(w, r)
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+	// pathは v4/spreadsheets/{spreadsheetId}... の形
+	path := strings.TrimPrefix(r.URL.Path, "/v4/spreadsheets/")
+	if path == r.URL.Path {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown path: %s", r.URL.Path))
+		return
+	}
+	if i := strings.Index(path, "/values/"); i >= 0 {
+		s.handleValues(w, r, path[:i], path[i+len("/values/"):])
+		return
+	}
+	if strings.HasSuffix(path, ":batchUpdate") && r.Method == http.MethodPost {
+		s.handleBatchUpdate(w, r, strings.TrimSuffix(path, ":batchUpdate"))
+		return
+	}
+	if r.Method == http.MethodGet {
+		s.handleGet(w, r, path)
+		return
+	}
+	writeError(w, http.StatusNotFound, fmt.Sprintf("unknown path: %s", r.URL.Path))
+}
+
+func (s *Server) handleValues(w http.ResponseWriter, r *http.Request, spreadsheetID, rng string) {
+	method := ""
+	if i := strings.LastIndex(rng, ":"); i >= 0 && r.Method == http.MethodPost {
+		rng, method = rng[:i], rng[i+1:]
+	}
+	// "tab!A:A"のようなrangeはその列だけを読み、それ以外の"tab!A1:B2"のようなrangeはタブ全体として扱う
+	ss := strings.SplitN(rng, "!", 2)
+	title := ss[0]
+	t := s.findTab(spreadsheetID, title)
+	if t == nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Unable to parse range: %s", rng))
+		return
+	}
+	column := -1
+	if len(ss) == 2 {
+		column = singleColumn(ss[1])
+	}
+
+	switch {
+	case r.Method == http.MethodGet && method == "":
+		writeJSON(w, map[string]interface{}{"range": title, "majorDimension": "ROWS", "values": getValues(t.values, column)})
+	case method == "append":
+
+		var body struct {
+			Values [][]interface{} `json:"values"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %v", err))
+			return
+		}
+		for _, row := range body.Values {
+			var ss []string
+			for _, v := range row {
+				ss = append(ss, fmt.Sprint(v))
+			}
+			t.values = append(t.values, ss)
+		}
+		// INSERT_ROWSでは書き込んだ行数だけタブの行が増える
+		if r.URL.Query().Get("insertDataOption") == "INSERT_ROWS" {
+			t.rowCount += int64(len(body.Values))
+		}
+		if n := int64(len(t.values)); n > t.rowCount {
+			t.rowCount = n
+		}
+		writeJSON(w, map[string]interface{}{"spreadsheetId": spreadsheetID, "tableRange": title})
+	case method == "clear":
+		// clearしても値が消えるだけで行は残る
+		t.values = nil
+		writeJSON(w, map[string]interface{}{"spreadsheetId": spreadsheetID, "clearedRange": title})
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unsupported values method: %s %s", r.Method, method))
+	}
+}
+
+// "A:A"のような1列だけのrangeならその列の番号(Aが0)、そうでなければ-1を返す
+func singleColumn(rng string) int {
+	cols := strings.SplitN(rng, ":", 2)
+	if len(cols) != 2 || cols[0] != cols[1] || len(cols[0]) != 1 || cols[0][0] < 'A' || cols[0][0] > 'Z' {
+		return -1
+	}
+	return int(cols[0][0] - 'A')
+}
+
+// columnが0以上ならその列だけを返す。実際のAPIと同じく末尾の空の行は返さない
+func getValues(rows [][]string, column int) [][]interface{} {
+	values := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		if column >= 0 {
+			if column >= len(row) || row[column] == "" {
+				values = append(values, []interface{}{})
+				continue
+			}
+			row = row[column : column+1]
+		}
+		vs := make([]interface{}, len(row))
+		for j, v := range row {
+			vs[j] = v
+		}
+		values = append(values, vs)
+	}
+	for len(values) > 0 && len(values[len(values)-1]) == 0 {
+		values = values[:len(values)-1]
+	}
+	return values
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, spreadsheetID string) {
+	tabs, ok := s.spreadsheets[spreadsheetID]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Requested entity was not found: %s", spreadsheetID))
+		return
+	}
+	// rangesを指定した場合はそのタブだけ返す
+	ranges := make(map[string]bool)
+	for _, rng := range r.URL.Query()["ranges"] {
+		ranges[strings.SplitN(rng, "!", 2)[0]] = true
+	}
+	var sheets []interface{}
+	for i, t := range tabs {
+		if len(ranges) > 0 && !ranges[t.title] {
+			continue
+		}
+		sheets = append(sheets, map[string]interface{}{
+			"properties": map[string]interface{}{
+				"sheetId":   t.sheetID,
+				"title":     t.title,
+				"index":     i,
+				"sheetType": "GRID",
+				"gridProperties": map[string]interface{}{
+					"rowCount":    t.rowCount,
+					"columnCount": t.columnCount,
+				},
+			},
+		})
+	}
+	writeJSON(w, map[string]interface{}{"spreadsheetId": spreadsheetID, "sheets": sheets})
+}
+
+type batchUpdateRequest struct {
+	Requests []struct {
+		AddSheet *struct {
+			Properties struct {
+				Title string `json:"title"`
+			} `json:"properties"`
+		} `json:"addSheet"`
+		DeleteDimension *struct {
+			Range struct {
+				SheetID    int64  `json:"sheetId"`
+				Dimension  string `json:"dimension"`
+				StartIndex int64  `json:"startIndex"`
+				EndIndex   int64  `json:"endIndex"`
+			} `json:"range"`
+		} `json:"deleteDimension"`
+	} `json:"requests"`
+}
+
+func (s *Server) handleBatchUpdate(w http.ResponseWriter, r *http.Request, spreadsheetID string) {
+	if _, ok := s.spreadsheets[spreadsheetID]; !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Requested entity was not found: %s", spreadsheetID))
+		return
+	}
+	var body batchUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %v", err))
+		return
+	}
+
+	// 実際のAPIと同じく、1つでも失敗したら何も変更しない
+	var ops []func()
+	for i, req := range body.Requests {
+		switch {
+		case req.AddSheet != nil:
+			title := req.AddSheet.Properties.Title
+			if s.findTab(spreadsheetID, title) != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid requests[%d].addSheet: A sheet with the name \"%s\" already exists.", i, title))
+				return
+			}
+			ops = append(ops, func() { s.addTab(spreadsheetID, title, defaultRowCount) })
+		case req.DeleteDimension != nil:
+			rng := req.DeleteDimension.Range
+			var t *tab
+			for _, tb := range s.spreadsheets[spreadsheetID] {
+				if tb.sheetID == rng.SheetID {
+					t = tb
+				}
+			}
+			if t == nil || rng.Dimension != "ROWS" || rng.StartIndex < 0 || rng.StartIndex >= rng.EndIndex || rng.EndIndex > t.rowCount {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid requests[%d].deleteDimension: %+v", i, rng))
+				return
+			}
+			ops = append(ops, func() { deleteRows(t, rng.StartIndex, rng.EndIndex) })
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported requests[%d]", i))
+			return
+		}
+	}
+	for _, op := range ops {
+		op()
+	}
+	writeJSON(w, map[string]interface{}{"spreadsheetId": spreadsheetID})
+}
+
+// [start, end)の行を削除して後ろの行を詰める
+func deleteRows(t *tab, start, end int64) {
+	if start < int64(len(t.values)) {
+		rest := [][]string{}
+		if end < int64(len(t.values)) {
+			rest = t.values[end:]
+		}
+		t.values = append(t.values[:start:start], rest...)
+	}
+	t.rowCount -= end - start
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// googleapi.Errorとして読めるエラーを返す
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": message},
+	})
+}
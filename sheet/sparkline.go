@@ -0,0 +1,23 @@
+package sheet
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Sparkline returns SPARKLINE formula which draws a line chart of values in a cell.
+// colorが空の場合はSpreadsheetのデフォルトの色になる
+// 例: =SPARKLINE({100,101.5,99},{"charttype","line";"color","red"})
+// ref. https://support.google.com/docs/answer/3093289
+func Sparkline(values []float64, color string) string {
+	vs := make([]string, len(values))
+	for i, v := range values {
+		vs[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	options := `{"charttype","line"`
+	if color != "" {
+		options += `;"color","` + strings.Replace(color, `"`, "", -1) + `"`
+	}
+	options += "}"
+	return "=SPARKLINE({" + strings.Join(vs, ",") + "}," + options + ")"
+}
@@ -0,0 +1,32 @@
+package sheet
+
+import "testing"
+
+func TestSparkline(t *testing.T) {
+	cases := map[string]struct {
+		values []float64
+		color  string
+		want   string
+	}{
+		"with_color": {
+			values: []float64{100, 101.5, 99},
+			color:  "red",
+			want:   `=SPARKLINE({100,101.5,99},{"charttype","line";"color","red"})`,
+		},
+		"without_color": {
+			values: []float64{1, 2},
+			want:   `=SPARKLINE({1,2},{"charttype","line"})`,
+		},
+		"empty": {
+			values: nil,
+			want:   `=SPARKLINE({},{"charttype","line"})`,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := Sparkline(tc.values, tc.color); got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
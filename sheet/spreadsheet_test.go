@@ -0,0 +1,284 @@
+package sheet
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ludwig125/gke-stockprice/sheet/sheettest"
+)
+
+// fakeのSheets API serverにつないだSpreadSheetを返す
+func newFakeSpreadSheet(t *testing.T, title string, rowCount int64) (*sheettest.Server, SpreadSheet) {
+	t.Helper()
+
+	// リトライで待たないようにする
+	initial, max := initialBackoff, maxBackoff
+	initialBackoff, maxBackoff = time.Microsecond, time.Microsecond
+	t.Cleanup(func() { initialBackoff, maxBackoff = initial, max })
+
+	fake := sheettest.NewServer()
+	t.Cleanup(fake.Close)
+	if rowCount > 0 {
+		fake.AddSheet("sheetid", title, rowCount)
+	}
+	srv, err := GetSheetClient(context.Background(), "", WithEndpoint(fake.URL()))
+	if err != nil {
+		t.Fatalf("failed to GetSheetClient: %v", err)
+	}
+	return fake, SpreadSheet{Service: srv, SpreadsheetID: "sheetid", ReadRange: title}
+}
+
+func TestSpreadSheetWithFake(t *testing.T) {
+	fake, s := newFakeSpreadSheet(t, "unittest", 0)
+	fake.AddSheet("sheetid", "other", 10)
+
+	testdata := [][]string{
+		{"a", "b", "c"},
+		{"d", "e", "f"},
+	}
+	// タブがなければUpdateで作られる
+	if err := s.Update(testdata); err != nil {
+		t.Fatalf("failed to Update: %v", err)
+	}
+	if err := s.Insert(append(testdata, testdata...)); err != nil {
+		t.Fatalf("failed to Insert: %v", err)
+	}
+	want := append(testdata, append(testdata, testdata...)...)
+	got, err := s.Read()
+	if err != nil {
+		t.Fatalf("failed to Read: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Updateは前の内容を消してから書き込む
+	if err := s.Update(testdata); err != nil {
+		t.Fatalf("failed to Update: %v", err)
+	}
+	if got := fake.Values("sheetid", "unittest"); !reflect.DeepEqual(got, testdata) {
+		t.Errorf("got %v, want %v", got, testdata)
+	}
+
+	if err := s.Clear(); err != nil {
+		t.Fatalf("failed to Clear: %v", err)
+	}
+	if got, err := s.Read(); err != nil || len(got) != 0 {
+		t.Errorf("got %v, %v, want empty", got, err)
+	}
+}
+
+func TestDeleteRowMoreThan(t *testing.T) {
+	cases := map[string]struct {
+		rowCount  int64
+		threshold int64
+		want      int64
+	}{
+		"less_than_threshold": {
+			rowCount:  5,
+			threshold: 10,
+			want:      5,
+		},
+		"equal_to_threshold": {
+			rowCount:  10,
+			threshold: 10,
+			want:      10,
+		},
+		"more_than_threshold": {
+			rowCount:  15,
+			threshold: 10,
+			want:      10,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			fake, s := newFakeSpreadSheet(t, "unittest", tc.rowCount)
+			if err := s.deleteRowMoreThan(tc.threshold); err != nil {
+				t.Fatalf("failed to deleteRowMoreThan: %v", err)
+			}
+			if got := fake.RowCount("sheetid", "unittest"); got != tc.want {
+				t.Errorf("got rowCount: %d, want: %d", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("missing_sheet", func(t *testing.T) {
+		fake, s := newFakeSpreadSheet(t, "unittest", 10)
+		fake.AddSheet("sheetid", "other", 10)
+		s.ReadRange = "missing"
+		if err := s.deleteRowMoreThan(5); err == nil {
+			t.Error("want error for missing sheet")
+		}
+	})
+}
+
+// Appendを繰り返すとINSERT_ROWSで行が増えるが、Clearで10000行までに減る
+func TestClearDeletesRows(t *testing.T) {
+	fake, s := newFakeSpreadSheet(t, "unittest", 9990)
+	if err := s.Insert([][]string{{"a"}, {"b"}, {"c"}, {"d"}, {"e"}, {"f"}, {"g"}, {"h"}, {"i"}, {"j"}, {"k"}, {"l"}}); err != nil {
+		t.Fatalf("failed to Insert: %v", err)
+	}
+	if got := fake.RowCount("sheetid", "unittest"); got != 10002 {
+		t.Fatalf("got rowCount: %d, want: 10002", got)
+	}
+	if err := s.Clear(); err != nil {
+		t.Fatalf("failed to Clear: %v", err)
+	}
+	if got := fake.RowCount("sheetid", "unittest"); got != 10000 {
+		t.Errorf("got rowCount: %d, want: 10000", got)
+	}
+}
+
+func TestSpreadSheetRetry(t *testing.T) {
+	cases := map[string]struct {
+		failures     []int
+		wantErr      bool
+		wantRequests int
+	}{
+		"success_after_429_and_503": {
+			failures:     []int{429, 503},
+			wantErr:      false,
+			wantRequests: 3,
+		},
+		"fail_reach_attempt_limit": {
+			failures:     []int{500, 500, 500, 500, 500},
+			wantErr:      true,
+			wantRequests: maxAttempts,
+		},
+		"fail_not_retryable": {
+			failures:     []int{400},
+			wantErr:      true,
+			wantRequests: 1,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			fake, s := newFakeSpreadSheet(t, "unittest", 10)
+			fake.FailNext(tc.failures...)
+			_, err := s.Read()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error: %v, want error: %v", err, tc.wantErr)
+			}
+			var rerr *RequestError
+			if tc.wantErr && !errors.As(err, &rerr) {
+				t.Errorf("got error: %v, want RequestError", err)
+			}
+			if got := fake.Requests(); got != tc.wantRequests {
+				t.Errorf("got requests: %d, want: %d", got, tc.wantRequests)
+			}
+		})
+	}
+}
+
+func TestSpreadSheetAppendRetry(t *testing.T) {
+	inputs := [][]string{{"1"}, {"2"}}
+	cases := map[string]struct {
+		writeFailures []int // appendを処理せずに失敗させる
+		failuresAfter []int // appendを処理した後に失敗を返す
+		wantValues    [][]string
+		wantErr       bool
+		wantRequests  int
+	}{
+		"retry_429": {
+			writeFailures: []int{429},
+			wantValues:    inputs,
+			wantRequests:  3, // 行数の取得、429、append
+		},
+		"retry_5xx_not_written": {
+			writeFailures: []int{503},
+			wantValues:    inputs,
+			wantRequests:  4, // 行数の取得、503、行数の読み直し、append
+		},
+		"no_retry_5xx_written": {
+			failuresAfter: []int{503},
+			wantValues:    inputs, // 重複して書き込まない
+			wantRequests:  3,      // 行数の取得、503、行数の読み直し
+		},
+		"fail_not_retryable": {
+			writeFailures: []int{400},
+			wantErr:       true,
+			wantRequests:  2,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			fake, s := newFakeSpreadSheet(t, "unittest", 10)
+			fake.FailNextWrite(tc.writeFailures...)
+			fake.FailNextAfterWrite(tc.failuresAfter...)
+			err := s.Insert(inputs)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error: %v, want error: %v", err, tc.wantErr)
+			}
+			if got := fake.Values("sheetid", "unittest"); !reflect.DeepEqual(got, tc.wantValues) {
+				t.Errorf("got %v, want %v", got, tc.wantValues)
+			}
+			if got := fake.Requests(); got != tc.wantRequests {
+				t.Errorf("got requests: %d, want: %d", got, tc.wantRequests)
+			}
+		})
+	}
+}
+
+func TestSpreadSheetDataRows(t *testing.T) {
+	fake, s := newFakeSpreadSheet(t, "unittest", 10)
+	// 途中の行のA列が空でも、その行まで数える
+	if err := s.Insert([][]string{{"1", "a"}, {"", "b"}, {"3", "c"}}); err != nil {
+		t.Fatalf("failed to Insert: %v", err)
+	}
+	got, err := s.dataRows()
+	if err != nil {
+		t.Fatalf("failed to dataRows: %v", err)
+	}
+	if got != 3 {
+		t.Errorf("got rows: %d, want: 3", got)
+	}
+
+	// 書き込まれたのに失敗が返ってきても、A列で数えた行数から書き込まれたとわかる
+	fake.FailNextAfterWrite(503)
+	if err := s.Insert([][]string{{"4", "d"}}); err != nil {
+		t.Fatalf("failed to Insert: %v", err)
+	}
+	if got := len(fake.Values("sheetid", "unittest")); got != 4 {
+		t.Errorf("got rows: %d, want: 4", got)
+	}
+}
+
+func TestSpreadSheetChunkAndBudget(t *testing.T) {
+	inputs := [][]string{{"1"}, {"2"}, {"3"}, {"4"}, {"5"}}
+
+	t.Run("chunk", func(t *testing.T) {
+		fake, s := newFakeSpreadSheet(t, "unittest", 10)
+		s.ChunkRows = 2
+		if err := s.Insert(inputs); err != nil {
+			t.Fatalf("failed to Insert: %v", err)
+		}
+		// 書き込む前の行数の取得と3回のappend
+		if got := fake.Requests(); got != 4 {
+			t.Errorf("got requests: %d, want: 4", got)
+		}
+		if got := fake.Values("sheetid", "unittest"); !reflect.DeepEqual(got, inputs) {
+			t.Errorf("got %v, want %v", got, inputs)
+		}
+	})
+
+	t.Run("budget_exceeded", func(t *testing.T) {
+		fake, s := newFakeSpreadSheet(t, "unittest", 10)
+		s.ChunkRows = 2
+		s.Budget = NewBudget(3)
+		err := s.Insert(inputs)
+		if !errors.Is(err, ErrBudgetExceeded) {
+			t.Fatalf("got error: %v, want ErrBudgetExceeded", err)
+		}
+		// どの行の書き込みで失敗したかがわかる
+		if !strings.Contains(err.Error(), "range: unittest, rows: 5-5/5") {
+			t.Errorf("got error: %v, want failed range", err)
+		}
+		if got := fake.Values("sheetid", "unittest"); !reflect.DeepEqual(got, inputs[:4]) {
+			t.Errorf("got %v, want %v", got, inputs[:4])
+		}
+	})
+}
@@ -0,0 +1,344 @@
+package sheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// XLSXSheet is Sheet backed by a tab of a local .xlsx workbook.
+// Google Spreadsheetのタブと同じように、1つのファイルに複数のタブを持てる
+// 書き込むときはファイル全体を作り直すので、書式などExcelで付けた情報は残らない
+type XLSXSheet struct {
+	Path string
+	Name string // タブ名
+}
+
+// NewXLSXSheet returns XLSXSheet.
+func NewXLSXSheet(path, name string) Sheet {
+	return XLSXSheet{Path: path, Name: name}
+}
+
+// 同じファイルの別のタブを並行して書き込んでも壊れないようにする
+var xlsxMu sync.Mutex
+
+// Read reads all rows of the tab. ファイルやタブがなければ空として扱う
+func (x XLSXSheet) Read() ([][]string, error) {
+	xlsxMu.Lock()
+	defer xlsxMu.Unlock()
+
+	tabs, err := readXLSX(x.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to readXLSX: %v", err)
+	}
+	for _, t := range tabs {
+		if t.name == x.Name {
+			return t.rows, nil
+		}
+	}
+	return nil, nil
+}
+
+// Insert appends rows without clearing.
+func (x XLSXSheet) Insert(inputs [][]string) error {
+	return x.modify(func(rows [][]string) [][]string { return append(rows, inputs...) })
+}
+
+// Update clears the tab and writes rows.
+func (x XLSXSheet) Update(inputs [][]string) error {
+	return x.modify(func([][]string) [][]string { return inputs })
+}
+
+// Clear deletes all rows of the tab.
+func (x XLSXSheet) Clear() error {
+	return x.modify(func([][]string) [][]string { return nil })
+}
+
+// タブがなければ最後に追加する
+func (x XLSXSheet) modify(f func(rows [][]string) [][]string) error {
+	xlsxMu.Lock()
+	defer xlsxMu.Unlock()
+
+	tabs, err := readXLSX(x.Path)
+	if err != nil {
+		return fmt.Errorf("failed to readXLSX: %v", err)
+	}
+	found := false
+	for i, t := range tabs {
+		if t.name == x.Name {
+			tabs[i].rows = f(t.rows)
+			found = true
+		}
+	}
+	if !found {
+		tabs = append(tabs, xlsxTab{name: x.Name, rows: f(nil)})
+	}
+	if err := writeXLSX(x.Path, tabs); err != nil {
+		return fmt.Errorf("failed to writeXLSX: %v", err)
+	}
+	return nil
+}
+
+type xlsxTab struct {
+	name string
+	rows [][]string
+}
+
+func writeXLSX(filePath string, tabs []xlsxTab) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to MkdirAll: %v", err)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	var overrides, sheets, rels strings.Builder
+	for i, t := range tabs {
+		n := i + 1
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(t.name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+	files := []struct {
+		name string
+		body string
+	}{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			overrides.String() + `</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+	}
+	for i, t := range tabs {
+		files = append(files, struct {
+			name string
+			body string
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), worksheetXML(t.rows)})
+	}
+
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", f.name, err)
+		}
+		if _, err := io.WriteString(w, f.body); err != nil {
+			return fmt.Errorf("failed to write %s: %v", f.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to close zip: %v", err)
+	}
+
+	// 書き込み途中で壊れたファイルが残らないように一時ファイルから置き換える
+	tmp := filePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", tmp, err)
+	}
+	return os.Rename(tmp, filePath)
+}
+
+func worksheetXML(rows [][]string) string {
+	var b strings.Builder
+	b.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range rows {
+		fmt.Fprintf(&b, `<row r="%d">`, i+1)
+		for j, v := range row {
+			ref := columnName(j) + strconv.Itoa(i+1)
+			if isXLSXNumber(v) {
+				fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, v)
+				continue
+			}
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(v))
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String()
+}
+
+// 読み込んだときに同じ文字列に戻る数値だけ数値のセルにする
+// "0012"のような値は文字列のままにする
+func isXLSXNumber(v string) bool {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return false
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64) == v
+}
+
+// 0始まりの列番号をA, B, ..., Z, AA, ...に変換する
+func columnName(i int) string {
+	name := ""
+	for i >= 0 {
+		name = string(rune('A'+i%26)) + name
+		i = i/26 - 1
+	}
+	return name
+}
+
+// A1のようなセル参照から0始まりの列番号を返す
+func columnIndex(ref string) int {
+	i := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		i = i*26 + int(r-'A'+1)
+	}
+	return i - 1
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Num   int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+type xlsxSharedStrings struct {
+	Items []struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"si"`
+}
+
+// Excelで作ったファイルも読めるように、sharedStringsのセルにも対応する
+func readXLSX(filePath string) ([]xlsxTab, error) {
+	zr, err := zip.OpenReader(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", filePath, err)
+	}
+	defer zr.Close()
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	decode := func(name string, v interface{}) error {
+		f, ok := files[name]
+		if !ok {
+			return fmt.Errorf("%s not found in %s", name, filePath)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", name, err)
+		}
+		defer rc.Close()
+		if err := xml.NewDecoder(rc).Decode(v); err != nil {
+			return fmt.Errorf("failed to decode %s: %v", name, err)
+		}
+		return nil
+	}
+
+	var wb xlsxWorkbook
+	if err := decode("xl/workbook.xml", &wb); err != nil {
+		return nil, err
+	}
+	var rels xlsxRelationships
+	if err := decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string, len(rels.Relationships))
+	for _, r := range rels.Relationships {
+		targets[r.ID] = path.Join("xl", r.Target)
+		if strings.HasPrefix(r.Target, "/") {
+			targets[r.ID] = strings.TrimPrefix(r.Target, "/")
+		}
+	}
+	var shared []string
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		var ss xlsxSharedStrings
+		if err := decode("xl/sharedStrings.xml", &ss); err != nil {
+			return nil, err
+		}
+		for _, si := range ss.Items {
+			text := si.Text
+			for _, r := range si.Runs {
+				text += r.Text
+			}
+			shared = append(shared, text)
+		}
+	}
+
+	var tabs []xlsxTab
+	for _, s := range wb.Sheets {
+		var ws xlsxWorksheet
+		if err := decode(targets[s.RID], &ws); err != nil {
+			return nil, err
+		}
+		var rows [][]string
+		for _, r := range ws.Rows {
+			for r.Num > len(rows)+1 { // 空の行は省略されることがあるので行番号の位置に入れる
+				rows = append(rows, nil)
+			}
+			var row []string
+			for _, c := range r.Cells {
+				// 空のセルは省略されることがあるので列番号の位置に入れる
+				if i := columnIndex(c.Ref); i > len(row) {
+					row = append(row, make([]string, i-len(row))...)
+				}
+				v := c.Value
+				switch c.Type {
+				case "inlineStr":
+					v = c.Inline
+				case "s":
+					idx, err := strconv.Atoi(c.Value)
+					if err != nil || idx < 0 || idx >= len(shared) {
+						return nil, fmt.Errorf("invalid shared string index: %s, cell: %s", c.Value, c.Ref)
+					}
+					v = shared[idx]
+				}
+				row = append(row, v)
+			}
+			rows = append(rows, row)
+		}
+		tabs = append(tabs, xlsxTab{name: s.Name, rows: rows})
+	}
+	return tabs, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	sheets "google.golang.org/api/sheets/v4"
+
+	"github.com/ludwig125/gke-stockprice/sheet"
+)
+
+// Sheetの種類ごとに、Google Spreadsheet(spreadsheet)、ローカルのCSV(csv)、xlsx(xlsx)のどれを使うかを
+// 環境変数<種類>_SHEET_BACKENDで指定する。指定がなければspreadsheet
+// ローカルのファイルはLOCAL_SHEET_DIRの下に、csvは<種類>/<タブ名>.csv、xlsxは<種類>.xlsxとして置く
+// spreadsheetへのリクエスト数はSHEET_REQUEST_BUDGETで1回の実行あたりの上限を決められる。0なら無制限
+var sheetKinds = []string{"COMPANYCODE", "TREND", "STATUS", "HOLIDAY"}
+
+const (
+	spreadsheetBackend = "spreadsheet"
+	csvBackend         = "csv"
+	xlsxBackend        = "xlsx"
+)
+
+type sheetFactory struct {
+	srv      *sheets.Service // spreadsheetを使わない場合はnil
+	budget   *sheet.Budget   // 全てのspreadsheetで共有する
+	backends map[string]string
+	dir      string
+	chunk    int // 1回のAppendで書き込む行数
+}
+
+// spreadsheetを使う種類がなければCREDENTIAL_FILEPATHは不要
+func newSheetFactory(ctx context.Context) (sheetFactory, error) {
+	f := sheetFactory{
+		backends: make(map[string]string, len(sheetKinds)),
+		dir:      useEnvOrDefault("LOCAL_SHEET_DIR", "sheets"),
+		budget:   sheet.NewBudget(strToInt(useEnvOrDefault("SHEET_REQUEST_BUDGET", "0"))),
+		chunk:    strToInt(useEnvOrDefault("SHEET_CHUNK_ROWS", "0")), // 0ならsheet packageのデフォルト
+	}
+	useSpreadsheet := false
+	for _, kind := range sheetKinds {
+		b := useEnvOrDefault(kind+"_SHEET_BACKEND", spreadsheetBackend)
+		switch b {
+		case spreadsheetBackend:
+			useSpreadsheet = true
+		case csvBackend, xlsxBackend:
+		default:
+			return sheetFactory{}, fmt.Errorf("unknown sheet backend: '%s' for %s. Please set one of %s, %s, %s", b, kind, spreadsheetBackend, csvBackend, xlsxBackend)
+		}
+		f.backends[kind] = b
+	}
+	if !useSpreadsheet {
+		return f, nil
+	}
+	srv, err := getSheetService(ctx, mustGetenv("CREDENTIAL_FILEPATH"))
+	if err != nil {
+		return sheetFactory{}, fmt.Errorf("failed to getSheetService: %v", err)
+	}
+	f.srv = srv
+	return f, nil
+}
+
+// kindはsheetKindsのいずれか、nameはタブ名
+func (f sheetFactory) sheet(kind, name string) sheet.Sheet {
+	switch f.backends[kind] {
+	case csvBackend:
+		return sheet.NewCSVSheet(filepath.Join(f.dir, strings.ToLower(kind)), name)
+	case xlsxBackend:
+		return sheet.NewXLSXSheet(filepath.Join(f.dir, strings.ToLower(kind)+".xlsx"), name)
+	}
+	return sheet.SpreadSheet{
+		Service:       f.srv,
+		SpreadsheetID: mustGetenv(kind + "_SHEETID"),
+		ReadRange:     name,
+		ChunkRows:     f.chunk,
+		Budget:        f.budget,
+	}
+}
+
+// 実行の最後にspreadsheetへのリクエスト数をログに出す
+func (f sheetFactory) logUsage() {
+	if f.srv == nil {
+		return
+	}
+	log.Printf("sheet requests used: %d", f.budget.Used())
+}
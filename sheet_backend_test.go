@@ -0,0 +1,69 @@
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ludwig125/gke-stockprice/sheet"
+)
+
+func setenvForTest(t *testing.T, kvs map[string]string) {
+	for k, v := range kvs {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		k := k
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(k, old)
+				return
+			}
+			os.Unsetenv(k)
+		})
+	}
+}
+
+func TestNewSheetFactory(t *testing.T) {
+	setenvForTest(t, map[string]string{
+		"COMPANYCODE_SHEET_BACKEND": "csv",
+		"TREND_SHEET_BACKEND":       "xlsx",
+		"STATUS_SHEET_BACKEND":      "csv",
+		"HOLIDAY_SHEET_BACKEND":     "csv",
+		"LOCAL_SHEET_DIR":           "localdir",
+	})
+	// spreadsheetを使わないのでCREDENTIAL_FILEPATHがなくてもよい
+	f, err := newSheetFactory(context.Background())
+	if err != nil {
+		t.Fatalf("failed to newSheetFactory: %v", err)
+	}
+	if f.srv != nil {
+		t.Error("sheet service should not be created")
+	}
+
+	tests := map[string]struct {
+		kind string
+		name string
+		want sheet.Sheet
+	}{
+		"csv":  {kind: "COMPANYCODE", name: "tse-first", want: sheet.CSVSheet{Path: filepath.Join("localdir", "companycode", "tse-first.csv")}},
+		"xlsx": {kind: "TREND", name: "crossover", want: sheet.XLSXSheet{Path: filepath.Join("localdir", "trend.xlsx"), Name: "crossover"}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := f.sheet(tc.kind, tc.name); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %#v, want: %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewSheetFactoryUnknownBackend(t *testing.T) {
+	setenvForTest(t, map[string]string{"TREND_SHEET_BACKEND": "unknown"})
+	if _, err := newSheetFactory(context.Background()); err == nil {
+		t.Error("want error for unknown backend")
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/nlopes/slack"
@@ -57,3 +59,28 @@ func createSlackMsg(service string, start, finish time.Time, msgContents string)
 	msg += fmt.Sprintf("%s\n", msgContents)
 	return msg
 }
+
+// SlackSummary collects lines to append to the slack message at the end of the process.
+type SlackSummary struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+// Add appends a line to SlackSummary. It does nothing if SlackSummary is nil.
+func (s *SlackSummary) Add(line string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, line)
+}
+
+func (s *SlackSummary) String() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Join(s.lines, "\n")
+}
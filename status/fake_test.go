@@ -0,0 +1,131 @@
+package status
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ludwig125/gke-stockprice/sheet"
+	"github.com/ludwig125/gke-stockprice/sheet/sheettest"
+)
+
+// fakeのSheets API serverを使って、本物のspreadsheetなしでStatusの機能全体を確認する
+func TestStatusWithFakeSheet(t *testing.T) {
+	fake := sheettest.NewServer()
+	defer fake.Close()
+	fake.AddSheet("status_sheet", "status", 1000)
+
+	srv, err := sheet.GetSheetClient(context.Background(), "", sheet.WithEndpoint(fake.URL()))
+	if err != nil {
+		t.Fatalf("failed to GetSheetClient: %v", err)
+	}
+	store := SheetStore{Sheet: sheet.NewSpreadSheet(srv, "status_sheet", "status")}
+	s := Status{Store: store, RunID: "run1"}
+
+	jst, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("failed to LoadLocation: %v", err)
+	}
+	if err := s.InsertStatus("task0", time.Date(2020, 1, 4, 1, 0, 0, 0, jst), time.Second); err != nil {
+		t.Fatalf("failed to InsertStatus: %v", err)
+	}
+	// Clearの前の状態は残らない
+	if err := store.Clear(); err != nil {
+		t.Fatalf("failed to Clear: %v", err)
+	}
+	for _, task := range []struct {
+		name string
+		t    time.Time
+	}{
+		{"task1", time.Date(2020, 1, 3, 23, 59, 59, 0, jst)},
+		{"task2", time.Date(2020, 1, 4, 0, 0, 0, 0, jst)},
+		{"task3", time.Date(2020, 1, 4, 0, 0, 1, 0, jst)},
+	} {
+		if err := s.InsertStatus(task.name, task.t, 100*time.Nanosecond); err != nil {
+			t.Fatalf("failed to InsertStatus: %v", err)
+		}
+	}
+	wantRows := [][]string{
+		{"task1", "1578063599", "2020-01-03 23:59:59", "100ns", "run1", "success", ""},
+		{"task2", "1578063600", "2020-01-04 00:00:00", "100ns", "run1", "success", ""},
+		{"task3", "1578063601", "2020-01-04 00:00:01", "100ns", "run1", "success", ""},
+	}
+	rows, err := store.Sheet.Read()
+	if err != nil {
+		t.Fatalf("failed to Read: %v", err)
+	}
+	if len(rows) != len(wantRows) {
+		t.Fatalf("got rows: %v, want rows: %v", rows, wantRows)
+	}
+	for i := range rows {
+		for j := range rows[i] {
+			if rows[i][j] != wantRows[i][j] {
+				t.Errorf("got rows: %v, want rows: %v", rows, wantRows)
+			}
+		}
+	}
+
+	// 2020-01-04の午前0時0分0秒
+	midnight, err := getLocalMidnightUnixTime(time.Date(2020, 1, 4, 23, 59, 59, 0, jst))
+	if err != nil {
+		t.Fatalf("failed to getLocalMidnightUnixTime: %v", err)
+	}
+	tests := map[string]struct {
+		task     string
+		wantDone bool   // 実行前にmidnight以降に終わっているか
+		wantExec string // ExecIfIncompleteThisDayで実行されたtask
+	}{
+		"task0_is_cleared": {
+			task:     "task0",
+			wantDone: false,
+			wantExec: "task0",
+		},
+		"task1_is_done_yesterday": {
+			task:     "task1",
+			wantDone: false,
+			wantExec: "task1",
+		},
+		"task2_is_done_today": {
+			task:     "task2",
+			wantDone: true,
+			wantExec: "",
+		},
+		"task3_is_done_today": {
+			task:     "task3",
+			wantDone: true,
+			wantExec: "",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			done, err := s.IsTaskDoneAfter(tc.task, midnight)
+			if err != nil {
+				t.Fatalf("failed to IsTaskDoneAfter: %v", err)
+			}
+			if done != tc.wantDone {
+				t.Errorf("got done: %v, want done: %v", done, tc.wantDone)
+			}
+
+			got := ""
+			thisTime := time.Date(2020, 1, 4, 5, 0, 0, 0, jst)
+			if err := s.ExecIfIncompleteThisDay(tc.task, thisTime, func() error {
+				got = tc.task
+				return nil
+			}); err != nil {
+				t.Fatalf("failed to ExecIfIncompleteThisDay: %v", err)
+			}
+			if got != tc.wantExec {
+				t.Errorf("got exec: %s, want exec: %s", got, tc.wantExec)
+			}
+
+			// 実行後は終わっているはず
+			done, err = s.IsTaskDoneAfter(tc.task, midnight)
+			if err != nil {
+				t.Fatalf("failed to IsTaskDoneAfter: %v", err)
+			}
+			if !done {
+				t.Errorf("%s is not done after ExecIfIncompleteThisDay", tc.task)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package status
+
+import "log"
+
+// MirrorStore saves records to Primary and Mirror, and reads from Primary.
+// MySQLの内容をspreadsheetでも見られるようにするために使う
+type MirrorStore struct {
+	Primary Store
+	Mirror  Store
+}
+
+// Save saves the record. Mirrorへの書き込みに失敗してもエラーにしない
+func (m MirrorStore) Save(r Record) error {
+	if err := m.Primary.Save(r); err != nil {
+		return err
+	}
+	if err := m.Mirror.Save(r); err != nil {
+		log.Printf("failed to save %s to mirror: %v", r.Task, err)
+	}
+	return nil
+}
+
+// LastSuccess returns the last successful record of the task in Primary.
+func (m MirrorStore) LastSuccess(task string) (Record, bool, error) {
+	return m.Primary.LastSuccess(task)
+}
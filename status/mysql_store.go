@@ -0,0 +1,79 @@
+package status
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ludwig125/gke-stockprice/database"
+)
+
+// MySQLStore is Store backed by MySQL table.
+// tableのカラムはtask, run_id, started_at, finished_at, duration(秒), result, error
+type MySQLStore struct {
+	DB    database.DB
+	Table string
+}
+
+const mysqlTimeLayout = "2006-01-02 15:04:05"
+
+// Save inserts the record to the table.
+func (m MySQLStore) Save(r Record) error {
+	row := [][]string{{
+		r.Task,
+		r.RunID,
+		r.StartedAt.In(jst).Format(mysqlTimeLayout),
+		r.FinishedAt.In(jst).Format(mysqlTimeLayout),
+		fmt.Sprintf("%.3f", r.Duration.Seconds()),
+		r.Result.String(),
+		r.Error,
+	}}
+	if err := m.DB.InsertDB(m.Table, row); err != nil {
+		return fmt.Errorf("failed to InsertDB: %w", err)
+	}
+	return nil
+}
+
+// LastSuccess returns the last successful record of the task.
+func (m MySQLStore) LastSuccess(task string) (Record, bool, error) {
+	q := fmt.Sprintf("SELECT task, run_id, started_at, finished_at, duration, result, error FROM %s WHERE task = '%s' AND result = '%s' ORDER BY finished_at DESC LIMIT 1;", m.Table, task, Success)
+	res, err := m.DB.SelectDB(q)
+	if err != nil {
+		return Record{}, false, fmt.Errorf("failed to SelectDB: %v", err)
+	}
+	if len(res) == 0 {
+		return Record{}, false, nil
+	}
+	r, err := recordFromRow(res[0])
+	if err != nil {
+		return Record{}, false, fmt.Errorf("failed to recordFromRow: %v", err)
+	}
+	return r, true, nil
+}
+
+func recordFromRow(row []string) (Record, error) {
+	if len(row) != 7 {
+		return Record{}, fmt.Errorf("unexpected columns: %v", row)
+	}
+	started, err := time.ParseInLocation(mysqlTimeLayout, row[2], jst)
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to parse started_at: %v", err)
+	}
+	finished, err := time.ParseInLocation(mysqlTimeLayout, row[3], jst)
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to parse finished_at: %v", err)
+	}
+	sec, err := strconv.ParseFloat(row[4], 64)
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to parse duration: %v", err)
+	}
+	return Record{
+		Task:       row[0],
+		RunID:      row[1],
+		StartedAt:  started,
+		FinishedAt: finished,
+		Duration:   time.Duration(sec * float64(time.Second)),
+		Result:     parseResult(row[5]),
+		Error:      row[6],
+	}, nil
+}
@@ -0,0 +1,89 @@
+package status
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/ludwig125/gke-stockprice/sheet"
+)
+
+// SheetStore is Store backed by spreadsheet.
+// 1行にtask, unixtime, 時刻, 所要時間, run_id, result, errorの順に書く
+// 以前の4列だけの行は成功として扱う
+type SheetStore struct {
+	Sheet sheet.Sheet
+}
+
+// Save appends the record to the sheet.
+func (s SheetStore) Save(r Record) error {
+	row := [][]string{{
+		r.Task,
+		fmt.Sprintf("%d", r.FinishedAt.Unix()),
+		r.FinishedAt.Format("2006-01-02 15:04:05"),
+		fmt.Sprintf("%v", r.Duration),
+		r.RunID,
+		r.Result.String(),
+		r.Error,
+	}}
+	if err := s.Sheet.Insert(row); err != nil {
+		return fmt.Errorf("failed to sheet Insert: %w", err)
+	}
+	return nil
+}
+
+// LastSuccess returns the last successful record of the task.
+func (s SheetStore) LastSuccess(task string) (Record, bool, error) {
+	rows, err := s.Sheet.Read()
+	if err != nil {
+		return Record{}, false, fmt.Errorf("failed to read sheet: %w", err)
+	}
+	if len(rows) == 0 {
+		log.Println("status is empty")
+		return Record{}, false, nil
+	}
+	return taskStatus(rows, task)
+}
+
+// Clear deletes all status in the sheet.
+func (s SheetStore) Clear() error {
+	if err := s.Sheet.Clear(); err != nil {
+		return fmt.Errorf("failed to clear sheet: %w", err)
+	}
+	return nil
+}
+
+func taskStatus(rows [][]string, task string) (Record, bool, error) {
+	for i := len(rows) - 1; i >= 0; i-- { // taskが新旧重複している可能性があるのでstatusの下の行から見ていく
+		t := rows[i]
+
+		if len(t) < 2 || t[0] != task {
+			continue
+		}
+		result := Success
+		if len(t) >= 6 {
+			result = parseResult(t[5])
+		}
+		if result != Success {
+			continue
+		}
+		u, err := strconv.Atoi(t[1])
+		if err != nil {
+			return Record{}, false, fmt.Errorf("failed to convert %s to int: %v", t[1], err)
+		}
+
+		r := Record{Task: t[0], FinishedAt: time.Unix(int64(u), 0), Result: result}
+		if len(t) >= 4 {
+			if d, err := time.ParseDuration(t[3]); err == nil {
+				r.Duration = d
+				r.StartedAt = r.FinishedAt.Add(-d)
+			}
+		}
+		if len(t) >= 5 {
+			r.RunID = t[4]
+		}
+		return r, true, nil
+	}
+	return Record{}, false, nil
+}
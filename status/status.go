@@ -1,129 +1,152 @@
 package status
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
-	"strconv"
 	"time"
 
 	"github.com/ludwig125/gke-stockprice/date"
-	"github.com/ludwig125/gke-stockprice/sheet"
 )
 
-// Status is struct to control spreadsheet.
+// Status is struct to control task status.
 type Status struct {
-	Sheet sheet.Sheet
-	//task  Task
+	Store Store
+	RunID string // 同じ実行で記録したRecordに共通のID
 }
 
-// Task is struct to manage task status.
-type Task struct {
-	task       string
-	unixtime   int64
-	jst        string
-	turnaround string
+// Store is interface to save and fetch task status.
+type Store interface {
+	Save(r Record) error
+	// LastSuccess returns the last successful record of the task. なければfalseを返す
+	LastSuccess(task string) (Record, bool, error)
 }
 
-// ClearStatus clears spreadsheet status data.
-func (s Status) ClearStatus() error {
-	if err := s.Sheet.Clear(); err != nil {
-		return fmt.Errorf("failed to clear sheet: %w", err)
-	}
-	return nil
+// Record is a task execution.
+type Record struct {
+	Task       string
+	RunID      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Duration   time.Duration
+	Result     Result
+	Error      string // Resultがfailureの場合のエラー
 }
 
-// InsertStatus updates spreadsheet status.
-func (s Status) InsertStatus(task string, t time.Time, t2 time.Duration) error {
-	status := [][]string{
-		{task, fmt.Sprintf("%d", t.Unix()), t.Format("2006-01-02 15:04:05"), fmt.Sprintf("%v", t2)},
-	}
+// Result is result of task.
+type Result int
 
-	if err := s.Sheet.Insert(status); err != nil {
-		return fmt.Errorf("failed to sheet Update: %w", err)
-	}
-	return nil
+// 2: failure
+// 1: success
+// 0: unknownResult
+
+const (
+	unknownResult Result = iota
+	// Success means the task finished without error.
+	Success
+	// Failure means the task returned error.
+	Failure
+)
+
+func (r Result) String() string {
+	return [3]string{"unknownResult", "success", "failure"}[r]
 }
 
-// FetchStatus fetches spreadsheet status all tasks.
-func (s Status) FetchStatus() ([][]string, error) {
-	tasks, err := s.Sheet.Read()
-	if err != nil {
-		return nil, fmt.Errorf("failed to read sheet: %w", err)
+func parseResult(s string) Result {
+	for _, r := range []Result{Success, Failure} {
+		if r.String() == s {
+			return r
+		}
 	}
-	return tasks, nil
+	return unknownResult
 }
 
-func taskStatus(tasks [][]string, task string) (Task, error) {
-	for i := len(tasks) - 1; i >= 0; i-- { // taskが新旧重複している可能性があるのでstatusの下の行から見ていく
-		t := tasks[i]
+// StoreやSheetに書き込む時刻のタイムゾーン
+var jst = time.FixedZone("Asia/Tokyo", 9*60*60)
 
-		if t[0] != task {
-			continue
-		}
-		u, err := strconv.Atoi(t[1])
-		if err != nil {
-			return Task{}, fmt.Errorf("failed to convert %s to int: %v", t[1], err)
-		}
-
-		var jst, turnaround string
-		if len(t) >= 4 {
-			turnaround = t[3]
-		}
-		if len(t) >= 3 {
-			jst = t[2]
-		}
+// NewRunID returns ID of a run. 例: 20200104050000-1a2b3c
+func NewRunID(t time.Time) string {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("failed to read random bytes: %v", err)
+	}
+	return t.In(jst).Format("20060102150405") + "-" + hex.EncodeToString(b)
+}
 
-		return Task{task: t[0], unixtime: int64(u), jst: jst, turnaround: turnaround}, nil
+// InsertStatus saves successful task finished at t taking t2.
+func (s Status) InsertStatus(task string, t time.Time, t2 time.Duration) error {
+	r := Record{Task: task, RunID: s.RunID, StartedAt: t.Add(-t2), FinishedAt: t, Duration: t2, Result: Success}
+	if err := s.Store.Save(r); err != nil {
+		return fmt.Errorf("failed to Save: %w", err)
 	}
-	return Task{}, fmt.Errorf("failed to fetch task '%s' from status sheet", task)
+	return nil
 }
 
 // IsTaskDoneAfter returns true when task is done after u(midnight unixtime)
 func (s Status) IsTaskDoneAfter(task string, u int64) (bool, error) {
-	tasks, err := s.FetchStatus()
+	r, ok, err := s.Store.LastSuccess(task)
 	if err != nil {
-		return false, fmt.Errorf("failed to FetchStatus: %v", err)
+		return false, fmt.Errorf("failed to LastSuccess: %v", err)
 	}
-	if len(tasks) == 0 {
-		log.Println("status is empty")
-		return false, nil
-	}
-	t, err := taskStatus(tasks, task)
-	if err != nil {
-		log.Println("failed to taskStatus:", err)
+	if !ok {
+		log.Printf("task %s is not in status", task)
 		return false, nil
 	}
 
-	if t.unixtime < u { // 指定したUnixTimeよりもTaskの完了時刻が前であればFalse
+	if r.FinishedAt.Unix() < u { // 指定したUnixTimeよりもTaskの完了時刻が前であればFalse
 		return false, nil
 	}
 	return true, nil
 }
 
-// ExecIfIncompleteThisDay executes task when it is not done this day.
-func (s Status) ExecIfIncompleteThisDay(task string, thisTime time.Time, fn func() error) error {
-	start := time.Now()
+// IsTaskDoneThisDay returns true when task is done after midnight of thisTime.
+func (s Status) IsTaskDoneThisDay(task string, thisTime time.Time) (bool, error) {
 	// thisTimeの日の0時0分0秒より後にtaskが完了したかどうかを確認する
 	midnight, err := getLocalMidnightUnixTime(thisTime)
 	if err != nil {
-		return fmt.Errorf("failed to getLocalMidnightUnixTime: %v", err)
+		return false, fmt.Errorf("failed to getLocalMidnightUnixTime: %v", err)
+	}
+	return s.IsTaskDoneAfter(task, midnight)
+}
+
+// Record saves the result of task started at start and finished at finish.
+// errがnilでなければfailureとして記録する
+func (s Status) Record(task string, start, finish time.Time, err error) error {
+	r := Record{Task: task, RunID: s.RunID, StartedAt: start, FinishedAt: finish, Duration: finish.Sub(start), Result: Success}
+	if err != nil {
+		r.Result = Failure
+		r.Error = err.Error()
 	}
-	ok, err := s.IsTaskDoneAfter(task, midnight)
+	if err := s.Store.Save(r); err != nil {
+		return fmt.Errorf("failed to Save: %w", err)
+	}
+	return nil
+}
+
+// ExecIfIncompleteThisDay executes task when it is not done this day.
+// 失敗した場合もエラーをRecordに残す
+func (s Status) ExecIfIncompleteThisDay(task string, thisTime time.Time, fn func() error) error {
+	start := time.Now()
+	ok, err := s.IsTaskDoneThisDay(task, thisTime)
 	if err != nil {
-		return fmt.Errorf("failed to IsTaskDoneAfter: %v", err)
+		return fmt.Errorf("failed to IsTaskDoneThisDay: %v", err)
 	}
 	if ok {
 		return nil
 	}
 	//　taskがまだ完了済みでなければ実行
-	if err := fn(); err != nil {
-		return fmt.Errorf("failed to fn: %v", err)
-	}
+	fnErr := fn()
 
-	turnaround := time.Since(start)
-	// InsertStatusにはtask名、現在時刻（thisTImeとして渡された時刻＋所要時間）、所要時間（turnaround）を設定
-	if err := s.InsertStatus(task, thisTime.Add(turnaround), turnaround); err != nil {
-		return fmt.Errorf("failed to InsertStatus: %v", err)
+	// 開始時刻はthisTime、終了時刻はthisTimeとして渡された時刻＋所要時間とする
+	if err := s.Record(task, thisTime, thisTime.Add(time.Since(start)), fnErr); err != nil {
+		if fnErr == nil {
+			return fmt.Errorf("failed to Record: %v", err)
+		}
+		log.Printf("failed to record failure of %s: %v", task, err)
+	}
+	if fnErr != nil {
+		return fmt.Errorf("failed to fn: %v", fnErr)
 	}
 	return nil
 }
@@ -24,10 +24,11 @@ func TestStatus(t *testing.T) { // Statusの機能全体を通したTest
 
 	// daily処理の進捗を管理するためのSheet
 	sh := sheet.NewSpreadSheet(srv, mustGetenv(t, "INTEGRATION_TEST_SHEETID"), "status")
-	s := Status{Sheet: sh}
+	store := SheetStore{Sheet: sh}
+	s := Status{Store: store, RunID: NewRunID(time.Now())}
 
-	t.Run("ClearStatus", func(t *testing.T) {
-		s.ClearStatus()
+	t.Run("Clear", func(t *testing.T) {
+		store.Clear()
 	})
 	t.Run("InsertStatus", func(t *testing.T) {
 		s.InsertStatus("task1", time.Date(2020, 1, 3, 23, 59, 59, 0, time.Local), 100*time.Nanosecond)
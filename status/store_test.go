@@ -0,0 +1,181 @@
+package status
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// テスト用にRecordをメモリに持つStore
+type memStore struct {
+	records []Record
+	saveErr error
+}
+
+func (m *memStore) Save(r Record) error {
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	m.records = append(m.records, r)
+	return nil
+}
+
+func (m *memStore) LastSuccess(task string) (Record, bool, error) {
+	for i := len(m.records) - 1; i >= 0; i-- {
+		if r := m.records[i]; r.Task == task && r.Result == Success {
+			return r, true, nil
+		}
+	}
+	return Record{}, false, nil
+}
+
+func TestExecIfIncompleteThisDayFailure(t *testing.T) {
+	store := &memStore{}
+	s := Status{Store: store, RunID: "run1"}
+	thisTime := time.Date(2020, 1, 4, 5, 0, 0, 0, jst)
+
+	// 失敗したtaskはfailureとして記録し、次の実行で再度実行する
+	if err := s.ExecIfIncompleteThisDay("task1", thisTime, func() error { return errors.New("scrape error") }); err == nil {
+		t.Fatal("want error")
+	}
+	if len(store.records) != 1 {
+		t.Fatalf("got records: %v, want 1 record", store.records)
+	}
+	if r := store.records[0]; r.Task != "task1" || r.RunID != "run1" || r.Result != Failure || r.Error != "scrape error" || !r.StartedAt.Equal(thisTime) {
+		t.Errorf("got record: %#v", r)
+	}
+
+	executed := false
+	if err := s.ExecIfIncompleteThisDay("task1", thisTime, func() error {
+		executed = true
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to ExecIfIncompleteThisDay: %v", err)
+	}
+	if !executed {
+		t.Error("failed task is not executed again")
+	}
+	if r := store.records[1]; r.Result != Success || r.Error != "" {
+		t.Errorf("got record: %#v", r)
+	}
+}
+
+func TestMirrorStore(t *testing.T) {
+	primary := &memStore{}
+	mirror := &memStore{saveErr: errors.New("sheet error")}
+	m := MirrorStore{Primary: primary, Mirror: mirror}
+
+	r := Record{Task: "task1", Result: Success}
+	// mirrorへの書き込みに失敗してもエラーにしない
+	if err := m.Save(r); err != nil {
+		t.Fatalf("failed to Save: %v", err)
+	}
+	got, ok, err := m.LastSuccess("task1")
+	if err != nil || !ok || !reflect.DeepEqual(got, r) {
+		t.Errorf("got %#v, %v, %v, want %#v", got, ok, err, r)
+	}
+
+	primary.saveErr = errors.New("db error")
+	if err := m.Save(r); err == nil {
+		t.Error("want error of primary")
+	}
+}
+
+func TestTaskStatus(t *testing.T) {
+	rows := [][]string{
+		{"task1", "1578063599", "2020-01-03 23:59:59", "1s"}, // 以前の4列だけの行
+		{"task2", "1578063600", "2020-01-04 00:00:00", "2s", "run1", "success", ""},
+		{"task2", "1578063700", "2020-01-04 00:01:40", "3s", "run2", "failure", "error"},
+	}
+	cases := map[string]struct {
+		task   string
+		want   Record
+		wantOK bool
+	}{
+		"old_format": {
+			task:   "task1",
+			want:   Record{Task: "task1", StartedAt: time.Unix(1578063598, 0), FinishedAt: time.Unix(1578063599, 0), Duration: time.Second, Result: Success},
+			wantOK: true,
+		},
+		"skip_failure": {
+			task:   "task2",
+			want:   Record{Task: "task2", RunID: "run1", StartedAt: time.Unix(1578063598, 0), FinishedAt: time.Unix(1578063600, 0), Duration: 2 * time.Second, Result: Success},
+			wantOK: true,
+		},
+		"not_found": {
+			task:   "task3",
+			wantOK: false,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, ok, err := taskStatus(rows, tc.task)
+			if err != nil {
+				t.Fatalf("failed to taskStatus: %v", err)
+			}
+			if ok != tc.wantOK || !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %#v, %v, want %#v, %v", got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+// MySQLStoreが使うInsertDBとSelectDBだけを実装する
+type fakeDB struct {
+	inserted [][]string
+	selected [][]string
+	query    string
+}
+
+func (f *fakeDB) ShowDatabases() (string, error) { return "", nil }
+func (f *fakeDB) InsertDB(table string, records [][]string) error {
+	f.inserted = append(f.inserted, records...)
+	return nil
+}
+func (f *fakeDB) InsertOrUpdateDB(table string, records [][]string) error { return nil }
+func (f *fakeDB) SelectDB(q string) ([][]string, error) {
+	f.query = q
+	return f.selected, nil
+}
+func (f *fakeDB) DeleteFromDB(table string, codes []string) error { return nil }
+func (f *fakeDB) CloseDB() error                                  { return nil }
+
+func TestMySQLStore(t *testing.T) {
+	db := &fakeDB{}
+	m := MySQLStore{DB: db, Table: "task_status"}
+
+	r := Record{
+		Task:       "saveStockPrice",
+		RunID:      "run1",
+		StartedAt:  time.Date(2020, 1, 4, 5, 0, 0, 0, jst),
+		FinishedAt: time.Date(2020, 1, 4, 5, 1, 30, 0, jst),
+		Duration:   90 * time.Second,
+		Result:     Success,
+	}
+	if err := m.Save(r); err != nil {
+		t.Fatalf("failed to Save: %v", err)
+	}
+	want := [][]string{{"saveStockPrice", "run1", "2020-01-04 05:00:00", "2020-01-04 05:01:30", "90.000", "success", ""}}
+	if !reflect.DeepEqual(db.inserted, want) {
+		t.Fatalf("got %v, want %v", db.inserted, want)
+	}
+
+	db.selected = db.inserted
+	got, ok, err := m.LastSuccess("saveStockPrice")
+	if err != nil || !ok {
+		t.Fatalf("failed to LastSuccess: %v, %v", ok, err)
+	}
+	if got.Task != r.Task || got.RunID != r.RunID || !got.StartedAt.Equal(r.StartedAt) || !got.FinishedAt.Equal(r.FinishedAt) || got.Duration != r.Duration || got.Result != Success {
+		t.Errorf("got %#v, want %#v", got, r)
+	}
+	if !strings.Contains(db.query, "WHERE task = 'saveStockPrice' AND result = 'success'") {
+		t.Errorf("unexpected query: %s", db.query)
+	}
+
+	db.selected = nil
+	if _, ok, err := m.LastSuccess("saveStockPrice"); err != nil || ok {
+		t.Errorf("got %v, %v, want not found", ok, err)
+	}
+}
@@ -73,6 +73,7 @@ type DailyStockPrice struct {
 	dailyStockpriceURL string
 	fetchInterval      time.Duration
 	fetchTimeout       time.Duration
+	checkpoint         *Checkpoint // nilの場合は全銘柄をscrapeする
 }
 
 func (sp DailyStockPrice) saveStockPrice(ctx context.Context, codes []string, currentTime time.Time) (FailedCodes, error) {
@@ -91,6 +92,12 @@ func (sp DailyStockPrice) saveStockPrice(ctx context.Context, codes []string, cu
 		log.Println("saveStockPrice total time:", time.Since(start))
 	}()
 
+	// 再実行の場合は当日DBに格納済みの銘柄をscrapeしない
+	codes, err := sp.checkpoint.unfinished(codes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch checkpoint: %w", err)
+	}
+
 	for _, code := range codes {
 		code := code
 
@@ -113,6 +120,10 @@ func (sp DailyStockPrice) saveStockPrice(ctx context.Context, codes []string, cu
 				if err := sp.db.InsertDB("daily", cp.Slices()); err != nil {
 					return fmt.Errorf("failed to insertCodePricesToDB: %w", err)
 				}
+				// checkpointに書けなくても再実行時にscrapeし直すだけなのでログだけ出す
+				if err := sp.checkpoint.mark([]string{code}); err != nil {
+					log.Printf("failed to mark checkpoint, code: %s, %v", code, err)
+				}
 
 				log.Printf("code %s latency: %v", code, time.Since(s))
 				return nil
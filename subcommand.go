@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 起動時の引数でサブコマンドが指定された場合は、日次バッチの代わりにそのコマンドを実行する
+// 例: gke-stockprice backtest -from 2019/01/01 -entry "trendTurn == upwardTurn" -exit "trendTurn == downwardTurn"
+// 例: gke-stockprice forwardreturn -from 2019/01/01 -horizons 1,5,20 -sheet forward_return
+// 例: gke-stockprice runs -limit 20
+var subcommands = map[string]func(ctx context.Context, args []string) error{
+	"backtest":      execBacktest,
+	"forwardreturn": execForwardReturn,
+	"runs":          execRuns,
+}
+
+func execSubcommand(ctx context.Context, name string, args []string) error {
+	cmd, ok := subcommands[name]
+	if !ok {
+		var names []string
+		for n := range subcommands {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown subcommand: '%s'. available: %s", name, strings.Join(names, ","))
+	}
+	return cmd(ctx, args)
+}
@@ -0,0 +1,14 @@
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestExecSubcommandUnknown(t *testing.T) {
+	if err := execSubcommand(context.Background(), "unknown", nil); err == nil {
+		t.Error("want error for unknown subcommand")
+	}
+}
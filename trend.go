@@ -7,17 +7,18 @@ import (
 // CodeDateTrendLists maps code and DateTrendList.
 type CodeDateTrendLists map[string][]DateTrendList
 
-func (c CodeDateTrendLists) makeTrendDataForDB() [][]string {
+// paramsVersionはtrendを計算したTrendParamsのversion
+func (c CodeDateTrendLists) makeTrendDataForDB(paramsVersion string) [][]string {
 	var trendData [][]string
 	for code, dateTrendLists := range c {
 		for _, dateTrendList := range dateTrendLists {
-			trendData = append(trendData, codeDateTrendListToStringSlice(code, dateTrendList))
+			trendData = append(trendData, codeDateTrendListToStringSlice(code, dateTrendList, paramsVersion))
 		}
 	}
 	return trendData
 }
 
-func codeDateTrendListToStringSlice(code string, dateTrendList DateTrendList) []string {
+func codeDateTrendListToStringSlice(code string, dateTrendList DateTrendList, paramsVersion string) []string {
 	trendList := dateTrendList.trendList
 	return []string{
 		code,
@@ -27,6 +28,8 @@ func codeDateTrendListToStringSlice(code string, dateTrendList DateTrendList) []
 		fmt.Sprintf("%.4g", trendList.growthRate),
 		fmt.Sprintf("%d", trendList.crossMoving5),
 		fmt.Sprintf("%d", trendList.continuationDays),
+		fmt.Sprintf("%d", trendList.generalTrend),
+		paramsVersion,
 	}
 }
 
@@ -43,17 +46,25 @@ type TrendList struct {
 	growthRate       float64
 	crossMoving5     CrossMoving5Type
 	continuationDays int
+	generalTrend     GeneralTrend
 }
 
-func calculateTrendList(closes []float64, movings TrendMovingAvgs, pastTrends []Trend, longTermThresholdDays int) TrendList {
-	trend := classifyTrend(movings, pastTrends, longTermThresholdDays)
-	return TrendList{
+func calculateTrendList(classifier TrendClassifier, closes []float64, movings TrendMovingAvgs, dateBars []DateBar, pastTrends []Trend, params TrendParams) TrendList {
+	trend := classifier.Classify(TrendInput{
+		MovingAvgs:            movings,
+		PastTrends:            pastTrends,
+		DateBars:              dateBars,
+		LongTermThresholdDays: params.LongTermThresholdDays,
+	})
+	tl := TrendList{
 		trend:            trend,
 		trendTurn:        trendTurnType(trend, pastTrends),
 		growthRate:       latestGrowthRate(closes),
 		crossMoving5:     crossMovingAvg5Type(closes, movings.M5),
-		continuationDays: calcContinuationDays(closes),
+		continuationDays: calcContinuationDays(closes, params.MaxContinuationDays),
 	}
+	tl.generalTrend = generalTrend(tl.trend, tl.trendTurn, tl.growthRate, tl.crossMoving5)
+	return tl
 }
 
 // Trend means stock price trend defined bellow
@@ -260,7 +271,7 @@ func crossMovingAvg5Type(closes []float64, moving5 float64) CrossMoving5Type {
 	return noCross
 }
 
-func calcContinuationDays(closes []float64) int {
+func calcContinuationDays(closes []float64, maxContinuationDays int) int {
 	if len(closes) < 2 {
 		return 0
 	}
@@ -297,33 +308,100 @@ func calcContinuationDays(closes []float64) int {
 	return continuationDays
 }
 
-// TODO： 以下のような判定関数を今後用いる？
-func gereralTrend(trend Trend, growthRate float64, crossMoving5 bool, prevTrend Trend, trendTurn bool) {
-	// 非常に強い買い局面(上昇トレンドに転換)
-	// trendがAdvance、crossMoving5がTrue、growthRateが正、trendTurnがTrueで、prevTrendがtrendより低い
+// GeneralTrend is buy or sell phase classified by trend, trendTurn, growthRate and crossMoving5.
+type GeneralTrend int
 
-	// 強い買い局面
-	// trendがAdvance、crossMoving5がTrue、growthRateが正
+// 9: veryStrongBuy : 非常に強い買い局面(上昇トレンドに転換)
+// 8: strongBuy : 強い買い局面
+// 7: buy : 買い局面
+// 6: weakBuy : 弱い買い局面
+// 5: neutral : どちらでもない
+// 4: weakSell : 弱い売り局面
+// 3: sell : 売り局面
+// 2: strongSell : 強い売り局面
+// 1: veryStrongSell : 非常に強い売り局面(下降トレンドに転換)
+// 0: unknownGeneralTrend
 
-	// 買い局面
-	// trendがAdvance、crossMoving5がFalse
+const (
+	unknownGeneralTrend GeneralTrend = iota
+	veryStrongSell
+	strongSell
+	sell
+	weakSell
+	neutral
+	weakBuy
+	buy
+	strongBuy
+	veryStrongBuy
+)
+
+// constのString変換メソッド
+func (g GeneralTrend) String() string {
+	return [10]string{"unknownGeneralTrend", "veryStrongSell", "strongSell", "sell", "weakSell", "neutral", "weakBuy", "buy", "strongBuy", "veryStrongBuy"}[g]
+}
+
+// growthRateは前営業日の終値/前々営業日の終値なので、1より大きければ正、小さければ負とみなす
+func generalTrend(trend Trend, trendTurn TrendTurnType, growthRate float64, crossMoving5 CrossMoving5Type) GeneralTrend {
+	upward := crossMoving5 == upwardCross && growthRate > 1     // 終値が上向きに５日移動平均線をまたいだ
+	downward := crossMoving5 == downwardCross && growthRate < 1 // 終値が下向きに５日移動平均線をまたいだ
 
 	// 弱い買い局面
-	// trendがAdvance以外、crossMoving5がTrue、growthRateが正
+	// trendがAdvance以外、crossMoving5がupwardCross、growthRateが正
 	// or
-	// trendTurnがTrueで、prevTrendがtrendより低い
-
+	// trendTurnがupwardTurn(prevTrendがtrendより低い)
+	weakBuySignal := upward || trendTurn == upwardTurn
 	// 弱い売り局面
-	// trendがDecline以外、crossMoving5がTrue、growthRateが負
+	// trendがDecline以外、crossMoving5がdownwardCross、growthRateが負
 	// or
-	// trendTurnがTrueで、prevTrendがtrendより高い
-
-	// 売り局面
-	// trendがDecline、crossMoving5がFalse
-
-	// 強い売り局面
-	// trendがDecline、crossMoving5がTrue、growthRateが負
-
-	// 非常に強い売り局面(下降トレンドに転換)
-	// trendがDecline、crossMoving5がTrue、growthRateが負、trendTurnがTrueで、prevTrendがtrendより高い
+	// trendTurnがdownwardTurn(prevTrendがtrendより高い)
+	weakSellSignal := downward || trendTurn == downwardTurn
+
+	switch trend {
+	case shortTermAdvance, longTermAdvance:
+		// 非常に強い買い局面(上昇トレンドに転換)
+		// trendがAdvance、crossMoving5がupwardCross、growthRateが正、trendTurnがupwardTurn(prevTrendがtrendより低い)
+		if upward && trendTurn == upwardTurn {
+			return veryStrongBuy
+		}
+		// 強い買い局面
+		// trendがAdvance、crossMoving5がupwardCross、growthRateが正
+		if upward {
+			return strongBuy
+		}
+		// trendがAdvanceでも弱い売りの条件に当てはまれば弱い売り局面
+		if weakSellSignal {
+			return weakSell
+		}
+		// 買い局面
+		// trendがAdvance、crossMoving5がupwardCrossでない
+		return buy
+	case shortTermDecline, longTermDecline:
+		// 非常に強い売り局面(下降トレンドに転換)
+		// trendがDecline、crossMoving5がdownwardCross、growthRateが負、trendTurnがdownwardTurn(prevTrendがtrendより高い)
+		if downward && trendTurn == downwardTurn {
+			return veryStrongSell
+		}
+		// 強い売り局面
+		// trendがDecline、crossMoving5がdownwardCross、growthRateが負
+		if downward {
+			return strongSell
+		}
+		// trendがDeclineでも弱い買いの条件に当てはまれば弱い買い局面
+		if weakBuySignal {
+			return weakBuy
+		}
+		// 売り局面
+		// trendがDecline、crossMoving5がdownwardCrossでない
+		return sell
+	case non:
+		// 両方の条件に当てはまる場合はどちらとも言えないのでneutralにする
+		if weakBuySignal && !weakSellSignal {
+			return weakBuy
+		}
+		if weakSellSignal && !weakBuySignal {
+			return weakSell
+		}
+		return neutral
+	}
+	return unknownGeneralTrend
 }
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultTrendClassifier = "movingavg"
+
+	slopeShortDays = 20    // slopeTrendClassifierで短期の傾きを見る期間
+	slopeLongDays  = 60    // slopeTrendClassifierで長期の傾きを見る期間
+	slopeThreshold = 0.001 // 1日あたりの終値の変化率がこれを超えたら上昇(下降)とみなす
+	adxDays        = 14    // ADX, +DI, -DIの期間
+	adxTrendLevel  = 25    // ADXがこれ以上ならトレンドが出ているとみなす
+	adxStrongLevel = 40    // ADXがこれ以上なら強いトレンドとみなす
+)
+
+// TrendClassifier classifies Trend on a date.
+type TrendClassifier interface {
+	Classify(in TrendInput) Trend
+}
+
+// TrendInput has data to classify Trend on a date.
+type TrendInput struct {
+	MovingAvgs            TrendMovingAvgs
+	PastTrends            []Trend   // 前日から遡った日付の降順のTrend。最大longTermThresholdDays個
+	DateBars              []DateBar // その日を先頭にした日付の降順のDateBar
+	LongTermThresholdDays int
+}
+
+// 名前で選択できるTrendClassifier
+var trendClassifiers = map[string]TrendClassifier{
+	"movingavg": movingAvgTrendClassifier{},
+	"slope":     slopeTrendClassifier{},
+	"adx":       adxTrendClassifier{},
+}
+
+func getTrendClassifier(name string) (TrendClassifier, error) {
+	if name == "" {
+		name = defaultTrendClassifier
+	}
+	tc, ok := trendClassifiers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown trend classifier: '%s'. available: %s", name, strings.Join(trendClassifierNames(), ","))
+	}
+	return tc, nil
+}
+
+func trendClassifierNames() []string {
+	names := make([]string, 0, len(trendClassifiers))
+	for name := range trendClassifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// "slope:trend_slope,adx:trend_adx" のような文字列をTrendClassifierの名前とtable名のMapに変換する
+func parseComparisonTrendTables(s string) (map[string]string, error) {
+	tables := make(map[string]string)
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		sl := strings.Split(v, ":")
+		if len(sl) != 2 || sl[0] == "" || sl[1] == "" {
+			return nil, fmt.Errorf("invalid comparison trend table: '%s'. Please set like 'slope:trend_slope'", v)
+		}
+		if _, err := getTrendClassifier(sl[0]); err != nil {
+			return nil, fmt.Errorf("failed to getTrendClassifier: %v", err)
+		}
+		tables[sl[0]] = sl[1]
+	}
+	return tables, nil
+}
+
+// 5, 20, 60, 100日移動平均の並び順で判断する(classifyTrend)
+type movingAvgTrendClassifier struct{}
+
+func (movingAvgTrendClassifier) Classify(in TrendInput) Trend {
+	return classifyTrend(in.MovingAvgs, in.PastTrends, in.LongTermThresholdDays)
+}
+
+// 終値の回帰直線の傾きで判断する
+// 短期と長期の両方が上昇(下降)していればlongTerm、短期だけならshortTermとする
+type slopeTrendClassifier struct{}
+
+func (slopeTrendClassifier) Classify(in TrendInput) Trend {
+	closes := DateCloses(DateBars(in.DateBars).dateCloses()).closes()
+	short := normalizedSlope(window(closes, 0, slopeShortDays))
+	long := normalizedSlope(window(closes, 0, slopeLongDays))
+
+	if short > slopeThreshold {
+		if long > slopeThreshold {
+			return longTermAdvance
+		}
+		return shortTermAdvance
+	}
+	if short < -slopeThreshold {
+		if long < -slopeThreshold {
+			return longTermDecline
+		}
+		return shortTermDecline
+	}
+	return non
+}
+
+// 日付の降順の終値から最小二乗法で求めた1日あたりの傾きを、終値の平均で割って返す
+func normalizedSlope(closes []float64) float64 {
+	n := len(closes)
+	avg := average(closes)
+	if n < 2 || avg == 0 {
+		return 0
+	}
+	// xは古い日を0として日付の昇順に振る
+	xAvg := float64(n-1) / 2
+	var num, den float64
+	for i, c := range closes {
+		x := float64(n-1-i) - xAvg
+		num += x * (c - avg)
+		den += x * x
+	}
+	return num / den / avg
+}
+
+// ADX(Average Directional Index)でトレンドの強さを、+DIと-DIの大小で向きを判断する
+type adxTrendClassifier struct{}
+
+func (adxTrendClassifier) Classify(in TrendInput) Trend {
+	if len(in.DateBars) < 2 { // 前日がないとDMが計算できない
+		return non
+	}
+	adx, plusDI, minusDI := averageDirectionalIndex(in.DateBars)
+	if adx < adxTrendLevel || plusDI == minusDI {
+		return non
+	}
+	if plusDI > minusDI {
+		if adx >= adxStrongLevel {
+			return longTermAdvance
+		}
+		return shortTermAdvance
+	}
+	if adx >= adxStrongLevel {
+		return longTermDecline
+	}
+	return shortTermDecline
+}
+
+// 日付の降順のDateBarから直近のADX, +DI, -DIを返す
+// 平滑化はWilderの方式ではなく単純平均とする。期間が足りない場合はあるだけで計算する
+func averageDirectionalIndex(dateBars []DateBar) (adx, plusDI, minusDI float64) {
+	// DXをadxDays日分計算するために、DM, TRは最大adxDays*2-1日分必要
+	bars := dateBars
+	if len(bars) > adxDays*2 {
+		bars = bars[:adxDays*2]
+	}
+	n := len(bars) - 1 // 前日がある日の数
+	plusDMs := make([]float64, n)
+	minusDMs := make([]float64, n)
+	trs := DateBars(bars).trueRanges()[:n]
+	for i := 0; i < n; i++ {
+		up := bars[i].High - bars[i+1].High
+		down := bars[i+1].Low - bars[i].Low
+		if up > down && up > 0 {
+			plusDMs[i] = up
+		}
+		if down > up && down > 0 {
+			minusDMs[i] = down
+		}
+	}
+
+	var dxs []float64
+	for i := 0; i < n && i < adxDays; i++ {
+		tr := sum(window(trs, i, adxDays))
+		if tr == 0 {
+			continue
+		}
+		p := 100 * sum(window(plusDMs, i, adxDays)) / tr
+		m := 100 * sum(window(minusDMs, i, adxDays)) / tr
+		if i == 0 {
+			plusDI, minusDI = p, m
+		}
+		if p+m == 0 {
+			dxs = append(dxs, 0)
+			continue
+		}
+		dxs = append(dxs, 100*math.Abs(p-m)/(p+m))
+	}
+	return average(dxs), plusDI, minusDI
+}
+
+func sum(fs []float64) float64 {
+	var s float64
+	for _, f := range fs {
+		s += f
+	}
+	return s
+}
@@ -0,0 +1,169 @@
+// +build !integration
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// 日付の降順のDateBarを作る。closesは日付の昇順で与える
+func makeDateBarsFromCloses(closes []float64) []DateBar {
+	bars := make([]DateBar, len(closes))
+	for i, c := range closes {
+		bars[len(closes)-1-i] = DateBar{Date: fmt.Sprintf("day%03d", i), Open: c, High: c + 1, Low: c - 1, Close: c}
+	}
+	return bars
+}
+
+func linearCloses(begin, step float64, n int) []float64 {
+	closes := make([]float64, n)
+	for i := range closes {
+		closes[i] = begin + step*float64(i)
+	}
+	return closes
+}
+
+func TestGetTrendClassifier(t *testing.T) {
+	tests := map[string]struct {
+		name    string
+		want    TrendClassifier
+		wantErr bool
+	}{
+		"default":   {name: "", want: movingAvgTrendClassifier{}},
+		"movingavg": {name: "movingavg", want: movingAvgTrendClassifier{}},
+		"slope":     {name: "slope", want: slopeTrendClassifier{}},
+		"adx":       {name: "adx", want: adxTrendClassifier{}},
+		"unknown":   {name: "macd", wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := getTrendClassifier(tc.name)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("gotErr: %v, wantErr: %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("got: %#v, want: %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseComparisonTrendTables(t *testing.T) {
+	tests := map[string]struct {
+		s       string
+		want    map[string]string
+		wantErr bool
+	}{
+		"empty": {
+			s:    "",
+			want: map[string]string{},
+		},
+		"two_tables": {
+			s:    "slope:trend_slope, adx:trend_adx",
+			want: map[string]string{"slope": "trend_slope", "adx": "trend_adx"},
+		},
+		"no_table": {
+			s:       "slope:",
+			wantErr: true,
+		},
+		"unknown_classifier": {
+			s:       "macd:trend_macd",
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseComparisonTrendTables(tc.s)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("gotErr: %v, wantErr: %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %#v, want: %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSlopeTrendClassifier(t *testing.T) {
+	tests := map[string]struct {
+		closes []float64 // 日付の昇順
+		want   Trend
+	}{
+		"one_close": {
+			closes: []float64{100},
+			want:   non,
+		},
+		"advance": {
+			closes: linearCloses(100, 1, slopeLongDays),
+			want:   longTermAdvance,
+		},
+		"decline": {
+			closes: linearCloses(200, -1, slopeLongDays),
+			want:   longTermDecline,
+		},
+		"flat": {
+			closes: linearCloses(100, 0, slopeLongDays),
+			want:   non,
+		},
+		"short_term_advance": {
+			// 長期では下がっているが直近だけ上がっている
+			closes: append(linearCloses(300, -5, slopeLongDays-slopeShortDays), linearCloses(100, 1, slopeShortDays)...),
+			want:   shortTermAdvance,
+		},
+		"short_term_decline": {
+			// 長期では上がっているが直近だけ下がっている
+			closes: append(linearCloses(100, 5, slopeLongDays-slopeShortDays), linearCloses(300, -1, slopeShortDays)...),
+			want:   shortTermDecline,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			in := TrendInput{DateBars: makeDateBarsFromCloses(tc.closes)}
+			if got := (slopeTrendClassifier{}).Classify(in); got != tc.want {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestADXTrendClassifier(t *testing.T) {
+	tests := map[string]struct {
+		closes []float64 // 日付の昇順
+		want   Trend
+	}{
+		"one_bar": {
+			closes: []float64{100},
+			want:   non,
+		},
+		"advance": {
+			closes: linearCloses(100, 1, adxDays*2),
+			want:   longTermAdvance,
+		},
+		"decline": {
+			closes: linearCloses(200, -1, adxDays*2),
+			want:   longTermDecline,
+		},
+		"flat": {
+			closes: linearCloses(100, 0, adxDays*2),
+			want:   non,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			in := TrendInput{DateBars: makeDateBarsFromCloses(tc.closes)}
+			if got := (adxTrendClassifier{}).Classify(in); got != tc.want {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAverageDirectionalIndex(t *testing.T) {
+	// 毎日高値と安値が1ずつ上がるので+DMだけが出る
+	adx, plusDI, minusDI := averageDirectionalIndex(makeDateBarsFromCloses(linearCloses(100, 1, adxDays*2)))
+	if !almostEqual(adx, 100) || !almostEqual(plusDI, 50) || !almostEqual(minusDI, 0) {
+		t.Errorf("got adx: %v, +DI: %v, -DI: %v", adx, plusDI, minusDI)
+	}
+}
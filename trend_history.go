@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ludwig125/gke-stockprice/sheet"
+)
+
+// trendのタブは毎日書き直されるので、watchlistの銘柄のtrendを1日1行ずつ残すタブと、
+// 直近の終値の推移をSPARKLINEで表示するタブを別に作る
+const (
+	trendHistoryTab      = "trend_history"
+	sparklineTab         = "trend_sparkline"
+	defaultSparklineDays = 20
+)
+
+// 全watchlistの銘柄を重複なく、最初に出てきた順に返す
+func watchedCodes(watchlists []Watchlist) []string {
+	var codes []string
+	seen := make(map[string]bool)
+	for _, w := range watchlists {
+		for _, c := range w.Codes {
+			if seen[c] {
+				continue
+			}
+			seen[c] = true
+			codes = append(codes, c)
+		}
+	}
+	return codes
+}
+
+func (c CalculateDailyMovingAvgTrend) writeTrendHistory(ctl []codeDateTrendList, date string) error {
+	codes := watchedCodes(c.watchlists)
+	if len(codes) == 0 {
+		return nil
+	}
+	codeTrend := make(map[string]string, len(ctl))
+	for _, t := range ctl {
+		codeTrend[t.code] = t.trend.String()
+	}
+
+	if c.historySheet != nil {
+		// 最初の実行ではタブがなくReadに失敗するので先に作る
+		if a, ok := c.historySheet.(sheet.TabAdder); ok {
+			if err := a.AddSheetIfMissing(); err != nil {
+				return fmt.Errorf("failed to AddSheetIfMissing: %w", err)
+			}
+		}
+		rows, err := c.historySheet.Read()
+		if err != nil {
+			return fmt.Errorf("failed to read trend history: %w", err)
+		}
+		merged, appendOnly := mergeTrendHistory(rows, codes, codeTrend, date)
+		log.Println("try to print trend history to sheet")
+		if appendOnly {
+			err = c.historySheet.Insert(merged[len(merged)-1:])
+		} else {
+			err = c.historySheet.Update(merged)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to print trend history to sheet: %w", err)
+		}
+	}
+
+	if c.sparklineSheet != nil {
+		days := c.sparklineDays
+		if days <= 0 {
+			days = defaultSparklineDays
+		}
+		// 休日を挟んでもdays営業日分とれるように多めに取得する
+		d, err := time.Parse("2006/01/02", date)
+		if err != nil {
+			return fmt.Errorf("failed to parse date: %s, %v", date, err)
+		}
+		codeDateBars, err := fetchDailyBarsInBatches(c.db, codes, d.AddDate(0, 0, -days*2-10).Format("2006/01/02"), date)
+		if err != nil {
+			return fmt.Errorf("failed to fetchDailyBarsInBatches: %v", err)
+		}
+		log.Println("try to print trend sparkline to sheet")
+		if err := c.sparklineSheet.Update(makeSparklineDataForSheet(codes, codeTrend, codeDateBars, days, date)); err != nil {
+			return fmt.Errorf("failed to print trend sparkline to sheet: %w", err)
+		}
+	}
+	return nil
+}
+
+// historyの先頭行はdateと銘柄コード、以降は1日1行で各銘柄のtrend
+// watchlistに銘柄が増えたら列を後ろに足し、同じ日付の行があれば置き換える
+// 最後に1行足すだけで済む場合はappendOnlyをtrueにする
+func mergeTrendHistory(rows [][]string, codes []string, codeTrend map[string]string, date string) ([][]string, bool) {
+	d := strings.Replace(date, "/", "", -1)
+	appendOnly := len(rows) > 0
+
+	header := []string{"date"}
+	if len(rows) > 0 && len(rows[0]) > 0 {
+		header = append(header, rows[0][1:]...)
+	}
+	inHeader := make(map[string]bool, len(header))
+	for _, h := range header[1:] {
+		inHeader[h] = true
+	}
+	for _, code := range codes {
+		if !inHeader[code] {
+			header = append(header, code)
+			appendOnly = false
+		}
+	}
+
+	var body [][]string
+	if len(rows) > 1 {
+		body = rows[1:]
+	}
+	if n := len(body); n > 0 && len(body[n-1]) > 0 && body[n-1][0] == d { // 同じ日に再実行した場合
+		body = body[:n-1]
+		appendOnly = false
+	}
+
+	row := []string{d}
+	for _, code := range header[1:] {
+		row = append(row, codeTrend[code]) // 当日のtrendがない銘柄は空欄
+	}
+	merged := append([][]string{header}, body...)
+	return append(merged, row), appendOnly
+}
+
+// 銘柄ごとに当日のtrend、終値、days営業日前からの騰落率(%)、終値の推移のSPARKLINEを並べる
+func makeSparklineDataForSheet(codes []string, codeTrend map[string]string, codeDateBars map[string][]DateBar, days int, date string) [][]string {
+	data := [][]string{{"code", "trend", "close", fmt.Sprintf("change%dDays", days), "sparkline", strings.Replace(date, "/", "", -1)}}
+	for _, code := range codes {
+		dateBars := codeDateBars[code] // 日付の降順
+		if len(dateBars) > days {
+			dateBars = dateBars[:days]
+		}
+		if len(dateBars) == 0 {
+			data = append(data, []string{code, codeTrend[code], "", "", ""})
+			continue
+		}
+		closes := make([]float64, len(dateBars))
+		for i, b := range dateBars {
+			closes[len(dateBars)-1-i] = b.Close
+		}
+		first, last := closes[0], closes[len(closes)-1]
+		change, color := "", "green"
+		if first != 0 {
+			change = fmt.Sprintf("%.2f", (last/first-1)*100)
+		}
+		if last < first {
+			color = "red"
+		}
+		data = append(data, []string{code, codeTrend[code], fmt.Sprintf("%g", last), change, sheet.Sparkline(closes, color)})
+	}
+	return data
+}
@@ -0,0 +1,109 @@
+// +build !integration
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWatchedCodes(t *testing.T) {
+	watchlists := []Watchlist{
+		{Name: "bank", Codes: []string{"8306", "8316"}},
+		{Name: "mix", Codes: []string{"7203", "8306"}},
+	}
+	want := []string{"8306", "8316", "7203"}
+	if got := watchedCodes(watchlists); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMergeTrendHistory(t *testing.T) {
+	codeTrend := map[string]string{"8306": "longTermAdvance", "8316": "non"}
+
+	cases := map[string]struct {
+		rows           [][]string
+		codes          []string
+		want           [][]string
+		wantAppendOnly bool
+	}{
+		"first_run": {
+			rows:  nil,
+			codes: []string{"8306", "8316"},
+			want: [][]string{
+				{"date", "8306", "8316"},
+				{"20210108", "longTermAdvance", "non"},
+			},
+			wantAppendOnly: false,
+		},
+		"append": {
+			rows: [][]string{
+				{"date", "8306", "8316"},
+				{"20210107", "non", "non"},
+			},
+			codes: []string{"8306", "8316"},
+			want: [][]string{
+				{"date", "8306", "8316"},
+				{"20210107", "non", "non"},
+				{"20210108", "longTermAdvance", "non"},
+			},
+			wantAppendOnly: true,
+		},
+		"new_code_and_removed_code": { // watchlistから外れた銘柄の列は残す
+			rows: [][]string{
+				{"date", "7203", "8306"},
+				{"20210107", "non", "non"},
+			},
+			codes: []string{"8306", "8316"},
+			want: [][]string{
+				{"date", "7203", "8306", "8316"},
+				{"20210107", "non", "non"},
+				{"20210108", "", "longTermAdvance", "non"},
+			},
+			wantAppendOnly: false,
+		},
+		"same_date": {
+			rows: [][]string{
+				{"date", "8306", "8316"},
+				{"20210107", "non", "non"},
+				{"20210108", "non", "non"},
+			},
+			codes: []string{"8306", "8316"},
+			want: [][]string{
+				{"date", "8306", "8316"},
+				{"20210107", "non", "non"},
+				{"20210108", "longTermAdvance", "non"},
+			},
+			wantAppendOnly: false,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, appendOnly := mergeTrendHistory(tc.rows, tc.codes, codeTrend, "2021/01/08")
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+			if appendOnly != tc.wantAppendOnly {
+				t.Errorf("got appendOnly %v, want %v", appendOnly, tc.wantAppendOnly)
+			}
+		})
+	}
+}
+
+func TestMakeSparklineDataForSheet(t *testing.T) {
+	codeTrend := map[string]string{"8306": "longTermAdvance", "8316": "non"}
+	codeDateBars := map[string][]DateBar{ // 日付の降順
+		"8306": {{Date: "2021/01/08", Close: 110}, {Date: "2021/01/07", Close: 105}, {Date: "2021/01/06", Close: 100}, {Date: "2021/01/05", Close: 1}},
+		"8316": {{Date: "2021/01/08", Close: 90}, {Date: "2021/01/07", Close: 100}},
+	}
+	want := [][]string{
+		{"code", "trend", "close", "change3Days", "sparkline", "20210108"},
+		{"8306", "longTermAdvance", "110", "10.00", `=SPARKLINE({100,105,110},{"charttype","line";"color","green"})`},
+		{"8316", "non", "90", "-10.00", `=SPARKLINE({100,90},{"charttype","line";"color","red"})`},
+		{"9999", "", "", "", ""},
+	}
+	got := makeSparklineDataForSheet([]string{"8306", "8316", "9999"}, codeTrend, codeDateBars, 3, "2021/01/08")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ludwig125/gke-stockprice/database"
+)
+
+// TrendParams is parameters to calculate trend.
+// trendの各行にはversionを書き込むので、パラメータを変えても過去の結果がどのパラメータで計算されたかわかる
+type TrendParams struct {
+	Classifier            string `json:"classifier"`            // trendClassifiersに登録された名前
+	LongTermThresholdDays int    `json:"longTermThresholdDays"` // longTermThresholdDaysの期間ShortTermのTrendが続いていたらLongとみなす閾値
+	MaxContinuationDays   int    `json:"maxContinuationDays"`   // continuationDaysの最大値
+}
+
+var defaultTrendParams = TrendParams{
+	Classifier:            defaultTrendClassifier,
+	LongTermThresholdDays: 2,
+	MaxContinuationDays:   11,
+}
+
+// 0値のフィールドはdefaultTrendParamsの値にする
+func (p TrendParams) withDefaults() TrendParams {
+	if p.Classifier == "" {
+		p.Classifier = defaultTrendParams.Classifier
+	}
+	if p.LongTermThresholdDays <= 0 {
+		p.LongTermThresholdDays = defaultTrendParams.LongTermThresholdDays
+	}
+	if p.MaxContinuationDays <= 0 {
+		p.MaxContinuationDays = defaultTrendParams.MaxContinuationDays
+	}
+	return p
+}
+
+// パラメータのJSONのsha256の先頭12文字
+// フィールドの順番は固定なので同じパラメータなら同じversionになる
+func (p TrendParams) version() string {
+	b, _ := json.Marshal(p) // フィールドはstringとintだけなのでエラーにならない
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// trend_params tableのカラムの順に並べる
+func (p TrendParams) slice() []string {
+	return []string{
+		p.version(),
+		p.Classifier,
+		fmt.Sprintf("%d", p.LongTermThresholdDays),
+		fmt.Sprintf("%d", p.MaxContinuationDays),
+	}
+}
+
+func writeTrendParams(db database.DB, table string, params ...TrendParams) error {
+	var data [][]string
+	for _, p := range params {
+		data = append(data, p.slice())
+	}
+	if err := db.InsertOrUpdateDB(table, data); err != nil {
+		return fmt.Errorf("failed to insert %s: %v", table, err)
+	}
+	return nil
+}
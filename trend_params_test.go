@@ -0,0 +1,74 @@
+// +build !integration
+
+package main
+
+import (
+	"testing"
+)
+
+func TestTrendParamsWithDefaults(t *testing.T) {
+	tests := map[string]struct {
+		params TrendParams
+		want   TrendParams
+	}{
+		"zero": {
+			params: TrendParams{},
+			want:   defaultTrendParams,
+		},
+		"partial": {
+			params: TrendParams{LongTermThresholdDays: 5},
+			want:   TrendParams{Classifier: defaultTrendClassifier, LongTermThresholdDays: 5, MaxContinuationDays: 11},
+		},
+		"all": {
+			params: TrendParams{Classifier: "adx", LongTermThresholdDays: 3, MaxContinuationDays: 20},
+			want:   TrendParams{Classifier: "adx", LongTermThresholdDays: 3, MaxContinuationDays: 20},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.params.withDefaults(); got != tc.want {
+				t.Errorf("got: %#v, want: %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTrendParamsVersion(t *testing.T) {
+	v := defaultTrendParams.version()
+	if len(v) != 12 {
+		t.Errorf("got version: %s, want 12 characters", v)
+	}
+	if got := defaultTrendParams.withDefaults().version(); got != v {
+		t.Errorf("same params got different version: %s, %s", got, v)
+	}
+
+	changed := defaultTrendParams
+	changed.MaxContinuationDays = 20
+	if changed.version() == v {
+		t.Errorf("different params got same version: %s", v)
+	}
+}
+
+func TestCalcContinuationDaysWithMax(t *testing.T) {
+	closes := []float64{100, 99, 98, 97, 96, 95, 94, 93}
+	tests := map[string]struct {
+		maxContinuationDays int
+		want                int
+	}{
+		"max_3": {
+			maxContinuationDays: 3,
+			want:                3,
+		},
+		"max_11": {
+			maxContinuationDays: 11,
+			want:                7,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := calcContinuationDays(closes, tc.maxContinuationDays); got != tc.want {
+				t.Errorf("got: %d, want: %d", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ludwig125/gke-stockprice/sheet"
+)
+
+// growthRateの上位、下位のタブに書き込む銘柄数
+const growthRateTabCodes = 20
+
+// 当日のtrendから抜き出して、全銘柄のタブとは別のタブに書き込むもの
+var trendSummaryTabs = []struct {
+	name    string
+	extract func(ctl []codeDateTrendList) []codeDateTrendList
+}{
+	{
+		name: "trendturns", // 当日にtrendが転換した銘柄
+		extract: func(ctl []codeDateTrendList) []codeDateTrendList {
+			return makeSortedTrendList(filterTrendList(ctl, func(c codeDateTrendList) bool {
+				return c.trendTurn == upwardTurn || c.trendTurn == downwardTurn
+			}))
+		},
+	},
+	{
+		name: "upwardcross", // 当日に終値が5日移動平均線を上に抜けた銘柄
+		extract: func(ctl []codeDateTrendList) []codeDateTrendList {
+			return makeSortedTrendList(filterTrendList(ctl, func(c codeDateTrendList) bool {
+				return c.crossMoving5 == upwardCross
+			}))
+		},
+	},
+	{
+		name: "growth_top",
+		extract: func(ctl []codeDateTrendList) []codeDateTrendList {
+			return topGrowthRate(ctl, growthRateTabCodes, true)
+		},
+	},
+	{
+		name: "growth_bottom",
+		extract: func(ctl []codeDateTrendList) []codeDateTrendList {
+			return topGrowthRate(ctl, growthRateTabCodes, false)
+		},
+	},
+}
+
+func filterTrendList(ctl []codeDateTrendList, f func(c codeDateTrendList) bool) []codeDateTrendList {
+	var filtered []codeDateTrendList
+	for _, c := range ctl {
+		if f(c) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+// makeTrendDataForSheetと同じ並び順にする
+func makeSortedTrendList(ctl []codeDateTrendList) []codeDateTrendList {
+	sort.SliceStable(ctl, func(i, j int) bool { return ctl[i].growthRate > ctl[j].growthRate })
+	sort.SliceStable(ctl, func(i, j int) bool { return ctl[i].trend > ctl[j].trend })
+	return ctl
+}
+
+// descがtrueならgrowthRateの大きい順、falseなら小さい順にn件返す
+func topGrowthRate(ctl []codeDateTrendList, n int, desc bool) []codeDateTrendList {
+	sorted := append([]codeDateTrendList{}, ctl...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].growthRate != sorted[j].growthRate {
+			if desc {
+				return sorted[i].growthRate > sorted[j].growthRate
+			}
+			return sorted[i].growthRate < sorted[j].growthRate
+		}
+		return sorted[i].code < sorted[j].code
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+var (
+	advanceColor       = &sheet.Color{Red: 0.72, Green: 0.88, Blue: 0.8}
+	strongAdvanceColor = &sheet.Color{Red: 0.34, Green: 0.73, Blue: 0.54}
+	declineColor       = &sheet.Color{Red: 0.96, Green: 0.8, Blue: 0.8}
+	strongDeclineColor = &sheet.Color{Red: 0.9, Green: 0.49, Blue: 0.45}
+)
+
+// trendのタブの書式
+// 列番号はsheetColumnNameの順番から決める
+func trendSheetFormat() sheet.Format {
+	columns := make(map[string]int64)
+	for i, name := range sheetColumnName() {
+		columns[name] = int64(i)
+	}
+	f := sheet.Format{
+		FrozenRows: 1,
+		BoldHeader: true,
+		NumberFormats: []sheet.NumberFormat{
+			{Column: columns["growthRate"], Pattern: "0.000"},
+		},
+		TextRules: []sheet.TextRule{
+			{Column: columns["trend"], Text: longTermAdvance.String(), Background: strongAdvanceColor},
+			{Column: columns["trend"], Text: shortTermAdvance.String(), Background: advanceColor},
+			{Column: columns["trend"], Text: shortTermDecline.String(), Background: declineColor},
+			{Column: columns["trend"], Text: longTermDecline.String(), Background: strongDeclineColor},
+			{Column: columns["trendTurn"], Text: upwardTurn.String(), Bold: true},
+			{Column: columns["trendTurn"], Text: downwardTurn.String(), Bold: true},
+		},
+	}
+	for _, m := range rankingMetrics {
+		f.NumberFormats = append(f.NumberFormats, sheet.NumberFormat{Column: columns[m+"Rank"], Pattern: "0"})
+	}
+	return f
+}
+
+// 書式を設定できないSheet(テスト用のmockなど)の場合は何もしない
+func formatTrendSheet(sh sheet.Sheet) error {
+	f, ok := sh.(sheet.Formatter)
+	if !ok {
+		return nil
+	}
+	if err := f.Format(trendSheetFormat()); err != nil {
+		return fmt.Errorf("failed to Format: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// +build !integration
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTrendSummaryTabs(t *testing.T) {
+	ctl := []codeDateTrendList{
+		{code: "1001", trend: longTermAdvance, trendTurn: upwardTurn, crossMoving5: upwardCross, growthRate: 1.05},
+		{code: "1002", trend: non, trendTurn: noTurn, crossMoving5: noCross, growthRate: 0.97},
+		{code: "1003", trend: shortTermDecline, trendTurn: downwardTurn, crossMoving5: downwardCross, growthRate: 0.99},
+		{code: "1004", trend: shortTermAdvance, trendTurn: noTurn, crossMoving5: upwardCross, growthRate: 1.02},
+	}
+	want := map[string][]string{
+		"trendturns":    {"1001", "1003"},
+		"upwardcross":   {"1001", "1004"},
+		"growth_top":    {"1001", "1004", "1003", "1002"},
+		"growth_bottom": {"1002", "1003", "1004", "1001"},
+	}
+	for _, tab := range trendSummaryTabs {
+		t.Run(tab.name, func(t *testing.T) {
+			var got []string
+			for _, c := range tab.extract(append([]codeDateTrendList{}, ctl...)) {
+				got = append(got, c.code)
+			}
+			if !reflect.DeepEqual(got, want[tab.name]) {
+				t.Errorf("got: %v, want: %v", got, want[tab.name])
+			}
+		})
+	}
+}
+
+func TestTopGrowthRate(t *testing.T) {
+	ctl := []codeDateTrendList{{code: "1001", growthRate: 1.0}, {code: "1002", growthRate: 1.2}, {code: "1003", growthRate: 1.0}}
+	var got []string
+	for _, c := range topGrowthRate(ctl, 2, true) {
+		got = append(got, c.code)
+	}
+	if want := []string{"1002", "1001"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+	if ctl[0].code != "1001" { // 元のSliceは並び替えない
+		t.Errorf("ctl is sorted: %v", ctl)
+	}
+}
+
+func TestTrendSheetFormat(t *testing.T) {
+	f := trendSheetFormat()
+	columns := sheetColumnName()
+	for _, r := range f.TextRules {
+		if name := columns[r.Column]; name != "trend" && name != "trendTurn" {
+			t.Errorf("text rule %s is set to column %s", r.Text, name)
+		}
+	}
+	for _, n := range f.NumberFormats {
+		if name := columns[n.Column]; name != "growthRate" && name[len(name)-4:] != "Rank" {
+			t.Errorf("number format %s is set to column %s", n.Pattern, name)
+		}
+	}
+	// Formatterでない場合は何もしない
+	if err := formatTrendSheet(nil); err != nil {
+		t.Errorf("failed to formatTrendSheet: %v", err)
+	}
+}
@@ -158,9 +158,160 @@ func TestCalcContinuationDays(t *testing.T) {
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			if got := calcContinuationDays(tc.closes); got != tc.want {
+			if got := calcContinuationDays(tc.closes, defaultTrendParams.MaxContinuationDays); got != tc.want {
 				t.Errorf("got: %d, want: %d", got, tc.want)
 			}
 		})
 	}
 }
+
+func TestGeneralTrend(t *testing.T) {
+	tests := map[string]struct {
+		trend        Trend
+		trendTurn    TrendTurnType
+		growthRate   float64
+		crossMoving5 CrossMoving5Type
+		want         GeneralTrend
+	}{
+		"veryStrongBuy": {
+			trend:        shortTermAdvance,
+			trendTurn:    upwardTurn,
+			growthRate:   1.05,
+			crossMoving5: upwardCross,
+			want:         veryStrongBuy,
+		},
+		"strongBuy": {
+			trend:        longTermAdvance,
+			trendTurn:    noTurn,
+			growthRate:   1.05,
+			crossMoving5: upwardCross,
+			want:         strongBuy,
+		},
+		"buy": {
+			trend:        longTermAdvance,
+			trendTurn:    upwardTurn,
+			growthRate:   1.01,
+			crossMoving5: noCross,
+			want:         buy,
+		},
+		"weakBuy_cross": {
+			trend:        non,
+			trendTurn:    noTurn,
+			growthRate:   1.05,
+			crossMoving5: upwardCross,
+			want:         weakBuy,
+		},
+		"weakBuy_turn": {
+			trend:        non,
+			trendTurn:    upwardTurn,
+			growthRate:   0.99,
+			crossMoving5: noCross,
+			want:         weakBuy,
+		},
+		"weakBuy_decline_cross": {
+			trend:        shortTermDecline,
+			trendTurn:    noTurn,
+			growthRate:   1.05,
+			crossMoving5: upwardCross,
+			want:         weakBuy,
+		},
+		"weakBuy_decline_turn": {
+			trend:        shortTermDecline, // longTermDeclineからの転換
+			trendTurn:    upwardTurn,
+			growthRate:   0.99,
+			crossMoving5: noCross,
+			want:         weakBuy,
+		},
+		"strongSell_decline_turn": {
+			trend:        shortTermDecline,
+			trendTurn:    upwardTurn,
+			growthRate:   0.95,
+			crossMoving5: downwardCross,
+			want:         strongSell,
+		},
+		"weakSell_advance_cross": {
+			trend:        longTermAdvance,
+			trendTurn:    noTurn,
+			growthRate:   0.95,
+			crossMoving5: downwardCross,
+			want:         weakSell,
+		},
+		"weakSell_advance_turn": {
+			trend:        shortTermAdvance, // longTermAdvanceからの転換
+			trendTurn:    downwardTurn,
+			growthRate:   1.01,
+			crossMoving5: noCross,
+			want:         weakSell,
+		},
+		"strongBuy_advance_turn": {
+			trend:        shortTermAdvance,
+			trendTurn:    downwardTurn,
+			growthRate:   1.05,
+			crossMoving5: upwardCross,
+			want:         strongBuy,
+		},
+		"neutral": {
+			trend:        non,
+			trendTurn:    noTurn,
+			growthRate:   1.01,
+			crossMoving5: noCross,
+			want:         neutral,
+		},
+		"neutral_both_signals": {
+			trend:        non,
+			trendTurn:    upwardTurn,
+			growthRate:   0.95,
+			crossMoving5: downwardCross,
+			want:         neutral,
+		},
+		"weakSell_cross": {
+			trend:        non,
+			trendTurn:    noTurn,
+			growthRate:   0.95,
+			crossMoving5: downwardCross,
+			want:         weakSell,
+		},
+		"weakSell_turn": {
+			trend:        non,
+			trendTurn:    downwardTurn,
+			growthRate:   1.01,
+			crossMoving5: noCross,
+			want:         weakSell,
+		},
+		"sell": {
+			trend:        longTermDecline,
+			trendTurn:    downwardTurn,
+			growthRate:   0.99,
+			crossMoving5: noCross,
+			want:         sell,
+		},
+		"strongSell": {
+			trend:        longTermDecline,
+			trendTurn:    noTurn,
+			growthRate:   0.95,
+			crossMoving5: downwardCross,
+			want:         strongSell,
+		},
+		"veryStrongSell": {
+			trend:        shortTermDecline,
+			trendTurn:    downwardTurn,
+			growthRate:   0.95,
+			crossMoving5: downwardCross,
+			want:         veryStrongSell,
+		},
+		"unknown": {
+			trend:        unknown,
+			trendTurn:    unknownTurn,
+			growthRate:   0,
+			crossMoving5: noCross,
+			want:         unknownGeneralTrend,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := generalTrend(tc.trend, tc.trendTurn, tc.growthRate, tc.crossMoving5); got != tc.want {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
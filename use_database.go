@@ -89,11 +89,79 @@ func fetchCodesDateCloses(db database.DB, dailyTable string, targetCodes []strin
 	return codeDateCloses, nil
 }
 
+// 始値、高値、安値、終値、売買高を銘柄ごとに日付の降順で取得する
+// 全銘柄のデータがなければエラーを返す
+func fetchCodesDateBars(db database.DB, dailyTable string, targetCodes []string, fromDate, toDate, limit string) (map[string][]DateBar, error) {
+	codeDateBars, err := selectCodesDateBars(db, dailyTable, targetCodes, fromDate, toDate, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(codeDateBars) == 0 {
+		return nil, fmt.Errorf("no selected data. table: %s, codes: %d, %s %s", dailyTable, len(targetCodes), fromDate, toDate)
+	}
+	if len(codeDateBars) != len(targetCodes) {
+		return nil, fmt.Errorf("unmatch codes. result codes: %d, targetCodes: %d", len(codeDateBars), len(targetCodes))
+	}
+	return codeDateBars, nil
+}
+
+// fetchCodesDateBarsと同じだが、期間内にデータのない銘柄(上場前や上場廃止後など)は返り値に含めず、エラーにもしない
+func selectCodesDateBars(db database.DB, dailyTable string, targetCodes []string, fromDate, toDate, limit string) (map[string][]DateBar, error) {
+	codes := joinCodeForWhereInStatement(targetCodes)
+
+	q := fmt.Sprintf("SELECT code, date, open, high, low, close, turnover FROM %s WHERE code in (%s) %s %s ORDER BY code, date DESC %s;", dailyTable, codes, fromDate, toDate, limit)
+	res, err := db.SelectDB(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to selectTable %v", err)
+	}
+	if len(res) == 0 {
+		return map[string][]DateBar{}, nil
+	}
+
+	codeDateBars := make(map[string][]DateBar, len(targetCodes))
+	var dbs []DateBar
+
+	// fetchCodesDateClosesと同様にcurrentCodeで銘柄の切り替わりを判断する
+	currentCode := ""
+	prev := [5]float64{1, 1, 1, 1, 1} // open, high, low, close, turnoverの一つ前の値。default 0だと0除算になってしまうので1とした
+	for i, r := range res {
+		code := r[0]
+		if i == 0 {
+			currentCode = code
+		} else if currentCode != code {
+			codeDateBars[currentCode] = dbs
+			dbs = nil
+			currentCode = code
+			prev = [5]float64{1, 1, 1, 1, 1} // codeが変わったので1に戻す
+		}
+		date := r[1]
+
+		var prices [5]float64
+		for j, p := range r[2:7] {
+			if p == "--" { // スクレイピングした時に`--`で格納されていることがあったので、この場合は一つ前の値にする
+				prices[j] = prev[j]
+				log.Printf("Warning. price is '--'. Use previous price: %v alternatively. code: %s, date: %s", prev[j], code, date)
+				continue
+			}
+			f, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to ParseFloat. %v. code: %s, date: %s", err, code, date)
+			}
+			prices[j] = f
+		}
+		prev = prices
+
+		dbs = append(dbs, DateBar{Date: date, Open: prices[0], High: prices[1], Low: prices[2], Close: prices[3], Turnover: prices[4]})
+	}
+	codeDateBars[currentCode] = dbs // 最後のcode分を格納
+	return codeDateBars, nil
+}
+
 // TrendListを取得する
 func fetchTrendList(db database.DB, trendTable string, targetCodes []string, date string) (map[string]TrendList, error) {
 	codes := joinCodeForWhereInStatement(targetCodes)
 
-	q := fmt.Sprintf("SELECT code, trend, trendTurn, growthRate, crossMoving5, continuationDays FROM trend WHERE code in (%s) AND date = '%s';", codes, date)
+	q := fmt.Sprintf("SELECT code, trend, trendTurn, growthRate, crossMoving5, continuationDays, generalTrend FROM trend WHERE code in (%s) AND date = '%s';", codes, date)
 	res, err := db.SelectDB(q)
 	if err != nil {
 		return nil, fmt.Errorf("failed to selectTable %v, query: %s", err, q)
@@ -126,6 +194,10 @@ func fetchTrendList(db database.DB, trendTable string, targetCodes []string, dat
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert string continuationDays to int: %v", err)
 		}
+		generalTrend, err := strconv.Atoi(r[6])
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert string generalTrend to int: %v", err)
+		}
 
 		codeTrends[code] = TrendList{
 			trend:            Trend(trend),
@@ -133,6 +205,7 @@ func fetchTrendList(db database.DB, trendTable string, targetCodes []string, dat
 			growthRate:       float64(growthRate),
 			crossMoving5:     CrossMoving5Type(crossMoving5),
 			continuationDays: continuationDays,
+			generalTrend:     GeneralTrend(generalTrend),
 		}
 	}
 
@@ -141,3 +214,104 @@ func fetchTrendList(db database.DB, trendTable string, targetCodes []string, dat
 	}
 	return codeTrends, nil
 }
+
+// 指定した日付に売買高が急増している銘柄を取得する
+func fetchVolumeSpikes(db database.DB, volumeTable string, targetCodes []string, date string) (map[string]bool, error) {
+	codes := joinCodeForWhereInStatement(targetCodes)
+
+	q := fmt.Sprintf("SELECT code, volumeSpike FROM %s WHERE code in (%s) AND date = '%s';", volumeTable, codes, date)
+	res, err := db.SelectDB(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to selectTable %v, query: %s", err, q)
+	}
+
+	codeSpikes := make(map[string]bool, len(targetCodes))
+	for _, r := range res {
+		codeSpikes[r[0]] = r[1] == "1"
+	}
+	return codeSpikes, nil
+}
+
+func fetchCrossoverEvents(db database.DB, crossoverTable string, targetCodes []string, date string) (map[string][]CrossoverEvent, error) {
+	codes := joinCodeForWhereInStatement(targetCodes)
+
+	q := fmt.Sprintf("SELECT code, pair, crossover FROM %s WHERE code in (%s) AND date = '%s' ORDER BY code, pair;", crossoverTable, codes, date)
+	res, err := db.SelectDB(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to selectTable %v, query: %s", err, q)
+	}
+
+	codeEvents := make(map[string][]CrossoverEvent)
+	for _, r := range res {
+		sl := strings.Split(r[1], "/")
+		if len(sl) != 2 {
+			return nil, fmt.Errorf("invalid pair: %s, code: %s", r[1], r[0])
+		}
+		crossover, err := strconv.Atoi(r[2])
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert crossover to int: %v, code: %s", err, r[0])
+		}
+		codeEvents[r[0]] = append(codeEvents[r[0]], CrossoverEvent{
+			Date:      date,
+			Pair:      MovingAvgPair{Short: sl[0], Long: sl[1]},
+			Crossover: CrossoverType(crossover),
+		})
+	}
+	return codeEvents, nil
+}
+
+// 指定した日付のcolumnsの値を銘柄ごとに返す
+// 数値に変換できない値は含めない
+func fetchCodeValues(db database.DB, table string, columns []string, targetCodes []string, date string) (map[string]map[string]float64, error) {
+	codes := joinCodeForWhereInStatement(targetCodes)
+
+	q := fmt.Sprintf("SELECT code, %s FROM %s WHERE code in (%s) AND date = '%s';", strings.Join(columns, ", "), table, codes, date)
+	res, err := db.SelectDB(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to selectTable %v, query: %s", err, q)
+	}
+
+	codeValues := make(map[string]map[string]float64, len(res))
+	for _, r := range res {
+		values := make(map[string]float64, len(columns))
+		for i, c := range columns {
+			v, err := strconv.ParseFloat(r[i+1], 64)
+			if err != nil {
+				continue
+			}
+			values[c] = v
+		}
+		codeValues[r[0]] = values
+	}
+	return codeValues, nil
+}
+
+// 指定した期間のcolumnsの値を銘柄、日付ごとに返す
+// 数値に変換できない値は含めない
+func fetchCodeDateValues(db database.DB, table string, columns []string, targetCodes []string, fromDate, toDate string) (map[string]map[string]map[string]float64, error) {
+	codes := joinCodeForWhereInStatement(targetCodes)
+
+	q := fmt.Sprintf("SELECT code, date, %s FROM %s WHERE code in (%s) AND date >= '%s' AND date <= '%s';", strings.Join(columns, ", "), table, codes, fromDate, toDate)
+	res, err := db.SelectDB(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to selectTable %v, query: %s", err, q)
+	}
+
+	codeDateValues := make(map[string]map[string]map[string]float64, len(targetCodes))
+	for _, r := range res {
+		code, date := r[0], r[1]
+		values := make(map[string]float64, len(columns))
+		for i, c := range columns {
+			v, err := strconv.ParseFloat(r[i+2], 64)
+			if err != nil {
+				continue
+			}
+			values[c] = v
+		}
+		if _, ok := codeDateValues[code]; !ok {
+			codeDateValues[code] = make(map[string]map[string]float64)
+		}
+		codeDateValues[code][date] = values
+	}
+	return codeDateValues, nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	bollingerDays       = 20  // ボリンジャーバンドの期間
+	bollingerSigma      = 2   // ボリンジャーバンドの幅(±2σ)
+	atrDays             = 14  // ATRの期間
+	historicalVolDays   = 20  // ヒストリカルボラティリティの期間
+	tradingDaysPerYear  = 250 // ヒストリカルボラティリティを年率換算するための年間営業日数
+	squeezeLookbackDays = 60  // この期間でbandwidthが最小のときにsqueezeとみなす
+)
+
+// CodeDateVolatilities maps code and multiple DateVolatility.
+type CodeDateVolatilities map[string][]DateVolatility
+
+// Slices converts CodeDateVolatilities to double string slice.
+func (c CodeDateVolatilities) Slices() [][]string {
+	var volatilityData [][]string
+	for code, dateVolatilities := range c {
+		for _, dateVolatility := range dateVolatilities {
+			volatilityData = append(volatilityData, codeDateVolatilityToStringSlice(code, dateVolatility))
+		}
+	}
+	return volatilityData
+}
+
+func codeDateVolatilityToStringSlice(code string, dateVolatility DateVolatility) []string {
+	trim := func(f float64) string {
+		return fmt.Sprintf("%g", f)
+	}
+	v := dateVolatility.Volatility
+	squeeze := "0"
+	if v.Squeeze {
+		squeeze = "1"
+	}
+	return []string{
+		code,
+		dateVolatility.Date,
+		trim(v.BollingerUpper),
+		trim(v.BollingerMiddle),
+		trim(v.BollingerLower),
+		trim(v.PercentB),
+		trim(v.Bandwidth),
+		trim(v.ATR),
+		trim(v.HistoricalVolatility),
+		squeeze,
+		fmt.Sprintf("%d", v.BandBreakout),
+	}
+}
+
+// DateVolatility has date and Volatility.
+type DateVolatility struct {
+	Date       string
+	Volatility Volatility
+}
+
+// Volatility has bollinger bands, ATR and historical volatility.
+type Volatility struct {
+	BollingerUpper       float64 // +2σ
+	BollingerMiddle      float64 // 20日移動平均
+	BollingerLower       float64 // -2σ
+	PercentB             float64 // 終値がバンドのどこにあるか(0: lower, 1: upper)
+	Bandwidth            float64 // (upper - lower) / middle
+	ATR                  float64 // Average True Range
+	HistoricalVolatility float64 // 終値の対数収益率の標準偏差(年率)
+	Squeeze              bool    // bandwidthが直近squeezeLookbackDaysの中で最小
+	BandBreakout         BandBreakoutType
+}
+
+// BandBreakoutType is type of breakout from bollinger bands.
+type BandBreakoutType int
+
+// 3: upwardBreakout : close > upper
+// 2: noBreakout
+// 1: downwardBreakout : close < lower
+// 0: unknownBreakout
+
+const (
+	unknownBreakout BandBreakoutType = iota
+	downwardBreakout
+	noBreakout
+	upwardBreakout
+)
+
+// constのString変換メソッド
+func (b BandBreakoutType) String() string {
+	return [4]string{"unknownBreakout", "downwardBreakout", "noBreakout", "upwardBreakout"}[b]
+}
+
+func calculateCodeDateVolatilities(codeDateBars map[string][]DateBar) map[string][]DateVolatility {
+	cdvs := make(map[string][]DateVolatility, len(codeDateBars))
+	for code, dateBars := range codeDateBars {
+		cdvs[code] = calculateVolatility(dateBars)
+	}
+	return cdvs
+}
+
+// dateBarsは日付の降順で与えられる
+func calculateVolatility(dateBars []DateBar) []DateVolatility {
+	bars := DateBars(dateBars)
+	closes := DateCloses(bars.dateCloses()).closes()
+	trs := bars.trueRanges()
+
+	dateVolatilities := make([]DateVolatility, 0, len(bars))
+	bandwidths := make([]float64, 0, len(bars))
+	for i, b := range bars {
+		upper, middle, lower := bollingerBands(window(closes, i, bollingerDays))
+		v := Volatility{
+			BollingerUpper:       upper,
+			BollingerMiddle:      middle,
+			BollingerLower:       lower,
+			PercentB:             percentB(b.Close, upper, lower),
+			Bandwidth:            bandwidth(upper, middle, lower),
+			ATR:                  average(window(trs, i, atrDays)),
+			HistoricalVolatility: historicalVolatility(window(closes, i, historicalVolDays+1)), // 収益率をhistoricalVolDays個とるために+1
+			BandBreakout:         bandBreakoutType(b.Close, upper, lower),
+		}
+		dateVolatilities = append(dateVolatilities, DateVolatility{Date: b.Date, Volatility: v})
+		bandwidths = append(bandwidths, v.Bandwidth)
+	}
+
+	for i := range dateVolatilities {
+		dateVolatilities[i].Volatility.Squeeze = isSqueeze(bandwidths, i)
+	}
+	return dateVolatilities
+}
+
+// 日付の降順のSliceからi番目を先頭にdays個分を返す
+// 残りの要素数がdaysに足りない場合は残り全部を返す
+func window(fs []float64, i, days int) []float64 {
+	end := i + days
+	if end > len(fs) {
+		end = len(fs)
+	}
+	return fs[i:end]
+}
+
+func average(fs []float64) float64 {
+	if len(fs) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, f := range fs {
+		sum += f
+	}
+	return sum / float64(len(fs))
+}
+
+// 母集団の標準偏差
+func stddev(fs []float64) float64 {
+	if len(fs) == 0 {
+		return 0
+	}
+	avg := average(fs)
+	var sum float64
+	for _, f := range fs {
+		sum += (f - avg) * (f - avg)
+	}
+	return math.Sqrt(sum / float64(len(fs)))
+}
+
+func bollingerBands(closes []float64) (upper, middle, lower float64) {
+	middle = average(closes)
+	sigma := stddev(closes)
+	return middle + bollingerSigma*sigma, middle, middle - bollingerSigma*sigma
+}
+
+// バンド幅がゼロのときは真ん中の0.5を返す
+func percentB(close, upper, lower float64) float64 {
+	if upper == lower {
+		return 0.5
+	}
+	return (close - lower) / (upper - lower)
+}
+
+func bandwidth(upper, middle, lower float64) float64 {
+	if middle == 0 {
+		return 0
+	}
+	return (upper - lower) / middle
+}
+
+func bandBreakoutType(close, upper, lower float64) BandBreakoutType {
+	if close > upper {
+		return upwardBreakout
+	}
+	if close < lower {
+		return downwardBreakout
+	}
+	return noBreakout
+}
+
+// i番目のbandwidthが直近squeezeLookbackDaysの中で最小ならsqueezeとする
+// 比較対象がsqueezeLookbackDaysに満たない場合は判断しない
+func isSqueeze(bandwidths []float64, i int) bool {
+	if i+squeezeLookbackDays > len(bandwidths) {
+		return false
+	}
+	for _, b := range bandwidths[i+1 : i+squeezeLookbackDays] {
+		if b < bandwidths[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 日付の降順のTrue Range
+// 最も古い日は前日の終値がないので高値-安値とする
+func (d DateBars) trueRanges() []float64 {
+	trs := make([]float64, len(d))
+	for i, b := range d {
+		tr := b.High - b.Low
+		if i+1 < len(d) {
+			prevClose := d[i+1].Close
+			tr = math.Max(tr, math.Max(math.Abs(b.High-prevClose), math.Abs(b.Low-prevClose)))
+		}
+		trs[i] = tr
+	}
+	return trs
+}
+
+// 日付の降順の終値から対数収益率の標準偏差(不偏)を年率換算して返す
+func historicalVolatility(closes []float64) float64 {
+	var returns []float64
+	for i := 0; i+1 < len(closes); i++ {
+		if closes[i] <= 0 || closes[i+1] <= 0 {
+			continue
+		}
+		returns = append(returns, math.Log(closes[i]/closes[i+1]))
+	}
+	if len(returns) < 2 {
+		return 0
+	}
+	avg := average(returns)
+	var sum float64
+	for _, r := range returns {
+		sum += (r - avg) * (r - avg)
+	}
+	return math.Sqrt(sum/float64(len(returns)-1)) * math.Sqrt(tradingDaysPerYear)
+}
@@ -0,0 +1,154 @@
+// +build !integration
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestCalculateVolatility(t *testing.T) {
+	tests := map[string]struct {
+		dateBars []DateBar
+		want     []Volatility
+	}{
+		"flat": {
+			dateBars: []DateBar{
+				{Date: "2020/12/20", Open: 10, High: 10, Low: 10, Close: 10},
+				{Date: "2020/12/19", Open: 10, High: 10, Low: 10, Close: 10},
+			},
+			want: []Volatility{
+				{BollingerUpper: 10, BollingerMiddle: 10, BollingerLower: 10, PercentB: 0.5, BandBreakout: noBreakout},
+				{BollingerUpper: 10, BollingerMiddle: 10, BollingerLower: 10, PercentB: 0.5, BandBreakout: noBreakout},
+			},
+		},
+		"gap_up": {
+			dateBars: []DateBar{
+				{Date: "2020/12/20", Open: 14, High: 15, Low: 14, Close: 14.5},
+				{Date: "2020/12/19", Open: 10, High: 11, Low: 9, Close: 10},
+			},
+			want: []Volatility{
+				{
+					BollingerUpper:  12.25 + 2*2.25,
+					BollingerMiddle: 12.25,
+					BollingerLower:  12.25 - 2*2.25,
+					PercentB:        (14.5 - (12.25 - 2*2.25)) / (4 * 2.25),
+					Bandwidth:       4 * 2.25 / 12.25,
+					ATR:             3.5, // (5 + 2) / 2
+					BandBreakout:    noBreakout,
+				},
+				{BollingerUpper: 10, BollingerMiddle: 10, BollingerLower: 10, PercentB: 0.5, ATR: 2, BandBreakout: noBreakout},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := calculateVolatility(tc.dateBars)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got: %d, want: %d", len(got), len(tc.want))
+			}
+			for i, g := range got {
+				if g.Date != tc.dateBars[i].Date {
+					t.Errorf("got date: %s, want: %s", g.Date, tc.dateBars[i].Date)
+				}
+				v, w := g.Volatility, tc.want[i]
+				if !almostEqual(v.BollingerUpper, w.BollingerUpper) ||
+					!almostEqual(v.BollingerMiddle, w.BollingerMiddle) ||
+					!almostEqual(v.BollingerLower, w.BollingerLower) ||
+					!almostEqual(v.PercentB, w.PercentB) ||
+					!almostEqual(v.Bandwidth, w.Bandwidth) ||
+					!almostEqual(v.ATR, w.ATR) ||
+					v.BandBreakout != w.BandBreakout {
+					t.Errorf("%s got: %#v, want: %#v", g.Date, v, w)
+				}
+			}
+		})
+	}
+}
+
+func TestHistoricalVolatility(t *testing.T) {
+	tests := map[string]struct {
+		closes []float64
+		want   float64
+	}{
+		"not_enough": {
+			closes: []float64{100, 110},
+			want:   0,
+		},
+		"flat": {
+			closes: []float64{100, 100, 100},
+			want:   0,
+		},
+		"up_and_down": {
+			closes: []float64{110, 100, 110},
+			want:   math.Sqrt(2) * math.Log(1.1) * math.Sqrt(tradingDaysPerYear),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := historicalVolatility(tc.closes); !almostEqual(got, tc.want) {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBandBreakoutType(t *testing.T) {
+	tests := map[string]struct {
+		close float64
+		want  BandBreakoutType
+	}{
+		"upward":   {close: 121, want: upwardBreakout},
+		"upper":    {close: 120, want: noBreakout},
+		"inside":   {close: 100, want: noBreakout},
+		"lower":    {close: 80, want: noBreakout},
+		"downward": {close: 79, want: downwardBreakout},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := bandBreakoutType(tc.close, 120, 80); got != tc.want {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsSqueeze(t *testing.T) {
+	// 日付の降順のbandwidth
+	bandwidths := make([]float64, squeezeLookbackDays+1)
+	for i := range bandwidths {
+		bandwidths[i] = 0.1 + float64(i)*0.01 // 直近ほど小さい
+	}
+	tests := map[string]struct {
+		bandwidths []float64
+		i          int
+		want       bool
+	}{
+		"latest_is_smallest": {
+			bandwidths: bandwidths,
+			i:          0,
+			want:       true,
+		},
+		"not_smallest": {
+			bandwidths: append([]float64{0.5}, bandwidths...),
+			i:          0,
+			want:       false,
+		},
+		"not_enough_lookback": {
+			bandwidths: bandwidths,
+			i:          2,
+			want:       false,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := isSqueeze(tc.bandwidths, tc.i); got != tc.want {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
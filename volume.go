@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	volumeShortDays   = 5              // 売買高の短期移動平均の期間
+	volumeLongDays    = 20             // 売買高の長期移動平均の期間。volumeRatioとz-scoreの比較対象もこの期間
+	volumeSpikeZScore = 2              // z-scoreがこの値以上であれば売買高の急増とみなす
+	volumeMinSamples  = volumeLongDays // z-scoreを計算するのに必要な前日までの日数
+)
+
+// CodeDateVolumes maps code and multiple DateVolume.
+type CodeDateVolumes map[string][]DateVolume
+
+// Slices converts CodeDateVolumes to double string slice.
+func (c CodeDateVolumes) Slices() [][]string {
+	var volumeData [][]string
+	for code, dateVolumes := range c {
+		for _, dateVolume := range dateVolumes {
+			volumeData = append(volumeData, codeDateVolumeToStringSlice(code, dateVolume))
+		}
+	}
+	return volumeData
+}
+
+func codeDateVolumeToStringSlice(code string, dateVolume DateVolume) []string {
+	trim := func(f float64) string {
+		return fmt.Sprintf("%g", f)
+	}
+	v := dateVolume.Volume
+	spike := "0"
+	if v.Spike {
+		spike = "1"
+	}
+	return []string{
+		code,
+		dateVolume.Date,
+		trim(v.MovingAvgShort),
+		trim(v.MovingAvgLong),
+		trim(v.OBV),
+		trim(v.Ratio),
+		trim(v.ZScore),
+		spike,
+	}
+}
+
+// DateVolume has date and Volume.
+type DateVolume struct {
+	Date   string
+	Volume Volume
+}
+
+// Volume has volume analytics calculated from turnover.
+type Volume struct {
+	MovingAvgShort float64 // 売買高の5日移動平均
+	MovingAvgLong  float64 // 売買高の20日移動平均
+	OBV            float64 // On-Balance Volume。前回までに格納したOBVに累積する
+	Ratio          float64 // 当日の売買高 / 前日までの20日平均
+	ZScore         float64 // 前日までの20日間に対する当日の売買高のz-score
+	Spike          bool    // ZScoreがvolumeSpikeZScore以上
+}
+
+// obvSeedsは銘柄ごとの期間の最も古い日のOBV。ない銘柄は0から累積する
+func calculateCodeDateVolumes(codeDateBars map[string][]DateBar, obvSeeds map[string]float64) map[string][]DateVolume {
+	cdvs := make(map[string][]DateVolume, len(codeDateBars))
+	for code, dateBars := range codeDateBars {
+		cdvs[code] = calculateVolume(dateBars, obvSeeds[code])
+	}
+	return cdvs
+}
+
+// dateBarsは日付の降順で与えられる
+func calculateVolume(dateBars []DateBar, obvSeed float64) []DateVolume {
+	bars := DateBars(dateBars)
+	turnovers := bars.turnovers()
+	obvs := bars.onBalanceVolumes(obvSeed)
+
+	dateVolumes := make([]DateVolume, 0, len(bars))
+	for i, b := range bars {
+		// 当日の急増で比較対象が引っ張られないように、ratioとz-scoreは前日までの期間と比べる
+		prev := window(turnovers, i+1, volumeLongDays)
+		v := Volume{
+			MovingAvgShort: average(window(turnovers, i, volumeShortDays)),
+			MovingAvgLong:  average(window(turnovers, i, volumeLongDays)),
+			OBV:            obvs[i],
+			Ratio:          volumeRatio(b.Turnover, prev),
+			ZScore:         zScore(b.Turnover, prev),
+		}
+		v.Spike = v.ZScore >= volumeSpikeZScore
+		dateVolumes = append(dateVolumes, DateVolume{Date: b.Date, Volume: v})
+	}
+	return dateVolumes
+}
+
+func (d DateBars) turnovers() []float64 {
+	turnovers := make([]float64, len(d))
+	for i, v := range d {
+		turnovers[i] = v.Turnover
+	}
+	return turnovers
+}
+
+// 日付の降順のOn-Balance Volume
+// 最も古い日をseedとして、終値が前日より上がった日は売買高を足し、下がった日は引く
+// 期間をずらして再計算しても同じ日のOBVが変わらないように、seedには格納済みのOBVを使う
+func (d DateBars) onBalanceVolumes(seed float64) []float64 {
+	obvs := make([]float64, len(d))
+	if len(d) > 0 {
+		obvs[len(d)-1] = seed
+	}
+	for i := len(d) - 2; i >= 0; i-- {
+		obvs[i] = nextOBV(obvs[i+1], d[i+1], d[i])
+	}
+	return obvs
+}
+
+// 前日のOBVと足から当日のOBVを返す
+func nextOBV(prevOBV float64, prev, cur DateBar) float64 {
+	if cur.Close > prev.Close {
+		return prevOBV + cur.Turnover
+	}
+	if cur.Close < prev.Close {
+		return prevOBV - cur.Turnover
+	}
+	return prevOBV
+}
+
+// 比較対象がない、または平均が0のときは0を返す
+func volumeRatio(turnover float64, prev []float64) float64 {
+	avg := average(prev)
+	if avg == 0 {
+		return 0
+	}
+	return turnover / avg
+}
+
+// 比較対象がvolumeMinSamples日分ない、または標準偏差が0のときは0を返す
+// 上場直後などで数日分しかない場合に急増と判定しないようにする
+func zScore(turnover float64, prev []float64) float64 {
+	if len(prev) < volumeMinSamples {
+		return 0
+	}
+	sd := stddev(prev)
+	if sd == 0 || math.IsNaN(sd) {
+		return 0
+	}
+	return (turnover - average(prev)) / sd
+}
@@ -0,0 +1,96 @@
+// +build !integration
+
+package main
+
+import (
+	"testing"
+)
+
+func TestCalculateVolume(t *testing.T) {
+	// 日付の降順
+	dateBars := []DateBar{
+		{Date: "2020/12/20", Close: 103, Turnover: 500},
+		{Date: "2020/12/19", Close: 102, Turnover: 110},
+		{Date: "2020/12/18", Close: 102, Turnover: 90},
+		{Date: "2020/12/17", Close: 101, Turnover: 110},
+		{Date: "2020/12/16", Close: 100, Turnover: 90},
+		{Date: "2020/12/15", Close: 101, Turnover: 100},
+	}
+	// 比較対象が20日分ないのでz-scoreは0、OBVはseedの1000から累積する
+	want := []Volume{
+		{MovingAvgShort: 180, MovingAvgLong: 1000.0 / 6, OBV: 1610, Ratio: 5, ZScore: 0, Spike: false},
+		{MovingAvgShort: 100, MovingAvgLong: 100, OBV: 1110, Ratio: 110 / 97.5, ZScore: 0, Spike: false},
+		{MovingAvgShort: 97.5, MovingAvgLong: 97.5, OBV: 1110, Ratio: 0.9, ZScore: 0, Spike: false},
+		{MovingAvgShort: 100, MovingAvgLong: 100, OBV: 1020, Ratio: 110.0 / 95, ZScore: 0, Spike: false},
+		{MovingAvgShort: 95, MovingAvgLong: 95, OBV: 910, Ratio: 0.9, ZScore: 0, Spike: false},
+		{MovingAvgShort: 100, MovingAvgLong: 100, OBV: 1000, Ratio: 0, ZScore: 0, Spike: false},
+	}
+
+	got := calculateVolume(dateBars, 1000)
+	if len(got) != len(want) {
+		t.Fatalf("got: %d, want: %d", len(got), len(want))
+	}
+	for i, g := range got {
+		v, w := g.Volume, want[i]
+		if g.Date != dateBars[i].Date {
+			t.Errorf("got date: %s, want: %s", g.Date, dateBars[i].Date)
+		}
+		if !almostEqual(v.MovingAvgShort, w.MovingAvgShort) ||
+			!almostEqual(v.MovingAvgLong, w.MovingAvgLong) ||
+			!almostEqual(v.OBV, w.OBV) ||
+			!almostEqual(v.Ratio, w.Ratio) ||
+			!almostEqual(v.ZScore, w.ZScore) ||
+			v.Spike != w.Spike {
+			t.Errorf("%s got: %#v, want: %#v", g.Date, v, w)
+		}
+	}
+}
+
+func TestZScore(t *testing.T) {
+	tests := map[string]struct {
+		turnover float64
+		prev     []float64
+		want     float64
+	}{
+		"no_prev": {
+			turnover: 100,
+			prev:     nil,
+			want:     0,
+		},
+		"one_prev": {
+			turnover: 100,
+			prev:     []float64{50},
+			want:     0,
+		},
+		"short_prev": {
+			turnover: 130,
+			prev:     []float64{90, 110},
+			want:     0,
+		},
+		"flat_prev": {
+			turnover: 100,
+			prev:     repeatFloats([]float64{50}, 20),
+			want:     0,
+		},
+		"spike": {
+			turnover: 130,
+			prev:     repeatFloats([]float64{90, 110}, 10),
+			want:     3,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := zScore(tc.turnover, tc.prev); !almostEqual(got, tc.want) {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func repeatFloats(fs []float64, n int) []float64 {
+	var res []float64
+	for i := 0; i < n; i++ {
+		res = append(res, fs...)
+	}
+	return res
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ludwig125/gke-stockprice/sheet"
+)
+
+// watchlistごとのtrendを書き込むタブ名の接頭辞
+const watchlistTabPrefix = "watch_"
+
+// Watchlist is a subset of codes someone watches.
+// watchlistのタブには1行に1つ、name, codes, owner, channelの順に書く
+// codesはカンマか空白区切り。channelが空の場合は全体のSlack通知に含める
+type Watchlist struct {
+	Name    string
+	Codes   []string
+	Owner   string
+	Channel string
+}
+
+func (w Watchlist) tabName() string {
+	return watchlistTabPrefix + w.Name
+}
+
+// 先頭行が"name"で始まる場合はカラム名として読み飛ばす
+// watchlistのタブは誰でも編集できるので、不正な行や銘柄コードはエラーにせず読み飛ばし、その理由をskippedとして返す
+func fetchWatchlists(s sheet.Sheet) (watchlists []Watchlist, skipped []string, err error) {
+	rows, err := s.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to ReadSheet: %v", err)
+	}
+	names := make(map[string]bool)
+	for i, row := range rows {
+		cell := func(j int) string {
+			if j < len(row) {
+				return strings.TrimSpace(row[j])
+			}
+			return ""
+		}
+		name := cell(0)
+		if name == "" || (i == 0 && name == "name") {
+			continue
+		}
+		if strings.ContainsAny(name, " !'") {
+			skipped = append(skipped, fmt.Sprintf("row %d: invalid watchlist name: '%s'", i+1, name))
+			continue
+		}
+		if names[name] {
+			skipped = append(skipped, fmt.Sprintf("row %d: duplicated watchlist name: '%s'", i+1, name))
+			continue
+		}
+		names[name] = true
+
+		var codes []string
+		for _, c := range strings.FieldsFunc(cell(1), func(r rune) bool { return r == ',' || r == ' ' || r == '\n' }) {
+			if _, err := strconv.Atoi(c); err != nil {
+				skipped = append(skipped, fmt.Sprintf("row %d: invalid code '%s' in watchlist %s", i+1, c, name))
+				continue
+			}
+			codes = append(codes, c)
+		}
+		watchlists = append(watchlists, Watchlist{Name: name, Codes: codes, Owner: cell(2), Channel: cell(3)})
+	}
+	return watchlists, skipped, nil
+}
+
+// ctlからwatchlistの銘柄を抜き出す。当日のtrendがない銘柄はmissingとして返す
+func watchlistTrends(w Watchlist, ctl []codeDateTrendList) ([]codeDateTrendList, []string) {
+	codeTrend := make(map[string]codeDateTrendList, len(ctl))
+	for _, t := range ctl {
+		codeTrend[t.code] = t
+	}
+	var trends []codeDateTrendList
+	var missing []string
+	for _, code := range w.Codes {
+		t, ok := codeTrend[code]
+		if !ok {
+			missing = append(missing, code)
+			continue
+		}
+		trends = append(trends, t)
+	}
+	return trends, missing
+}
+
+// 書き込みに失敗したwatchlistは、ログとSlackに残して他のwatchlistの書き込みを続ける
+func (c CalculateDailyMovingAvgTrend) writeWatchlists(ctl []codeDateTrendList, date string) {
+	for _, w := range c.watchlists {
+		if err := c.writeWatchlist(w, ctl, date); err != nil {
+			log.Printf("failed to write watchlist %s: %v", w.Name, err)
+			c.summary.Add(fmt.Sprintf("watchlist %s の書き込みに失敗しました: %v", w.Name, err))
+		}
+	}
+}
+
+func (c CalculateDailyMovingAvgTrend) writeWatchlist(w Watchlist, ctl []codeDateTrendList, date string) error {
+	trends, missing := watchlistTrends(w, ctl)
+	if len(missing) > 0 {
+		log.Printf("watchlist %s has codes without trend on %s: %v", w.Name, date, missing)
+	}
+	c.notifyWatchlist(w, createWatchlistSlackMsg(w, trends, missing, date))
+
+	sh, ok := c.watchlistSheets[w.Name]
+	if !ok {
+		return nil
+	}
+	sheetData := makeTrendDataForSheet(trends)
+	if len(sheetData) == 0 { // 該当する銘柄がなくてもカラム名と日付は書き込む
+		sheetData = [][]string{append(sheetColumnName(), strings.Replace(date, "/", "", -1))}
+	}
+	log.Printf("try to print watchlist %s to sheet", w.Name)
+	if err := sh.Update(sheetData); err != nil {
+		return fmt.Errorf("failed to print watchlist %s to sheet: %w", w.Name, err)
+	}
+	if err := formatTrendSheet(sh); err != nil {
+		return fmt.Errorf("failed to formatTrendSheet watchlist %s: %w", w.Name, err)
+	}
+	return nil
+}
+
+// channelの指定があればそのchannelに送り、なければ全体のSlack通知に含める
+// 送信に失敗してもdaily処理は止めない
+func (c CalculateDailyMovingAvgTrend) notifyWatchlist(w Watchlist, msg string) {
+	if w.Channel == "" || c.watchlistSlack == nil {
+		c.summary.Add(msg)
+		return
+	}
+	if err := c.watchlistSlack(w.Channel).SendMessage("gke-stockprice", msg, ":eyes:"); err != nil {
+		log.Printf("failed to send watchlist %s to %s: %v", w.Name, w.Channel, err)
+	}
+}
+
+// trendの転換、5日移動平均線の上抜け・下抜け、売買高の急増があった銘柄を列挙する
+func createWatchlistSlackMsg(w Watchlist, trends []codeDateTrendList, missing []string, date string) string {
+	msg := fmt.Sprintf("watchlist %s %s: %d銘柄", w.Name, date, len(trends))
+	if w.Owner != "" {
+		msg += fmt.Sprintf(" (owner: %s)", w.Owner)
+	}
+
+	sorted := make([]codeDateTrendList, len(trends))
+	copy(sorted, trends)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].code < sorted[j].code })
+
+	var turns, crosses, spikes []string
+	for _, t := range sorted {
+		if t.trendTurn == upwardTurn || t.trendTurn == downwardTurn {
+			turns = append(turns, fmt.Sprintf("%s(%s)", t.code, t.trendTurn))
+		}
+		if t.crossMoving5 == upwardCross || t.crossMoving5 == downwardCross {
+			crosses = append(crosses, fmt.Sprintf("%s(%s)", t.code, t.crossMoving5))
+		}
+		if t.volumeSpike {
+			spikes = append(spikes, t.code)
+		}
+	}
+	if len(turns)+len(crosses)+len(spikes) == 0 {
+		msg += "\n変化なし"
+	}
+	for _, l := range []struct {
+		name  string
+		codes []string
+	}{
+		{"trendTurn", turns},
+		{"crossMoving5", crosses},
+		{"volumeSpike", spikes},
+		{"trendなし", missing},
+	} {
+		if len(l.codes) > 0 {
+			msg += fmt.Sprintf("\n%s: %s", l.name, strings.Join(l.codes, ","))
+		}
+	}
+	return msg
+}
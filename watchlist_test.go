@@ -0,0 +1,190 @@
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ludwig125/gke-stockprice/sheet"
+)
+
+func TestFetchWatchlists(t *testing.T) {
+	cases := map[string]struct {
+		rows        [][]string
+		want        []Watchlist
+		wantSkipped int
+	}{
+		"with_header": {
+			rows: [][]string{
+				{"name", "codes", "owner", "channel"},
+				{"bank", "8306, 8316,8411", "alice", "#bank"},
+				{"", "", "", ""},
+				{"auto", "7203 7267"},
+			},
+			want: []Watchlist{
+				{Name: "bank", Codes: []string{"8306", "8316", "8411"}, Owner: "alice", Channel: "#bank"},
+				{Name: "auto", Codes: []string{"7203", "7267"}},
+			},
+		},
+		"without_header": {
+			rows: [][]string{{"bank", "8306", "", "#bank"}},
+			want: []Watchlist{{Name: "bank", Codes: []string{"8306"}, Channel: "#bank"}},
+		},
+		"empty": {
+			rows: nil,
+			want: nil,
+		},
+		// 不正な銘柄コードだけを読み飛ばす
+		"invalid_code": {
+			rows:        [][]string{{"bank", "8306,abc"}},
+			want:        []Watchlist{{Name: "bank", Codes: []string{"8306"}}},
+			wantSkipped: 1,
+		},
+		// 後の行を読み飛ばす
+		"duplicated_name": {
+			rows:        [][]string{{"bank", "8306"}, {"bank", "8316"}},
+			want:        []Watchlist{{Name: "bank", Codes: []string{"8306"}}},
+			wantSkipped: 1,
+		},
+		"invalid_name": {
+			rows:        [][]string{{"my bank", "8306"}, {"auto", "7203"}},
+			want:        []Watchlist{{Name: "auto", Codes: []string{"7203"}}},
+			wantSkipped: 1,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, skipped, err := fetchWatchlists(HolidaySpreadSheetMock{ReadSheetRes: tc.rows})
+			if err != nil {
+				t.Fatalf("failed to fetchWatchlists: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %#v, want %#v", got, tc.want)
+			}
+			if len(skipped) != tc.wantSkipped {
+				t.Errorf("got skipped %v, want %d", skipped, tc.wantSkipped)
+			}
+		})
+	}
+
+	if _, _, err := fetchWatchlists(HolidaySpreadSheetMock{ReadSheetError: errors.New("error")}); err == nil {
+		t.Error("want error when sheet cannot be read")
+	}
+}
+
+func TestCreateWatchlistSlackMsg(t *testing.T) {
+	trends := []codeDateTrendList{
+		{code: "8411", trendTurn: noTurn, crossMoving5: noCross, volumeSpike: true},
+		{code: "8306", trendTurn: upwardTurn, crossMoving5: upwardCross},
+		{code: "8316", trendTurn: noTurn, crossMoving5: downwardCross},
+	}
+	cases := map[string]struct {
+		w       Watchlist
+		trends  []codeDateTrendList
+		missing []string
+		want    string
+	}{
+		"changed": {
+			w:       Watchlist{Name: "bank", Owner: "alice"},
+			trends:  trends,
+			missing: []string{"9999"},
+			want: "watchlist bank 2021/01/08: 3銘柄 (owner: alice)\n" +
+				"trendTurn: 8306(upwardTurn)\n" +
+				"crossMoving5: 8306(upwardCross),8316(downwardCross)\n" +
+				"volumeSpike: 8411\n" +
+				"trendなし: 9999",
+		},
+		"no_change": {
+			w:      Watchlist{Name: "bank"},
+			trends: []codeDateTrendList{{code: "8306", trendTurn: noTurn, crossMoving5: noCross}},
+			want:   "watchlist bank 2021/01/08: 1銘柄\n変化なし",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := createWatchlistSlackMsg(tc.w, tc.trends, tc.missing, "2021/01/08"); got != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+type recordSlack struct {
+	channel string
+	sent    map[string][]string
+}
+
+func (s recordSlack) SendMessage(service, msg, emoji string) error {
+	s.sent[s.channel] = append(s.sent[s.channel], msg)
+	return nil
+}
+
+func TestWriteWatchlists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchlist")
+	if err != nil {
+		t.Fatalf("failed to TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctl := []codeDateTrendList{
+		{code: "8306", date: "2021/01/08", trend: longTermAdvance, trendTurn: upwardTurn, crossMoving5: noCross, growthRate: 1.5},
+		{code: "8316", date: "2021/01/08", trend: longTermDecline, trendTurn: noTurn, crossMoving5: noCross, growthRate: -1},
+		{code: "7203", date: "2021/01/08", trend: longTermAdvance, trendTurn: noTurn, crossMoving5: noCross, growthRate: 2},
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0644); err != nil {
+		t.Fatalf("failed to WriteFile: %v", err)
+	}
+	sent := make(map[string][]string)
+	summary := &SlackSummary{}
+	c := CalculateDailyMovingAvgTrend{
+		summary: summary,
+		watchlists: []Watchlist{
+			{Name: "broken", Codes: []string{"7203"}, Channel: "#broken"},
+			{Name: "bank", Codes: []string{"8316", "8306"}, Channel: "#bank"},
+			{Name: "auto", Codes: []string{"9999"}},
+		},
+		watchlistSheets: map[string]sheet.Sheet{
+			"broken": sheet.NewCSVSheet(filepath.Join(dir, "file"), "watch_broken"), // ディレクトリがファイルなので書き込めない
+			"bank": sheet.NewCSVSheet(dir, "watch_bank"),
+			"auto": sheet.NewCSVSheet(dir, "watch_auto"),
+		},
+		watchlistSlack: func(channel string) Slack { return recordSlack{channel: channel, sent: sent} },
+	}
+	c.writeWatchlists(ctl, "2021/01/08")
+
+	got, err := sheet.NewCSVSheet(dir, "watch_bank").Read()
+	if err != nil {
+		t.Fatalf("failed to Read: %v", err)
+	}
+	want := makeTrendDataForSheet([]codeDateTrendList{ctl[0], ctl[1]})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// 該当する銘柄がなくてもカラム名と日付は書き込む
+	got, err = sheet.NewCSVSheet(dir, "watch_auto").Read()
+	if err != nil {
+		t.Fatalf("failed to Read: %v", err)
+	}
+	if want := [][]string{append(sheetColumnName(), "20210108")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// channelのあるwatchlistはそのchannelに、ないものは全体の通知に含める
+	if want := []string{"watchlist bank 2021/01/08: 2銘柄\ntrendTurn: 8306(upwardTurn)"}; !reflect.DeepEqual(sent["#bank"], want) {
+		t.Errorf("got sent %v, want %v", sent["#bank"], want)
+	}
+	// 書き込めなかったwatchlistがあっても他のwatchlistは書き込み、失敗したことを全体の通知に含める
+	lines := strings.SplitN(summary.String(), "\n", 2)
+	if !strings.HasPrefix(lines[0], "watchlist broken の書き込みに失敗しました") {
+		t.Errorf("got summary %q, want failure of broken", summary.String())
+	}
+	if want := "watchlist auto 2021/01/08: 0銘柄\n変化なし\ntrendなし: 9999"; len(lines) < 2 || lines[1] != want {
+		t.Errorf("got summary %q, want %q", summary.String(), want)
+	}
+}